@@ -13,14 +13,23 @@ import (
 	"github.com/izzddalfk/kumote/internal/assistant/config"
 	"github.com/izzddalfk/kumote/internal/assistant/core"
 	"github.com/izzddalfk/kumote/internal/assistant/infra/agents"
+	"github.com/izzddalfk/kumote/internal/assistant/infra/jobstore"
 	"github.com/izzddalfk/kumote/internal/assistant/infra/metricscollector"
+	"github.com/izzddalfk/kumote/internal/assistant/infra/prommetrics"
 	"github.com/izzddalfk/kumote/internal/assistant/infra/ratelimiter"
 	"github.com/izzddalfk/kumote/internal/assistant/infra/scanner"
+	"github.com/izzddalfk/kumote/internal/assistant/infra/sessionstore"
 	"github.com/izzddalfk/kumote/internal/assistant/infra/telegram"
+	"github.com/izzddalfk/kumote/internal/assistant/infra/transcriber"
 	"github.com/izzddalfk/kumote/internal/assistant/infra/userrepository"
+	"github.com/izzddalfk/kumote/internal/assistant/presentation/polling"
 	"github.com/izzddalfk/kumote/internal/assistant/presentation/rest"
+	"github.com/izzddalfk/kumote/internal/assistant/presentation/rest/handlers"
 )
 
+// dataPath is the directory for local state like metrics database
+const dataPath = "data"
+
 func main() {
 	// Setup context
 	ctx := context.Background()
@@ -34,8 +43,11 @@ func main() {
 	// Setup logger
 	setupLogger(configs.ApplicationConfig.LogLevel)
 
+	// Operational metrics, scraped from the HTTP server
+	metrics := prommetrics.NewMetrics()
+
 	// Initialize dependencies
-	deps, err := initializeDependencies(configs)
+	deps, err := initializeDependencies(configs, metrics)
 	if err != nil {
 		log.Fatalf("failed to initialize dependencies: %v", err)
 	}
@@ -46,31 +58,121 @@ func main() {
 		log.Fatalf("failed to initialize assistant service: %v", err)
 	}
 
-	// Create and start HTTP server
+	// Let Telegram clients suggest the built-in commands, they still work when this fails
+	if err := assistantService.RegisterCommands(ctx); err != nil {
+		slog.WarnContext(ctx, "Failed to register bot commands", slog.String("error", err.Error()))
+	}
+
+	// Commands left unfinished when Kumote stopped can be retried by their users
+	if err := assistantService.RecoverInterruptedCommands(ctx); err != nil {
+		slog.WarnContext(ctx, "Failed to recover interrupted commands", slog.String("error", err.Error()))
+	}
+
+	// Jobs that were waiting for their turn when Kumote stopped are queued again
+	if err := assistantService.ResumeQueuedJobs(ctx); err != nil {
+		slog.WarnContext(ctx, "Failed to resume queued jobs", slog.String("error", err.Error()))
+	}
+
+	// Start receiving Telegram updates (this blocks until shutdown)
+	switch configs.ApplicationConfig.TelegramUpdateMode {
+	case config.UpdateModePolling:
+		err = startPoller(ctx, configs, assistantService)
+	default:
+		err = startHTTPServer(ctx, configs, assistantService, metrics)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Server error", "error", err)
+		os.Exit(1)
+	}
+
+	// No more updates come in, let the running jobs finish or cancel them after the timeout
+	shutdownTimeout := time.Duration(configs.ApplicationConfig.ShutdownTimeoutSeconds) * time.Second
+	slog.InfoContext(ctx, "Waiting for running jobs to finish", slog.Duration("timeout", shutdownTimeout))
+	shutdownCtx, cancel := context.WithTimeout(ctx, shutdownTimeout)
+	defer cancel()
+	if err := assistantService.Shutdown(shutdownCtx); err != nil {
+		slog.WarnContext(ctx, "Jobs didn't stop on shutdown", slog.String("error", err.Error()))
+	}
+
+	slog.InfoContext(ctx, "Application shutdown completed")
+}
+
+// startHTTPServer receives Telegram updates through the webhook endpoint
+func startHTTPServer(ctx context.Context, cfg *config.Configs, assistantService core.AssistantService, metrics *prommetrics.Metrics) error {
+	// Register the webhook with the same secret the server verifies
+	if cfg.ApplicationConfig.TelegramWebhookURL != "" {
+		if err := registerWebhook(ctx, cfg); err != nil {
+			return err
+		}
+	} else {
+		slog.WarnContext(ctx, "TELEGRAM_WEBHOOK_URL is not set, make sure the webhook is registered with the configured secret token")
+	}
+
 	httpServer, err := rest.NewServer(rest.ServerConfig{
 		AssistantService: assistantService,
-		Port:             fmt.Sprintf(":%d", configs.ServerConfig.Port),
+		WebhookSecret:    cfg.ApplicationConfig.TelegramWebhookSecret,
+		StatsToken:       cfg.ApplicationConfig.StatsAPIToken,
+		MetricsHandler:   metrics.Handler(),
+		Port:             fmt.Sprintf(":%d", cfg.ServerConfig.Port),
 		ReadTimeout:      time.Second * 5,
 		WriteTimeout:     time.Second * 30,
 	})
 	if err != nil {
-		log.Fatalf("failed to create HTTP server: %v", err)
+		return fmt.Errorf("failed to create HTTP server: %w", err)
 	}
 
-	slog.InfoContext(ctx, fmt.Sprintf("Kumote started at port: %d", configs.ServerConfig.Port))
+	slog.InfoContext(ctx, fmt.Sprintf("Kumote started at port: %d", cfg.ServerConfig.Port))
 
-	// Start server (this blocks until shutdown)
-	if err := httpServer.Start(); err != nil {
-		slog.ErrorContext(ctx, "Server error", "error", err)
-		os.Exit(1)
+	return httpServer.Start()
+}
+
+// registerWebhook points the Telegram bot to Kumote webhook endpoint
+func registerWebhook(ctx context.Context, cfg *config.Configs) error {
+	telegramClient, err := telegram.NewClient(telegram.ClientConfig{
+		BaseURL:  cfg.ApplicationConfig.TelegramBaseURL,
+		BotToken: cfg.ApplicationConfig.TelegramBotToken,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to initialize Telegram client: %w", err)
 	}
 
-	slog.InfoContext(ctx, "Application shutdown completed")
+	if err := telegramClient.SetWebhook(ctx, telegram.SetWebhookInput{
+		URL:            cfg.ApplicationConfig.TelegramWebhookURL,
+		SecretToken:    cfg.ApplicationConfig.TelegramWebhookSecret,
+		AllowedUpdates: handlers.AllowedUpdates,
+	}); err != nil {
+		return fmt.Errorf("failed to register Telegram webhook: %w", err)
+	}
+
+	return nil
+}
+
+// startPoller receives Telegram updates through long polling,
+// so Kumote can run without exposing a public webhook URL
+func startPoller(ctx context.Context, cfg *config.Configs, assistantService core.AssistantService) error {
+	offsetStore, err := polling.NewFileOffsetStore(filepath.Join(dataPath, "telegram-offset"))
+	if err != nil {
+		return fmt.Errorf("failed to create update offset store: %w", err)
+	}
+
+	poller, err := polling.NewPoller(polling.PollerConfig{
+		AssistantService: assistantService,
+		BaseURL:          cfg.ApplicationConfig.TelegramBaseURL,
+		BotToken:         cfg.ApplicationConfig.TelegramBotToken,
+		OffsetStore:      offsetStore,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create Telegram poller: %w", err)
+	}
+
+	slog.InfoContext(ctx, "Kumote started in long polling mode")
+
+	return poller.Start()
 }
 
 // Dependencies holds all initialized dependencies
 type Dependencies struct {
-	AICodeExecutor   core.Agent
+	AICodeExecutor   core.AgentRegistry
 	UserRepository   core.UserRepository
 	MetricsCollector core.MetricsCollector
 	RateLimiter      core.RateLimiter
@@ -104,10 +206,9 @@ func setupLogger(logLevel string) {
 	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, opts)))
 }
 
-// initializeDependencies initializes all external dependencies
-func initializeDependencies(cfg *config.Configs) (*core.ServiceConfig, error) {
+// initializeDependencies initializes all external dependencies, instrumented with the metrics
+func initializeDependencies(cfg *config.Configs, metrics *prommetrics.Metrics) (*core.ServiceConfig, error) {
 	// Create data directories if they don't exist
-	dataPath := "data"
 	os.MkdirAll(dataPath, 0755)
 
 	// Initialize metrics collector
@@ -117,30 +218,53 @@ func initializeDependencies(cfg *config.Configs) (*core.ServiceConfig, error) {
 		return nil, fmt.Errorf("failed to initialize metrics collector: %w", err)
 	}
 
-	// Initialize AI Agent
-	aiExecutor, err := agents.NewClaudeCodeAgent(agents.ClaudeCodeAgentConfig{
-		ExecutablePath: cfg.ApplicationConfig.ClaudeCodePath,
-		DefaultModel:   "sonnet",
-		BaseWorkDir:    cfg.ApplicationConfig.ProjectsPath,
-		Debug:          true, // TODO: Setup this flag
-	})
+	// Initialize session store
+	sessionsDbPath := filepath.Join(dataPath, "sessions.db")
+	sessionStore, err := sessionstore.NewSessionStore(sessionsDbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize session store: %w", err)
+	}
+
+	// Initialize job store, persisting the queued jobs
+	jobsDbPath := filepath.Join(dataPath, "jobs.db")
+	jobStore, err := jobstore.NewJobStore(jobsDbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize job store: %w", err)
+	}
+
+	// Initialize AI Agents
+	aiAgents, err := initializeAgents(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize ai agents: %w", err)
+	}
+
+	// Initialize voice transcriber
+	voiceTranscriber, err := initializeTranscriber(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize ai agent: %w", err)
+		return nil, fmt.Errorf("failed to initialize voice transcriber: %w", err)
 	}
 
 	// Initialize project scanner
 	projectScanner, err := scanner.NewFileSystemScanner(scanner.FileSystemScannerConfig{
 		ProjectIndexPath:       cfg.ApplicationConfig.ProjectIndexPath,
+		ProjectsPath:           cfg.ApplicationConfig.ProjectsPath,
 		WordProximityThreshold: 0.5, // use lower threshold for less permissive matching
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize project scanner: %w", err)
 	}
+	if cfg.ApplicationConfig.RefreshProjectsOnStart {
+		// The existing index is still usable when the scan fails, so don't stop the startup
+		if _, err := projectScanner.RefreshProjects(context.Background()); err != nil {
+			slog.Warn("Failed to refresh project index on startup", slog.String("error", err.Error()))
+		}
+	}
 
 	// Initialize Telegram storage
 	telegramStorage, err := telegram.NewClient(telegram.ClientConfig{
-		BaseURL:  cfg.ApplicationConfig.TelegramBaseURL,
-		BotToken: cfg.ApplicationConfig.TelegramBotToken,
+		BaseURL:   cfg.ApplicationConfig.TelegramBaseURL,
+		BotToken:  cfg.ApplicationConfig.TelegramBotToken,
+		ParseMode: cfg.ApplicationConfig.TelegramParseMode,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize Telegram client: %w", err)
@@ -155,11 +279,76 @@ func initializeDependencies(cfg *config.Configs) (*core.ServiceConfig, error) {
 	}
 
 	return &core.ServiceConfig{
-		Agent:            aiExecutor,
-		Telegram:         telegramStorage,
+		Agents:           metrics.WrapAgents(aiAgents),
+		Telegram:         metrics.WrapTelegram(telegramStorage),
 		ProjectScanner:   projectScanner,
-		MetricsCollector: metricsCollector,
+		MetricsCollector: metrics.WrapMetricsCollector(metricsCollector),
+		MetricsReporter:  metricsCollector,
 		UserRepo:         userRepo,
-		RateLimiter:      ratelimiter.NewRateLimiter(2), // TODO: revisit this value later
+		RateLimiter:      metrics.WrapRateLimiter(ratelimiter.NewRateLimiter(2)), // TODO: revisit this value later
+		Sessions:         sessionStore,
+		Queue:            jobStore,
+		Journal:          jobStore,
+		Transcriber:      voiceTranscriber,
+
+		SessionIdleTimeout: time.Duration(cfg.ApplicationConfig.SessionIdleMinutes) * time.Minute,
+		MaxConcurrentJobs:  cfg.ApplicationConfig.MaxConcurrentJobs,
+		CallbackSecret:     []byte(cfg.ApplicationConfig.TelegramCallbackSecret),
+		Budget: core.UsageBudget{
+			DailyCostUSD:   cfg.ApplicationConfig.UserDailyCostBudgetUSD,
+			MonthlyCostUSD: cfg.ApplicationConfig.UserMonthlyCostBudgetUSD,
+			DailyTokens:    cfg.ApplicationConfig.UserDailyTokenBudget,
+			MonthlyTokens:  cfg.ApplicationConfig.UserMonthlyTokenBudget,
+		},
 	}, nil
 }
+
+// initializeTranscriber returns the whisper.cpp transcriber of voice messages,
+// or nil when it's not configured
+func initializeTranscriber(cfg *config.Configs) (core.Transcriber, error) {
+	if cfg.ApplicationConfig.WhisperCLIPath == "" {
+		return nil, nil
+	}
+
+	return transcriber.NewWhisperCPPTranscriber(transcriber.WhisperCPPTranscriberConfig{
+		ExecutablePath: cfg.ApplicationConfig.WhisperCLIPath,
+		ModelPath:      cfg.ApplicationConfig.WhisperModelPath,
+		FFmpegPath:     cfg.ApplicationConfig.FFmpegPath,
+		Language:       cfg.ApplicationConfig.WhisperLanguage,
+		Debug:          true, // TODO: Setup this flag
+	})
+}
+
+// initializeAgents registers every agent that has its CLI configured
+func initializeAgents(cfg *config.Configs) (*agents.Registry, error) {
+	configuredAgents := make(map[string]core.Agent)
+
+	if cfg.ApplicationConfig.ClaudeCodePath != "" {
+		claudeAgent, err := agents.NewClaudeCodeAgent(agents.ClaudeCodeAgentConfig{
+			ExecutablePath: cfg.ApplicationConfig.ClaudeCodePath,
+			DefaultModel:   "sonnet",
+			BaseWorkDir:    cfg.ApplicationConfig.ProjectsPath,
+			Debug:          true, // TODO: Setup this flag
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize claude code agent: %w", err)
+		}
+		configuredAgents[agents.ClaudeCodeAgentName] = claudeAgent
+	}
+
+	if cfg.ApplicationConfig.GeminiCLIPath != "" {
+		geminiAgent, err := agents.NewGeminiCLIAgent(agents.GeminiCLIAgentConfig{
+			ExecutablePath: cfg.ApplicationConfig.GeminiCLIPath,
+			Debug:          true, // TODO: Setup this flag
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize gemini cli agent: %w", err)
+		}
+		configuredAgents[agents.GeminiCLIAgentName] = geminiAgent
+	}
+
+	return agents.NewRegistry(agents.RegistryConfig{
+		Agents:       configuredAgents,
+		DefaultAgent: cfg.ApplicationConfig.DefaultAgent,
+	})
+}
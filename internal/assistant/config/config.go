@@ -2,11 +2,21 @@ package config
 
 import (
 	"fmt"
+	"regexp"
 	"time"
 
 	"github.com/gosidekick/goconfig"
 )
 
+// Telegram update modes
+const (
+	UpdateModeWebhook = "webhook"
+	UpdateModePolling = "polling"
+)
+
+// webhookSecretPattern follows the characters Telegram allows for `secret_token`
+var webhookSecretPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
 type Configs struct {
 	ApplicationConfig ApplicationConfig
 	ServerConfig      ServerConfig
@@ -15,11 +25,35 @@ type Configs struct {
 type ApplicationConfig struct {
 	LogLevel               string `cfg:"log_level" cfgDefault:"debug"`
 	ProjectsPath           string `cfg:"projects_path" cfgRequired:"true"`
-	ClaudeCodePath         string `cfg:"claude_code_path" cfgRequired:"true"`
+	DefaultAgent           string `cfg:"default_agent" cfgDefault:"claude"` // Agent used when a message doesn't pick one: "claude" or "gemini"
+	ClaudeCodePath         string `cfg:"claude_code_path"`
+	GeminiCLIPath          string `cfg:"gemini_cli_path"`
 	ProjectIndexPath       string `cfg:"project_index_path"`
+	RefreshProjectsOnStart bool   `cfg:"refresh_projects_on_start" cfgDefault:"true"` // Rebuild the project index from PROJECTS_PATH on startup
 	TelegramBaseURL        string `cfg:"telegram_base_url" cfgDefault:"https://api.telegram.org"`
 	TelegramBotToken       string `cfg:"kumote_telegram_bot_token" cfgRequired:"true"`
 	TelegramAllowedUserIDs string `cfg:"telegram_allowed_user_ids" cfgRequired:"true"` // TODO: It's not used by now and should be []int64
+	TelegramUpdateMode     string `cfg:"telegram_update_mode" cfgDefault:"webhook"`    // How updates are received: "webhook" or "polling"
+	TelegramWebhookURL     string `cfg:"telegram_webhook_url"`                         // Public URL of the webhook endpoint, registered on startup when set
+	TelegramWebhookSecret  string `cfg:"telegram_webhook_secret"`                      // Secret token Telegram sends back in every webhook request
+	TelegramParseMode      string `cfg:"telegram_parse_mode" cfgDefault:"MarkdownV2"`  // How responses are formatted: "MarkdownV2" or "HTML"
+	TelegramCallbackSecret string `cfg:"telegram_callback_secret"`                     // Key signing button data, buttons stop working on restart when empty
+	SessionIdleMinutes     int    `cfg:"session_idle_minutes" cfgDefault:"120"`        // Conversations idle for longer than this start fresh
+	ShutdownTimeoutSeconds int    `cfg:"shutdown_timeout_seconds" cfgDefault:"30"`     // How long running jobs may finish on shutdown before they're cancelled
+	MaxConcurrentJobs      int    `cfg:"max_concurrent_jobs" cfgDefault:"2"`           // How many agent jobs run at the same time, one per project at most
+	StatsAPIToken          string `cfg:"stats_api_token"`                              // Bearer token of the `/stats` endpoint, which is disabled when empty
+
+	// Voice messages are transcribed with whisper.cpp, and declined when WhisperCLIPath is empty
+	WhisperCLIPath   string `cfg:"whisper_cli_path"`
+	WhisperModelPath string `cfg:"whisper_model_path"`                 // ggml model file of whisper.cpp, required along with WhisperCLIPath
+	WhisperLanguage  string `cfg:"whisper_language" cfgDefault:"auto"` // Spoken language, e.g. "en", or "auto" to detect it
+	FFmpegPath       string `cfg:"ffmpeg_path" cfgDefault:"ffmpeg"`    // Converts voice messages to the WAV audio whisper.cpp reads
+
+	// Agent usage limits of every user, unlimited when 0. Days and months start in the local time of the server.
+	UserDailyCostBudgetUSD   float64 `cfg:"user_daily_cost_budget_usd"`
+	UserMonthlyCostBudgetUSD float64 `cfg:"user_monthly_cost_budget_usd"`
+	UserDailyTokenBudget     int64   `cfg:"user_daily_token_budget"`
+	UserMonthlyTokenBudget   int64   `cfg:"user_monthly_token_budget"`
 }
 
 // ServerConfig holds server configuration
@@ -45,6 +79,29 @@ func LoadConfig() (*Configs, error) {
 		return nil, fmt.Errorf("failed to parse server config: %w", err)
 	}
 
+	switch appCfg.TelegramUpdateMode {
+	case UpdateModeWebhook, UpdateModePolling:
+	default:
+		return nil, fmt.Errorf("invalid telegram update mode %q, must be %q or %q",
+			appCfg.TelegramUpdateMode, UpdateModeWebhook, UpdateModePolling)
+	}
+
+	if appCfg.TelegramUpdateMode == UpdateModeWebhook && appCfg.TelegramWebhookSecret == "" {
+		return nil, fmt.Errorf("telegram webhook secret is required in %q update mode", UpdateModeWebhook)
+	}
+	if appCfg.TelegramWebhookSecret != "" && !webhookSecretPattern.MatchString(appCfg.TelegramWebhookSecret) {
+		return nil, fmt.Errorf("telegram webhook secret must be 1-256 characters of A-Z, a-z, 0-9, _ and -")
+	}
+
+	if appCfg.WhisperCLIPath != "" && appCfg.WhisperModelPath == "" {
+		return nil, fmt.Errorf("whisper model path is required to transcribe voice messages")
+	}
+
+	if appCfg.UserDailyCostBudgetUSD < 0 || appCfg.UserMonthlyCostBudgetUSD < 0 ||
+		appCfg.UserDailyTokenBudget < 0 || appCfg.UserMonthlyTokenBudget < 0 {
+		return nil, fmt.Errorf("user budgets must not be negative")
+	}
+
 	return &Configs{
 		ApplicationConfig: appCfg,
 		ServerConfig:      serverCfg,
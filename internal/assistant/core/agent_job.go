@@ -0,0 +1,150 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+	"unicode/utf8"
+)
+
+// agentJob holds everything needed to run a command with an agent in background
+type agentJob struct {
+	id          string
+	cmd         Command
+	agentName   string
+	agent       Agent
+	prompt      string
+	projectName string
+	execCtx     ExecutionContext
+	sessionID   *string
+	startTime   time.Time
+	journalID   int64
+}
+
+// runAgentJob executes the job with its agent while reporting progress to the chat,
+// then sends the agent's response, or why it failed, records the metrics and returns the final
+// status of the job along with the error it failed with
+func (s *Service) runAgentJob(ctx context.Context, job agentJob) (JobStatus, error) {
+	cmd := job.cmd
+	chatID := cmd.ReplyChatID()
+	// the job context is cancelled by `/cancel`, the outcome must still be reported
+	reportCtx := context.WithoutCancel(ctx)
+
+	progress := newProgressReporter(s.telegram, chatID, s.progressUpdateInterval,
+		fmt.Sprintf("Send /cancel %s to stop it.", job.id))
+	progress.Start(ctx)
+
+	// Process the command to AI assistant
+	result, err := job.agent.ExecuteCommandStream(ctx, AgentCommandInput{
+		Prompt:           job.prompt,
+		ExecutionContext: job.execCtx,
+		SessionID:        job.sessionID, // Pass session ID if available
+	}, progress.OnEvent)
+	if err != nil {
+		status, progressStatus := JobStatusFailed, "❌ Failed"
+		failure := fmt.Errorf("%w: %w", ErrCommandFailed, err)
+		if ctx.Err() != nil {
+			// the agent fails with the context error when the job is stopped, the cause tells why
+			cause := context.Cause(ctx)
+			failure = cause
+			switch {
+			case errors.Is(cause, ErrJobCancelled):
+				status, progressStatus = JobStatusCancelled, "🛑 Cancelled"
+			case errors.Is(cause, ErrShuttingDown):
+				status, progressStatus = JobStatusCancelled, "🛑 Cancelled on shutdown"
+			case errors.Is(cause, ErrCommandTimeout):
+				progressStatus = "⌛ Timed out"
+			}
+		}
+		progress.Stop(reportCtx, progressStatus)
+		slog.ErrorContext(reportCtx, "Failed to process command asynchronously",
+			slog.String("command_id", cmd.ID),
+			slog.String("job_id", job.id),
+			slog.String("agent", job.agentName),
+			slog.Int64("user_id", cmd.UserID),
+			slog.String("status", string(status)),
+			slog.String("error", err.Error()))
+		// cancelled jobs are already reported by their progress message
+		if status == JobStatusFailed {
+			s.sendFailure(reportCtx, job, failure, describeAgentFailure(failure, job.execCtx.Timeout))
+		}
+		// The stored session might be the reason of the failure (e.g. removed by the agent),
+		// so the next message in the project starts a fresh conversation
+		if job.sessionID != nil && ctx.Err() == nil {
+			s.forgetSession(reportCtx, chatID, job.execCtx.WorkingDir)
+		}
+		s.recordMetrics(reportCtx, cmd, job.startTime, commandOutcome{
+			err:       failure,
+			project:   job.projectName,
+			agentName: job.agentName,
+			prompt:    job.prompt,
+		})
+		return status, failure
+	}
+
+	// failed runs cost too
+	usage := usageFromMetadata(result.Metadata)
+
+	// Remember the agent session so follow-up messages continue the conversation,
+	// failed runs too, e.g. one that ran out of turns can be continued
+	if result.SessionID != "" {
+		s.saveSession(reportCtx, Session{
+			ChatID:    chatID,
+			Project:   job.execCtx.WorkingDir,
+			AgentName: job.agentName,
+			SessionID: result.SessionID,
+			UpdatedAt: time.Now(),
+		})
+	}
+
+	if !result.Success {
+		progress.Stop(reportCtx, "❌ Failed")
+		failure := fmt.Errorf("%w: %s", ErrCommandFailed, result.Error)
+		message := "❌ The agent couldn't complete your request."
+		if result.Error != "" {
+			message = fmt.Sprintf("❌ The agent couldn't complete your request: %s", result.Error)
+		}
+		s.sendFailure(reportCtx, job, failure, message)
+		s.recordMetrics(reportCtx, cmd, job.startTime, commandOutcome{
+			err:            failure,
+			project:        job.projectName,
+			agentName:      job.agentName,
+			prompt:         job.prompt,
+			responseLength: utf8.RuneCountInString(result.Response),
+			usage:          usage,
+		})
+		s.warnBudget(reportCtx, cmd, usage)
+		return JobStatusFailed, failure
+	}
+	progress.Stop(reportCtx, "✅ Done")
+
+	// Send the AI assistant's response via Telegram, headed by the project it's about
+	if _, err := s.telegram.SendTextMessage(reportCtx, TelegramTextMessageInput{
+		ChatID:  chatID,
+		Message: projectHeader(job.projectName) + result.Response,
+	}); err != nil {
+		slog.ErrorContext(reportCtx, "Failed to send Telegram message",
+			slog.String("command_id", cmd.ID),
+			slog.Int64("user_id", cmd.UserID),
+			slog.String("error", err.Error()))
+	}
+
+	slog.DebugContext(reportCtx, "Command processed successfully in background",
+		slog.String("command_id", cmd.ID),
+		slog.String("job_id", job.id),
+		slog.String("result", result.Response))
+
+	// Record metrics, then warn the user nearing their budget
+	s.recordMetrics(reportCtx, cmd, job.startTime, commandOutcome{
+		project:        job.projectName,
+		agentName:      job.agentName,
+		prompt:         job.prompt,
+		responseLength: utf8.RuneCountInString(result.Response),
+		usage:          usage,
+	})
+	s.warnBudget(reportCtx, cmd, usage)
+
+	return JobStatusDone, nil
+}
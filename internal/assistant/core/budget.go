@@ -0,0 +1,228 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// budgetWarningRatio is the share of a budget limit after which the user is warned
+const budgetWarningRatio = 0.8
+
+// budgetUsage is the usage of a user in the current day and calendar month
+type budgetUsage struct {
+	daily   Usage
+	monthly Usage
+}
+
+// budgetLimit is a limit of the budget along with how much of it is used
+type budgetLimit struct {
+	period string // "daily" or "monthly"
+	cost   bool   // whether the limit is on the cost, or on the tokens
+	used   float64
+	limit  float64
+}
+
+// ratio returns the share of the limit that is used
+func (l budgetLimit) ratio() float64 {
+	return l.used / l.limit
+}
+
+// describe tells how much of the limit is used, e.g. "daily cost budget ($4.10 of $5.00)"
+func (l budgetLimit) describe() string {
+	if l.cost {
+		return fmt.Sprintf("%s cost budget (%s of %s)", l.period, formatCost(l.used), formatCost(l.limit))
+	}
+	return fmt.Sprintf("%s token budget (%s of %s tokens)", l.period, formatTokens(int64(l.used)), formatTokens(int64(l.limit)))
+}
+
+// resetTime tells when the limit starts over
+func (l budgetLimit) resetTime() string {
+	if l.period == "daily" {
+		return "at midnight"
+	}
+	return "on the 1st of next month"
+}
+
+// decline returns the message telling the user the budget is used up, along with the error recorded
+func (l budgetLimit) decline() (string, error) {
+	message := fmt.Sprintf("💸 You've used up your %s. New requests are declined until it resets %s.",
+		l.describe(), l.resetTime())
+	return message, fmt.Errorf("%w: %s", ErrBudgetExceeded, l.describe())
+}
+
+// enabled reports whether the budget limits anything
+func (b UsageBudget) enabled() bool {
+	return b.DailyCostUSD > 0 || b.MonthlyCostUSD > 0 || b.DailyTokens > 0 || b.MonthlyTokens > 0
+}
+
+// limits returns the limits of the budget that are set, along with the usage of each
+func (b UsageBudget) limits(usage budgetUsage) []budgetLimit {
+	var limits []budgetLimit
+	if b.DailyCostUSD > 0 {
+		limits = append(limits, budgetLimit{period: "daily", cost: true, used: usage.daily.CostUSD, limit: b.DailyCostUSD})
+	}
+	if b.DailyTokens > 0 {
+		limits = append(limits, budgetLimit{period: "daily", used: float64(usage.daily.Tokens()), limit: float64(b.DailyTokens)})
+	}
+	if b.MonthlyCostUSD > 0 {
+		limits = append(limits, budgetLimit{period: "monthly", cost: true, used: usage.monthly.CostUSD, limit: b.MonthlyCostUSD})
+	}
+	if b.MonthlyTokens > 0 {
+		limits = append(limits, budgetLimit{period: "monthly", used: float64(usage.monthly.Tokens()), limit: float64(b.MonthlyTokens)})
+	}
+	return limits
+}
+
+// startOfDay returns the local midnight starting the day of t
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// startOfMonth returns the local midnight starting the calendar month of t
+func startOfMonth(t time.Time) time.Time {
+	year, month, _ := t.Date()
+	return time.Date(year, month, 1, 0, 0, 0, 0, t.Location())
+}
+
+// getBudgetUsage returns the usage of the user in the current day and calendar month
+func (s *Service) getBudgetUsage(ctx context.Context, userID int64) (*budgetUsage, error) {
+	now := time.Now()
+	daily, err := s.metricsReporter.GetUserUsage(ctx, userID, startOfDay(now))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get daily usage: %w", err)
+	}
+	monthly, err := s.metricsReporter.GetUserUsage(ctx, userID, startOfMonth(now))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get monthly usage: %w", err)
+	}
+
+	return &budgetUsage{daily: *daily, monthly: *monthly}, nil
+}
+
+// exceededBudget returns the limit of the budget the user used up, or nil when agents can
+// still run for the user. Agents still run when the usage can't be read.
+func (s *Service) exceededBudget(ctx context.Context, userID int64) *budgetLimit {
+	if !s.budget.enabled() {
+		return nil
+	}
+
+	usage, err := s.getBudgetUsage(ctx, userID)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to check usage budget",
+			slog.Int64("user_id", userID),
+			slog.String("error", err.Error()))
+		return nil
+	}
+
+	for _, limit := range s.budget.limits(*usage) {
+		if limit.ratio() >= 1 {
+			return &limit
+		}
+	}
+	return nil
+}
+
+// warnBudget warns the user when the run brought the usage past the warning ratio of
+// a budget limit, so the user is warned once per limit and period
+func (s *Service) warnBudget(ctx context.Context, cmd Command, run Usage) {
+	if !s.budget.enabled() || (run.CostUSD == 0 && run.Tokens() == 0) {
+		return
+	}
+
+	usage, err := s.getBudgetUsage(ctx, cmd.UserID)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to check usage budget",
+			slog.Int64("user_id", cmd.UserID),
+			slog.String("error", err.Error()))
+		return
+	}
+	before := budgetUsage{daily: subtractUsage(usage.daily, run), monthly: subtractUsage(usage.monthly, run)}
+
+	var crossed *budgetLimit
+	limitsBefore := s.budget.limits(before)
+	for i, limit := range s.budget.limits(*usage) {
+		if limitsBefore[i].ratio() < budgetWarningRatio && limit.ratio() >= budgetWarningRatio &&
+			(crossed == nil || limit.ratio() > crossed.ratio()) {
+			crossed = &limit
+		}
+	}
+	if crossed == nil {
+		return
+	}
+
+	message := fmt.Sprintf("⚠️ You've used %.0f%% of your %s.", crossed.ratio()*100, crossed.describe())
+	if crossed.ratio() >= 1 {
+		message += fmt.Sprintf(" New requests are declined until it resets %s.", crossed.resetTime())
+	}
+	s.sendMessage(ctx, cmd.ReplyChatID(), message)
+}
+
+// subtractUsage returns the usage without the run
+func subtractUsage(usage, run Usage) Usage {
+	return Usage{
+		CostUSD:      usage.CostUSD - run.CostUSD,
+		InputTokens:  usage.InputTokens - run.InputTokens,
+		OutputTokens: usage.OutputTokens - run.OutputTokens,
+	}
+}
+
+// usageFromMetadata reads what the agent run cost from the metadata of its result
+func usageFromMetadata(metadata map[string]any) Usage {
+	var usage Usage
+	usage.CostUSD, _ = metadata[MetadataCostUSD].(float64)
+	usage.InputTokens, _ = metadata[MetadataInputTokens].(int64)
+	usage.OutputTokens, _ = metadata[MetadataOutputTokens].(int64)
+	return usage
+}
+
+// showUsage replies to `/usage` with the spend of the user so far, today and this month
+func (s *Service) showUsage(ctx context.Context, cmd Command, _ string) (*QueryResult, error) {
+	usage, err := s.getBudgetUsage(ctx, cmd.UserID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get usage",
+			slog.Int64("user_id", cmd.UserID),
+			slog.String("error", err.Error()))
+		return s.reply(ctx, cmd, "❌ Failed to load your usage.")
+	}
+
+	var sb strings.Builder
+	sb.WriteString("💰 Your usage\n")
+	sb.WriteString("\nToday: " + formatUsage(usage.daily, s.budget.DailyCostUSD, s.budget.DailyTokens))
+	sb.WriteString("\nThis month: " + formatUsage(usage.monthly, s.budget.MonthlyCostUSD, s.budget.MonthlyTokens))
+
+	return s.reply(ctx, cmd, sb.String())
+}
+
+// formatUsage describes the usage in one line along with its limits, e.g. "$1.20 of $5.00 · 45.2k tokens"
+func formatUsage(usage Usage, costLimit float64, tokenLimit int64) string {
+	cost := formatCost(usage.CostUSD)
+	if costLimit > 0 {
+		cost += " of " + formatCost(costLimit)
+	}
+	tokens := formatTokens(usage.Tokens())
+	if tokenLimit > 0 {
+		tokens += " of " + formatTokens(tokenLimit)
+	}
+	return cost + " · " + tokens + " tokens"
+}
+
+// formatCost formats US dollars with cents, e.g. "$4.10"
+func formatCost(usd float64) string {
+	return fmt.Sprintf("$%.2f", usd)
+}
+
+// formatTokens shortens large token counts, e.g. "950", "45.2k" or "1.2M"
+func formatTokens(tokens int64) string {
+	switch {
+	case tokens >= 1_000_000:
+		return strings.TrimSuffix(fmt.Sprintf("%.1f", float64(tokens)/1_000_000), ".0") + "M"
+	case tokens >= 1_000:
+		return strings.TrimSuffix(fmt.Sprintf("%.1f", float64(tokens)/1_000), ".0") + "k"
+	default:
+		return fmt.Sprintf("%d", tokens)
+	}
+}
@@ -0,0 +1,134 @@
+package core_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/izzddalfk/kumote/internal/assistant/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runMetadata is the metadata of an agent run that cost the given amount
+func runMetadata(costUSD float64, inputTokens, outputTokens int64) map[string]any {
+	return map[string]any{
+		core.MetadataCostUSD:      costUSD,
+		core.MetadataInputTokens:  inputTokens,
+		core.MetadataOutputTokens: outputTokens,
+	}
+}
+
+func TestProcessCommandEnforcesBudget(t *testing.T) {
+	ts := newTestServiceWithStores(t, &fakeQueueStore{}, &fakeJournal{}, func(config *core.ServiceConfig) {
+		config.Budget = core.UsageBudget{DailyCostUSD: 1}
+	})
+	ts.agents["claude"].metadata = runMetadata(0.5, 1000, 200)
+
+	// the first half of the budget
+	ts.send(t, "run the tests in carlogbook")
+	waitFor(t, ts.agents["claude"].inputs)
+	metrics := waitFor(t, ts.metrics.metrics)
+	assert.Equal(t, 0.5, metrics.CostUSD)
+	assert.Equal(t, int64(1000), metrics.InputTokens)
+	assert.Equal(t, int64(200), metrics.OutputTokens)
+	assert.Eventually(t, func() bool {
+		return ts.journal.status(1) == core.CommandStatusDone
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "📁 mycar-logbook\n\nanswer from claude", ts.lastMessage(t), "no warning below 80%")
+
+	// the run using up the budget still finishes, and the user is warned
+	ts.send(t, "now fix them")
+	waitFor(t, ts.agents["claude"].inputs)
+	waitFor(t, ts.metrics.metrics)
+	assert.Eventually(t, func() bool {
+		return ts.lastMessage(t) == "⚠️ You've used 100% of your daily cost budget ($1.00 of $1.00). New requests are declined until it resets at midnight."
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// agents don't run anymore
+	result := ts.send(t, "run the tests again")
+	assert.False(t, result.Success)
+	assert.Equal(t, "💸 You've used up your daily cost budget ($1.00 of $1.00). New requests are declined until it resets at midnight.", ts.lastMessage(t))
+	assert.Empty(t, ts.agents["claude"].inputs)
+	assert.Equal(t, core.ErrorTypeBudgetExceeded, ts.metrics.last(t).ErrorType)
+	assert.Equal(t, core.CommandStatusFailed, ts.journal.status(3))
+
+	// built-in commands still work
+	assert.True(t, ts.send(t, "/usage").Success)
+	assert.Equal(t, "💰 Your usage\n\nToday: $1.00 of $1.00 · 2.4k tokens\nThis month: $1.00 · 2.4k tokens", ts.lastMessage(t))
+}
+
+func TestProcessCommandChecksBudgetWhenTheJobStarts(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestServiceWithStores(t, &fakeQueueStore{}, &fakeJournal{}, func(config *core.ServiceConfig) {
+		config.Budget = core.UsageBudget{DailyCostUSD: 1}
+	})
+	ts.scanner.matches = []core.ProjectMatch{
+		{Name: "carlogbook", Path: "/projects/carlogbook", Score: 0.8},
+		{Name: "car-wash", Path: "/projects/car-wash", Score: 0.8},
+	}
+
+	ts.send(t, "run the car tests")
+	ts.telegram.mu.Lock()
+	buttons := ts.telegram.messages[0].Buttons
+	ts.telegram.mu.Unlock()
+	require.NotEmpty(t, buttons)
+
+	// another request uses up the budget while the user picks the project
+	require.NoError(t, ts.metrics.RecordCommandExecution(ctx, core.CommandMetrics{UserID: 42, Usage: core.Usage{CostUSD: 1}, Timestamp: time.Now()}))
+
+	require.NoError(t, ts.service.ProcessCallback(ctx, core.Callback{
+		ID: "cb", UserID: 42, ChatID: 42, MessageID: 1, Data: buttons[0][0].CallbackData,
+	}))
+	metrics := waitFor(t, ts.metrics.metrics)
+	assert.Equal(t, core.ErrorTypeBudgetExceeded, metrics.ErrorType)
+	assert.Eventually(t, func() bool {
+		return ts.lastMessage(t) == "💸 You've used up your daily cost budget ($1.00 of $1.00). New requests are declined until it resets at midnight."
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Empty(t, ts.agents["claude"].inputs)
+	assert.Equal(t, core.CommandStatusFailed, ts.journal.status(1))
+}
+
+func TestProcessCommandWarnsNearBudget(t *testing.T) {
+	ts := newTestServiceWithStores(t, &fakeQueueStore{}, &fakeJournal{}, func(config *core.ServiceConfig) {
+		config.Budget = core.UsageBudget{MonthlyTokens: 10_000}
+	})
+	ts.agents["claude"].metadata = runMetadata(0.1, 4000, 500)
+
+	ts.send(t, "run the tests in carlogbook")
+	waitFor(t, ts.agents["claude"].inputs)
+	waitFor(t, ts.metrics.metrics)
+	assert.Eventually(t, func() bool {
+		return ts.journal.status(1) == core.CommandStatusDone
+	}, 5*time.Second, 10*time.Millisecond)
+
+	ts.send(t, "now fix them")
+	waitFor(t, ts.agents["claude"].inputs)
+	waitFor(t, ts.metrics.metrics)
+	assert.Eventually(t, func() bool {
+		return ts.lastMessage(t) == "⚠️ You've used 90% of your monthly token budget (9k of 10k tokens)."
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the user is warned once
+	ts.agents["claude"].metadata = runMetadata(0.01, 400, 50)
+	ts.send(t, "and commit")
+	waitFor(t, ts.agents["claude"].inputs)
+	waitFor(t, ts.metrics.metrics)
+	assert.Eventually(t, func() bool {
+		return ts.journal.status(3) == core.CommandStatusDone
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "📁 mycar-logbook\n\nanswer from claude", ts.lastMessage(t))
+}
+
+func TestShowUsageWithoutBudget(t *testing.T) {
+	ts := newTestService(t)
+	ts.agents["claude"].metadata = runMetadata(0.0421, 32012, 450)
+
+	ts.send(t, "run the tests in carlogbook")
+	waitFor(t, ts.agents["claude"].inputs)
+	waitFor(t, ts.metrics.metrics)
+
+	result := ts.send(t, "/usage")
+	require.True(t, result.Success)
+	assert.Equal(t, "💰 Your usage\n\nToday: $0.04 · 32.5k tokens\nThis month: $0.04 · 32.5k tokens", ts.lastMessage(t))
+}
@@ -0,0 +1,150 @@
+package core
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// callbackDataMaxLength is the size limit of callback data set by Telegram
+	callbackDataMaxLength = 64
+	// callbackSignatureLength is how many bytes of the HMAC are kept in the callback data
+	callbackSignatureLength = 8
+	// callbackDataSeparator separates the fields of the callback data
+	callbackDataSeparator = ":"
+)
+
+// callbackHandler handles the verified payload of a button press and returns
+// the short notification shown to the user, if any
+type callbackHandler func(ctx context.Context, callback Callback, payload string) (string, error)
+
+// callbackDispatcher signs the callback data of the buttons sent by the assistant and routes
+// button presses to the handler of their action. Callback data looks like
+// `action:payload:expiry:signature`, so presses can't be forged or replayed after they expire.
+type callbackDispatcher struct {
+	secret   []byte
+	handlers map[string]callbackHandler
+}
+
+func newCallbackDispatcher(secret []byte) *callbackDispatcher {
+	return &callbackDispatcher{
+		secret:   secret,
+		handlers: make(map[string]callbackHandler),
+	}
+}
+
+// register sets the handler of the action, actions can't contain the separator
+func (d *callbackDispatcher) register(action string, handler callbackHandler) {
+	d.handlers[action] = handler
+}
+
+// sign builds the callback data of a button for the action and payload, valid until expiresAt
+func (d *callbackDispatcher) sign(action, payload string, expiresAt time.Time) (string, error) {
+	unsigned := strings.Join([]string{action, payload, strconv.FormatInt(expiresAt.Unix(), 36)}, callbackDataSeparator)
+	data := unsigned + callbackDataSeparator + d.signature(unsigned)
+	if len(data) > callbackDataMaxLength {
+		return "", fmt.Errorf("callback data of action %q is %d bytes long, the limit is %d", action, len(data), callbackDataMaxLength)
+	}
+
+	return data, nil
+}
+
+// verify checks the signature and expiry of the callback data and returns its action and payload
+func (d *callbackDispatcher) verify(data string) (string, string, error) {
+	parts := strings.Split(data, callbackDataSeparator)
+	if len(parts) < 4 {
+		return "", "", ErrCallbackInvalid
+	}
+
+	unsigned := strings.Join(parts[:len(parts)-1], callbackDataSeparator)
+	signature := parts[len(parts)-1]
+	if subtle.ConstantTimeCompare([]byte(signature), []byte(d.signature(unsigned))) != 1 {
+		return "", "", ErrCallbackInvalid
+	}
+
+	expiry, err := strconv.ParseInt(parts[len(parts)-2], 36, 64)
+	if err != nil {
+		return "", "", ErrCallbackInvalid
+	}
+	if time.Now().After(time.Unix(expiry, 0)) {
+		return "", "", ErrCallbackExpired
+	}
+
+	action := parts[0]
+	payload := strings.Join(parts[1:len(parts)-2], callbackDataSeparator)
+
+	return action, payload, nil
+}
+
+func (d *callbackDispatcher) signature(unsigned string) string {
+	mac := hmac.New(sha256.New, d.secret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:callbackSignatureLength])
+}
+
+// ProcessCallback verifies the callback data of the pressed button and routes it to the
+// handler of its action. The callback is always answered so the button stops loading.
+func (s *Service) ProcessCallback(ctx context.Context, callback Callback) error {
+	// a redelivered button press must not run its action twice
+	_, duplicate, err := s.updates.do(ctx, callback.UpdateID, func() (*QueryResult, error) {
+		return nil, s.processCallback(ctx, callback)
+	})
+	if duplicate {
+		slog.InfoContext(ctx, "Ignored redelivered update",
+			slog.Int64("update_id", callback.UpdateID),
+			slog.String("callback_id", callback.ID))
+	}
+	return err
+}
+
+func (s *Service) processCallback(ctx context.Context, callback Callback) error {
+	notification, err := s.dispatchCallback(ctx, callback)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to process callback",
+			slog.String("callback_id", callback.ID),
+			slog.Int64("user_id", callback.UserID),
+			slog.String("error", err.Error()))
+	}
+
+	if answerErr := s.telegram.AnswerCallbackQuery(ctx, TelegramAnswerCallbackInput{
+		CallbackQueryID: callback.ID,
+		Text:            notification,
+	}); answerErr != nil {
+		slog.WarnContext(ctx, "Failed to answer callback query",
+			slog.String("callback_id", callback.ID),
+			slog.String("error", answerErr.Error()))
+	}
+
+	return err
+}
+
+// dispatchCallback returns the notification for the user along with the error, if any
+func (s *Service) dispatchCallback(ctx context.Context, callback Callback) (string, error) {
+	if !s.userRepo.IsUserAllowed(ctx, callback.UserID) {
+		return "You are not authorized to use this assistant.", ErrUserNotAuthorized
+	}
+
+	action, payload, err := s.callbacks.verify(callback.Data)
+	switch {
+	case errors.Is(err, ErrCallbackExpired):
+		return "⌛ This button has expired, please send your message again.", err
+	case err != nil:
+		return "This button is not valid anymore.", err
+	}
+
+	handler, ok := s.callbacks.handlers[action]
+	if !ok {
+		return "This button is not supported.", fmt.Errorf("%w: unknown action %q", ErrCallbackInvalid, action)
+	}
+
+	return handler(ctx, callback, payload)
+}
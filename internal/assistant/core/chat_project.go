@@ -0,0 +1,80 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// setChatProject makes the named project the current project of the chat.
+// Without a name it shows the current project instead.
+func (s *Service) setChatProject(ctx context.Context, cmd Command, name string) (*QueryResult, error) {
+	chatID := cmd.ReplyChatID()
+
+	if name == "" {
+		message := "No current project yet. Mention a project in your message or set one with /project <name>."
+		if current := s.currentProject(ctx, chatID); current != nil {
+			message = "📁 Current project: " + current.Name
+		}
+		s.sendMessage(ctx, chatID, message)
+		return &QueryResult{Success: true, Response: message}, nil
+	}
+
+	matches, err := s.projectScanner.FindProjects(name)
+	if errors.Is(err, ErrProjectNotFound) {
+		message := fmt.Sprintf("Project %q not found. Send \"refresh projects\" if it's a new one.", name)
+		s.sendMessage(ctx, chatID, message)
+		return &QueryResult{Success: true, Response: message}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find project: %w", err)
+	}
+
+	if candidates := ambiguousMatches(matches); len(candidates) > 1 {
+		return s.askForProject(ctx, cmd, nil, candidates)
+	}
+
+	s.rememberProject(ctx, chatID, matches[0])
+	message := fmt.Sprintf("📁 Current project: %s. Messages that don't name a project will use it.", matches[0].Name)
+	s.sendMessage(ctx, chatID, message)
+
+	return &QueryResult{Success: true, Response: message}, nil
+}
+
+// currentProject returns the current project of the chat, or nil when there is none.
+// Failures only lose the context, so they're just logged.
+func (s *Service) currentProject(ctx context.Context, chatID int64) *ChatProject {
+	project, err := s.sessions.GetChatProject(ctx, chatID)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to get chat project",
+			slog.Int64("chat_id", chatID),
+			slog.String("error", err.Error()))
+		return nil
+	}
+	return project
+}
+
+// rememberProject makes the project the current project of the chat, failures are just logged
+func (s *Service) rememberProject(ctx context.Context, chatID int64, project ProjectMatch) {
+	if err := s.sessions.SaveChatProject(ctx, ChatProject{
+		ChatID:    chatID,
+		Name:      project.Name,
+		Path:      project.Path,
+		UpdatedAt: time.Now(),
+	}); err != nil {
+		slog.WarnContext(ctx, "Failed to save chat project",
+			slog.Int64("chat_id", chatID),
+			slog.String("project", project.Name),
+			slog.String("error", err.Error()))
+	}
+}
+
+// projectHeader is the first line of replies about the project
+func projectHeader(name string) string {
+	if name == "" {
+		return ""
+	}
+	return "📁 " + name + "\n\n"
+}
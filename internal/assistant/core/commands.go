@@ -0,0 +1,139 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// agentStatusTimeout is how long `/status` waits for the default agent to tell whether it's available
+const agentStatusTimeout = 5 * time.Second
+
+// slashCommandPattern matches `/command`, optionally addressed to the bot like `/command@kumote_bot`
+// in group chats, followed by the arguments of the command
+var slashCommandPattern = regexp.MustCompile(`(?s)^/([A-Za-z0-9_]{1,32})(?:@\w+)?(?:\s+(.*))?$`)
+
+// commandHandler handles a slash command given the text following it
+type commandHandler func(ctx context.Context, cmd Command, args string) (*QueryResult, error)
+
+// commandRouter routes the slash commands built in the assistant to their handlers,
+// so they're answered without invoking an agent
+type commandRouter struct {
+	handlers map[string]commandHandler
+	commands []BotCommand // in registration order, as suggested by Telegram clients
+}
+
+func newCommandRouter() *commandRouter {
+	return &commandRouter{handlers: make(map[string]commandHandler)}
+}
+
+// register sets the handler of the command, the name is lowercase without the leading slash
+func (r *commandRouter) register(name, description string, handler commandHandler) {
+	r.handlers[name] = handler
+	r.commands = append(r.commands, BotCommand{Command: name, Description: description})
+}
+
+// route returns the handler and the arguments of the command in the text,
+// or false when the text isn't a built-in command
+func (r *commandRouter) route(text string) (commandHandler, string, bool) {
+	match := slashCommandPattern.FindStringSubmatch(strings.TrimSpace(text))
+	if match == nil {
+		return nil, "", false
+	}
+
+	handler, ok := r.handlers[strings.ToLower(match[1])]
+	return handler, strings.TrimSpace(match[2]), ok
+}
+
+// registerCommands sets up the built-in commands of the service
+func (s *Service) registerCommands() {
+	s.commands.register("start", "Show the welcome message", s.showWelcome)
+	s.commands.register("help", "Show the available commands", s.showHelp)
+	s.commands.register("projects", "List the projects of the index", s.listProjects)
+	s.commands.register("project", "Show or set the current project", s.setChatProject)
+	s.commands.register("new", "Start a new conversation", s.startNewConversation)
+	s.commands.register("refresh", "Rescan the projects directory", s.refreshProjects)
+	s.commands.register("status", "Show the assistant status", s.showStatus)
+	s.commands.register("jobs", "List the recent jobs", s.listJobs)
+	s.commands.register("cancel", "Cancel a job or the pending project choice", s.cancel)
+	s.commands.register("history", "Show the latest commands", s.showHistory)
+	s.commands.register("stats", "Show the usage stats of the last hour, day, week or month", s.showStats)
+	s.commands.register("usage", "Show your agent spend of today and this month", s.showUsage)
+}
+
+// Commands returns the built-in commands, in the order they should be suggested
+func (s *Service) Commands() []BotCommand {
+	return s.commands.commands
+}
+
+// RegisterCommands publishes the built-in commands to Telegram, so clients suggest them
+func (s *Service) RegisterCommands(ctx context.Context) error {
+	if err := s.telegram.SetMyCommands(ctx, s.Commands()); err != nil {
+		return fmt.Errorf("failed to register bot commands: %w", err)
+	}
+	return nil
+}
+
+// showWelcome replies to `/start`, the first message of every chat with the bot
+func (s *Service) showWelcome(ctx context.Context, cmd Command, _ string) (*QueryResult, error) {
+	return s.reply(ctx, cmd, WelcomeMessage)
+}
+
+func (s *Service) showHelp(ctx context.Context, cmd Command, _ string) (*QueryResult, error) {
+	return s.reply(ctx, cmd, HelpMessage)
+}
+
+// listProjects replies with the projects of the index, without scanning the projects directory
+func (s *Service) listProjects(ctx context.Context, cmd Command, _ string) (*QueryResult, error) {
+	projects, err := s.projectScanner.ListProjects(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to list projects",
+			slog.Int64("chat_id", cmd.ReplyChatID()),
+			slog.String("error", err.Error()))
+		s.sendMessage(ctx, cmd.ReplyChatID(), "❌ Failed to read the project index. Send /refresh to rebuild it.")
+		return nil, fmt.Errorf("failed to list projects: %w", err)
+	}
+
+	if len(projects) == 0 {
+		return s.reply(ctx, cmd, "📂 The project index is empty. Send /refresh to scan the projects directory.")
+	}
+	return s.reply(ctx, cmd, fmt.Sprintf("📂 %d projects:\n%s", len(projects), formatProjectList(projects)))
+}
+
+// showStatus replies with the uptime, the default agent, the active jobs and the current project of the chat
+func (s *Service) showStatus(ctx context.Context, cmd Command, _ string) (*QueryResult, error) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "🟢 Kumote is running, up for %s\n", time.Since(s.startedAt).Round(time.Second))
+
+	agentName, agent := s.agents.DefaultAgent()
+	// a hanging agent CLI shouldn't keep the status from being answered
+	checkCtx, cancel := context.WithTimeout(ctx, agentStatusTimeout)
+	defer cancel()
+	agentStatus := "available"
+	if !agent.IsAvailable(checkCtx) {
+		agentStatus = "not available"
+	}
+	fmt.Fprintf(&sb, "🤖 Default agent: %s (%s)\n", agentName, agentStatus)
+	fmt.Fprintf(&sb, "📋 Active jobs: %d\n", len(s.jobs.active(cmd.ReplyChatID())))
+
+	if current := s.currentProject(ctx, cmd.ReplyChatID()); current != nil {
+		fmt.Fprintf(&sb, "📁 Current project: %s", current.Name)
+	} else {
+		sb.WriteString("📁 No current project")
+	}
+
+	return s.reply(ctx, cmd, sb.String())
+}
+
+// reply sends the message to the chat of the command and returns it as the result
+func (s *Service) reply(ctx context.Context, cmd Command, message string) (*QueryResult, error) {
+	s.sendMessage(ctx, cmd.ReplyChatID(), message)
+
+	return &QueryResult{
+		Success:  true,
+		Response: message,
+	}, nil
+}
@@ -15,6 +15,15 @@ const (
 	DefaultMaxDepth       = 3    // for project scanning
 	DefaultMinProjectSize = 1024 // bytes
 
+	// Agent sessions
+	DefaultSessionIdleTimeout = 2 * time.Hour
+
+	// Progress updates of running agents
+	DefaultProgressUpdateInterval = 3 * time.Second
+
+	// How many agent jobs run at the same time, across all projects
+	DefaultMaxConcurrentJobs = 2
+
 	// File patterns
 	ProjectIndexFileName = "projects-index.md"
 	ConfigFileName       = "scanner-config.yaml"
@@ -87,6 +96,30 @@ var (
 	WebExtensions           = []string{".html", ".css", ".scss", ".sass", ".less"}
 )
 
+// ProjectIndicators are the files and directories that mark a directory as a project
+var ProjectIndicators = []string{
+	GoModFile,
+	PackageJSONFile,
+	RequirementsTxtFile,
+	ReadmeFile,
+	GitDir,
+	DockerFile,
+	MakeFile,
+}
+
+// ExcludedDirs are never scanned for projects
+var ExcludedDirs = []string{
+	NodeModulesDir,
+	GitDir2,
+	DistDir,
+	BuildDir,
+	VendorDir,
+	TargetDir,
+	OutDir,
+	TmpDir,
+	TempDir,
+}
+
 // Technology stack detection patterns
 var TechStackPatterns = map[string][]string{
 	"go":         {"go.mod", "main.go", "*.go"},
@@ -156,17 +189,27 @@ I can help you with:
 🚀 Code execution and analysis
 
 Try these commands:
-• "list projects" - Show all projects
+• /projects - Show all projects
 • "show taqwa main.go" - Read a file
 • "git status all" - Git status for all projects
-• "help" - Show detailed help`
+• /help - Show detailed help`
 
 	HelpMessage = `🤖 Remote Work Assistant Commands
 
+**Commands:**
+• /projects - Show all available projects
+• /project [name] - Show or set the project used by messages that don't name one
+• /refresh - Update project index, same as "refresh projects"
+• /status - Show the assistant status
+• /jobs - List the recent jobs with their ID
+• /cancel [id] - Stop a running job, or cancel the pending project choice
+• /history - Show the latest commands and how they ended
+• /stats [hour|day|week|month] - Show the usage stats, of the last day by default
+• /usage - Show your agent spend of today and this month
+• /help - Show this help
+
 **Project Operations:**
-• list projects - Show all available projects
 • show [project] - Show project information
-• refresh projects - Update project index
 
 **File Operations:**
 • read/show/cat [file] - Display file content
@@ -178,7 +221,15 @@ Try these commands:
 • git log [project] - Show commit history
 • git diff [project] - Show changes
 
-**Shortcuts:**
+**Conversation:**
+• /new - Start a new conversation, follow-up messages otherwise continue the last one
+• 🎙 Voice message - Transcribed and sent once you confirm what I heard
+
+**Agents:**
+• @gemini [question] - Ask a specific agent instead of the default one
+• @claude [question] - Use Claude Code for deeper analysis
+
+**Shortcuts:** (project aliases from the index)
 • taqwa → TaqwaBoard
 • car → CarLogbook
 • jda → Junior-Dev-Acceleration
@@ -191,8 +242,8 @@ Try these commands:
 
 	ErrorMessage = `❌ Something went wrong. Please try:
 • Checking your command syntax
-• Using "help" for available commands
-• Refreshing projects with "refresh projects"
+• Using /help for available commands
+• Refreshing projects with /refresh
 
 If the problem persists, contact the administrator.`
 )
@@ -205,6 +256,35 @@ const (
 	LogLevelError = "ERROR"
 )
 
+// Error types of the command metrics, telling how a command failed
+const (
+	ErrorTypeRateLimited      = "rate_limited"
+	ErrorTypeBudgetExceeded   = "budget_exceeded"
+	ErrorTypeUnauthorized     = "unauthorized"
+	ErrorTypeProjectNotFound  = "project_not_found"
+	ErrorTypeTimeout          = "timeout"
+	ErrorTypeCancelled        = "cancelled"
+	ErrorTypeExpired          = "expired"
+	ErrorTypeShuttingDown     = "shutting_down"
+	ErrorTypeAgentUnavailable = "agent_unavailable"
+	ErrorTypeAgentFailed      = "agent_failed"
+	ErrorTypeVoiceRejected    = "voice_rejected"
+	ErrorTypeTranscription    = "transcription_failed"
+	ErrorTypeInternal         = "internal_error"
+)
+
+// Keys of the agent result metadata, set when the agent reports them
+const (
+	MetadataSubtype         = "subtype"           // how the agent run ended, e.g. "success" or "error_max_turns"
+	MetadataCostUSD         = "cost_usd"          // cost of the run in US dollars, as float64
+	MetadataDurationMs      = "duration_ms"       // wall time of the run in milliseconds, as int64
+	MetadataAPIDurationMs   = "duration_api_ms"   // time spent waiting for the model API in milliseconds, as int64
+	MetadataTurns           = "num_turns"         // number of agent turns of the run, as int
+	MetadataInputTokens     = "input_tokens"      // input tokens of the run, the ones written to the prompt cache included, as int64
+	MetadataOutputTokens    = "output_tokens"     // output tokens of the run, as int64
+	MetadataCacheReadTokens = "cache_read_tokens" // input tokens of the run read from the prompt cache, as int64
+)
+
 // Metrics periods
 const (
 	MetricsPeriodHour  = "hour"
@@ -0,0 +1,121 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// updateDedupTTL is how long a processed update is remembered, Telegram stops redelivering
+	// an update well before that
+	updateDedupTTL = time.Hour
+	// maxDedupUpdates bounds how many processed updates are remembered, the oldest ones are
+	// dropped first. Updates still being processed are never dropped.
+	maxDedupUpdates = 10000
+)
+
+// processedUpdate is the outcome of an update, shared with the redeliveries of the update
+type processedUpdate struct {
+	id        int64
+	done      chan struct{} // closed once the update is processed
+	result    *QueryResult
+	err       error
+	expiresAt time.Time
+}
+
+// updateDeduplicator remembers the Telegram updates being processed and their outcome,
+// so an update redelivered by Telegram, e.g. when the webhook answered too slowly,
+// gets the original acknowledgment instead of being processed again
+type updateDeduplicator struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	maxSize int
+	updates map[int64]*processedUpdate
+	order   []*processedUpdate // oldest first
+}
+
+func newUpdateDeduplicator(ttl time.Duration, maxSize int) *updateDeduplicator {
+	return &updateDeduplicator{
+		ttl:     ttl,
+		maxSize: maxSize,
+		updates: make(map[int64]*processedUpdate),
+	}
+}
+
+// do runs process once per update ID and returns its outcome. Redeliveries of the update wait
+// for the first delivery to finish and get the same outcome, unless it failed with an error
+// in which case the update is processed again. Updates without an ID are always processed.
+// It also reports whether the update is a redelivery.
+func (d *updateDeduplicator) do(ctx context.Context, updateID int64, process func() (*QueryResult, error)) (*QueryResult, bool, error) {
+	if updateID == 0 {
+		result, err := process()
+		return result, false, err
+	}
+
+	d.mu.Lock()
+	d.dropExpired(time.Now())
+	if update, ok := d.updates[updateID]; ok {
+		d.mu.Unlock()
+		select {
+		case <-update.done:
+			return update.result, true, update.err
+		case <-ctx.Done():
+			return nil, true, ctx.Err()
+		}
+	}
+
+	update := &processedUpdate{id: updateID, done: make(chan struct{})}
+	d.updates[updateID] = update
+	d.order = append(d.order, update)
+	if len(d.order) > d.maxSize {
+		d.dropOldestProcessed()
+	}
+	d.mu.Unlock()
+
+	result, err := process()
+
+	d.mu.Lock()
+	update.result, update.err = result, err
+	update.expiresAt = time.Now().Add(d.ttl)
+	if err != nil {
+		// let Telegram's retry process the update again
+		d.forget(update)
+	}
+	d.mu.Unlock()
+	close(update.done)
+
+	return result, false, err
+}
+
+// forget drops the update unless it was replaced by a later delivery, the lock must be held
+func (d *updateDeduplicator) forget(update *processedUpdate) {
+	if d.updates[update.id] == update {
+		delete(d.updates, update.id)
+	}
+}
+
+// dropOldestProcessed forgets the oldest update that finished processing, updates still
+// being processed are kept so their redeliveries keep waiting for them. The lock must be held.
+func (d *updateDeduplicator) dropOldestProcessed() {
+	for i, update := range d.order {
+		if d.updates[update.id] == update && update.expiresAt.IsZero() {
+			continue
+		}
+		d.forget(update)
+		d.order = append(d.order[:i], d.order[i+1:]...)
+		return
+	}
+}
+
+// dropExpired forgets the oldest processed updates once they expired, the lock must be held
+func (d *updateDeduplicator) dropExpired(now time.Time) {
+	for len(d.order) > 0 {
+		oldest := d.order[0]
+		if d.updates[oldest.id] == oldest && (oldest.expiresAt.IsZero() || now.Before(oldest.expiresAt)) {
+			return
+		}
+		d.forget(oldest)
+		d.order = d.order[1:]
+	}
+}
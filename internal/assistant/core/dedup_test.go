@@ -0,0 +1,85 @@
+package core_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/izzddalfk/kumote/internal/assistant/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessCommandIgnoresRedeliveredUpdates(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t)
+
+	cmd := core.Command{
+		ID: "7", UpdateID: 1001, UserID: 42, ChatID: 42, Text: "run the tests in carlogbook", Timestamp: time.Now(),
+	}
+	first, err := ts.service.ProcessCommand(ctx, cmd)
+	require.NoError(t, err)
+	waitFor(t, ts.agents["claude"].inputs)
+	waitFor(t, ts.metrics.metrics)
+
+	// Telegram redelivers the update when the webhook answered too slowly
+	retried, err := ts.service.ProcessCommand(ctx, cmd)
+	require.NoError(t, err)
+	assert.Equal(t, first, retried, "the redelivery should get the original acknowledgment")
+	assert.Empty(t, ts.agents["claude"].inputs, "the agent should run once")
+
+	// redeliveries of built-in commands aren't answered twice
+	status := core.Command{ID: "8", UpdateID: 1002, UserID: 42, ChatID: 42, Text: "/status", Timestamp: time.Now()}
+	_, err = ts.service.ProcessCommand(ctx, status)
+	require.NoError(t, err)
+	ts.telegram.mu.Lock()
+	sent := len(ts.telegram.messages)
+	ts.telegram.mu.Unlock()
+	_, err = ts.service.ProcessCommand(ctx, status)
+	require.NoError(t, err)
+	ts.telegram.mu.Lock()
+	assert.Len(t, ts.telegram.messages, sent)
+	ts.telegram.mu.Unlock()
+
+	// commands without an update ID, like retries of interrupted commands, are always processed
+	cmd.UpdateID = 0
+	for range 2 {
+		_, err = ts.service.ProcessCommand(ctx, cmd)
+		require.NoError(t, err)
+		waitFor(t, ts.agents["claude"].inputs)
+		waitFor(t, ts.metrics.metrics)
+	}
+}
+
+func TestProcessCallbackIgnoresRedeliveredUpdates(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t)
+
+	callback := core.Callback{ID: "cb", UpdateID: 2001, UserID: 7, ChatID: 7, MessageID: 1, Data: "project:abc.0:x:sig"}
+	assert.ErrorIs(t, ts.service.ProcessCallback(ctx, callback), core.ErrUserNotAuthorized)
+
+	// failed updates are processed again
+	assert.ErrorIs(t, ts.service.ProcessCallback(ctx, callback), core.ErrUserNotAuthorized)
+	ts.telegram.mu.Lock()
+	assert.Len(t, ts.telegram.answers, 2)
+	ts.telegram.mu.Unlock()
+
+	ts.scanner.matches = []core.ProjectMatch{
+		{Name: "carlogbook", Path: "/projects/carlogbook", Score: 0.8},
+		{Name: "car-wash", Path: "/projects/car-wash", Score: 0.8},
+	}
+	ts.send(t, "run the car tests")
+	ts.telegram.mu.Lock()
+	buttons := ts.telegram.messages[len(ts.telegram.messages)-1].Buttons
+	ts.telegram.mu.Unlock()
+	require.Len(t, buttons, 2)
+
+	// a redelivered button press gets the original outcome instead of an expired choice
+	callback = core.Callback{ID: "cb", UpdateID: 2002, UserID: 42, ChatID: 42, MessageID: 2, Data: buttons[0][0].CallbackData}
+	require.NoError(t, ts.service.ProcessCallback(ctx, callback))
+	require.NoError(t, ts.service.ProcessCallback(ctx, callback))
+	input := waitFor(t, ts.agents["claude"].inputs)
+	assert.Equal(t, "/projects/carlogbook", input.ExecutionContext.WorkingDir)
+	waitFor(t, ts.metrics.metrics)
+	assert.Empty(t, ts.agents["claude"].inputs, "the agent should run once")
+}
@@ -13,6 +13,7 @@ ErrUserNotFound      = errors.New("user not found")
 ErrUserNotAuthorized = errors.New("user not authorized")
 ErrUserBlocked       = errors.New("user is blocked")
 ErrRateLimitExceeded = errors.New("rate limit exceeded")
+ErrBudgetExceeded    = errors.New("usage budget exceeded")
 
 // Command related errors
 ErrInvalidCommand  = errors.New("invalid command")
@@ -21,8 +22,34 @@ ErrCommandFailed   = errors.New("command execution failed")
 ErrEmptyQuery      = errors.New("empty query provided")
 ErrCommandNotFound = errors.New("command not found")
 
+// Agent related errors
+ErrAgentExited        = errors.New("agent exited with an error")
+ErrAgentOutputInvalid = errors.New("agent output is invalid")
+
+// Voice related errors
+ErrVoiceUnsupported    = errors.New("voice message is not supported")
+ErrTranscriptionFailed = errors.New("voice transcription failed")
+
+// Callback related errors
+ErrCallbackInvalid = errors.New("invalid callback data")
+ErrCallbackExpired = errors.New("callback data expired")
+
+// Project related errors
+ErrProjectNotFound      = errors.New("project not found")
+ErrProjectChoiceExpired = errors.New("project choice expired")
+
+// Job related errors
+ErrJobNotFound  = errors.New("job not found")
+ErrJobCancelled = errors.New("job cancelled by the user")
+ErrShuttingDown = errors.New("assistant is shutting down")
+
+// Metrics related errors
+ErrInvalidMetricsPeriod = errors.New("invalid metrics period")
+
 // External service errors
-ErrClaudeCodeUnavailable = errors.New("claude code cli is unavailable")
+ErrClaudeCodeUnavailable  = errors.New("claude code cli is unavailable")
+ErrGeminiCLIUnavailable   = errors.New("gemini cli is unavailable")
+ErrTranscriberUnavailable = errors.New("transcriber is unavailable")
 )
 
 // Error types for better error handling
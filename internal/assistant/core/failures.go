@@ -0,0 +1,81 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// failureIDLength is the number of random bytes of a failure ID, shown in hex
+const failureIDLength = 3
+
+// newFailureID returns a short ID shown to the user along with the failure and logged with
+// its error, so a failure reported by a user can be found in the logs
+func newFailureID() string {
+	b := make([]byte, failureIDLength)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// describeAgentFailure tells the user why the agent failed, from the sentinel errors the failure wraps
+func describeAgentFailure(err error, timeout time.Duration) string {
+	switch {
+	case errors.Is(err, ErrCommandTimeout):
+		return fmt.Sprintf("⌛ The agent didn't finish within %d minutes, so it was stopped. Try splitting the request into smaller ones.",
+			int(timeout.Minutes()))
+	case errors.Is(err, ErrClaudeCodeUnavailable), errors.Is(err, ErrGeminiCLIUnavailable):
+		return "🔌 The agent isn't available, its CLI couldn't be started on the server."
+	case errors.Is(err, ErrAgentExited):
+		return "💥 The agent stopped with an error before answering."
+	case errors.Is(err, ErrAgentOutputInvalid):
+		return "🧩 The agent answered, but its output couldn't be read."
+	default:
+		return "❌ Something went wrong while running your request."
+	}
+}
+
+// sendFailure tells the user that the job failed, along with a new failure ID logged with
+// the failure and a button to retry the command when it's journaled
+func (s *Service) sendFailure(ctx context.Context, job agentJob, failure error, message string) {
+	failureID := newFailureID()
+	slog.ErrorContext(ctx, "Reporting agent failure to the user",
+		slog.String("command_id", job.cmd.ID),
+		slog.String("job_id", job.id),
+		slog.String("failure_id", failureID),
+		slog.String("agent", job.agentName),
+		slog.String("error", failure.Error()))
+
+	if _, err := s.telegram.SendTextMessage(ctx, TelegramTextMessageInput{
+		ChatID:  job.cmd.ReplyChatID(),
+		Message: fmt.Sprintf("%s%s\n\nFailure ID: %s", projectHeader(job.projectName), message, failureID),
+		Buttons: s.retryButtons(ctx, job.journalID),
+	}); err != nil {
+		slog.ErrorContext(ctx, "Failed to send Telegram message",
+			slog.String("command_id", job.cmd.ID),
+			slog.String("failure_id", failureID),
+			slog.String("error", err.Error()))
+	}
+}
+
+// retryButtons returns the retry button of the journaled command, or none when the command
+// isn't journaled or the button can't be signed
+func (s *Service) retryButtons(ctx context.Context, journalID int64) [][]InlineButton {
+	if journalID == 0 {
+		return nil
+	}
+
+	callbackData, err := s.callbacks.sign(retryCallbackAction, strconv.FormatInt(journalID, 10), time.Now().Add(retryTTL))
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to sign retry button",
+			slog.Int64("journal_id", journalID),
+			slog.String("error", err.Error()))
+		return nil
+	}
+
+	return [][]InlineButton{{{Text: "🔁 Retry", CallbackData: callbackData}}}
+}
@@ -0,0 +1,168 @@
+package core_test
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/izzddalfk/kumote/internal/assistant/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessCommandReportsAgentFailures(t *testing.T) {
+	testCases := []struct {
+		name            string
+		err             error
+		failure         string
+		expectedMessage string
+		expectedType    string
+	}{
+		{
+			name:            "agent CLI missing",
+			err:             fmt.Errorf("failed to execute claude command: %w", core.ErrClaudeCodeUnavailable),
+			expectedMessage: "🔌 The agent isn't available, its CLI couldn't be started on the server.",
+			expectedType:    core.ErrorTypeAgentUnavailable,
+		},
+		{
+			name:            "non-zero exit",
+			err:             fmt.Errorf("failed to execute claude command: %w: exit status 1", core.ErrAgentExited),
+			expectedMessage: "💥 The agent stopped with an error before answering.",
+			expectedType:    core.ErrorTypeAgentFailed,
+		},
+		{
+			name:            "unreadable output",
+			err:             fmt.Errorf("failed to read claude output: %w", core.ErrAgentOutputInvalid),
+			expectedMessage: "🧩 The agent answered, but its output couldn't be read.",
+			expectedType:    core.ErrorTypeAgentFailed,
+		},
+		{
+			name:            "unexpected error",
+			err:             fmt.Errorf("broken pipe"),
+			expectedMessage: "❌ Something went wrong while running your request.",
+			expectedType:    core.ErrorTypeAgentFailed,
+		},
+		{
+			name:            "failure reported by the agent",
+			failure:         "usage limit reached",
+			expectedMessage: "❌ The agent couldn't complete your request: usage limit reached",
+			expectedType:    core.ErrorTypeAgentFailed,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := newTestService(t)
+			ts.agents["claude"].err = tc.err
+			ts.agents["claude"].failure = tc.failure
+
+			ts.send(t, "run the tests in carlogbook")
+			waitFor(t, ts.agents["claude"].inputs)
+			metrics := waitFor(t, ts.metrics.metrics)
+			assert.False(t, metrics.Success)
+			assert.Equal(t, tc.expectedType, metrics.ErrorType)
+
+			assert.Eventually(t, func() bool {
+				return ts.journal.status(1) == core.CommandStatusFailed
+			}, 5*time.Second, 10*time.Millisecond)
+			assert.Contains(t, ts.lastEdit(t), "❌ Failed")
+
+			ts.telegram.mu.Lock()
+			notice := ts.telegram.messages[len(ts.telegram.messages)-1]
+			ts.telegram.mu.Unlock()
+			assert.Equal(t, int64(42), notice.ChatID)
+			assert.Regexp(t, "^"+regexp.QuoteMeta("📁 mycar-logbook\n\n"+tc.expectedMessage)+"\n\nFailure ID: [0-9a-f]{6}$", notice.Message)
+			require.Len(t, notice.Buttons, 1)
+			assert.Equal(t, "🔁 Retry", notice.Buttons[0][0].Text)
+		})
+	}
+}
+
+func TestRetryFailedCommand(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t)
+	ts.agents["claude"].err = fmt.Errorf("failed to execute claude command: %w", core.ErrAgentExited)
+
+	ts.send(t, "run the tests in carlogbook")
+	waitFor(t, ts.agents["claude"].inputs)
+	waitFor(t, ts.metrics.metrics)
+	assert.Eventually(t, func() bool {
+		return ts.journal.status(1) == core.CommandStatusFailed
+	}, 5*time.Second, 10*time.Millisecond)
+
+	ts.telegram.mu.Lock()
+	notice := ts.telegram.messages[len(ts.telegram.messages)-1]
+	ts.telegram.mu.Unlock()
+	require.Len(t, notice.Buttons, 1)
+
+	// the agent works again
+	ts.agents["claude"].err = nil
+	require.NoError(t, ts.service.ProcessCallback(ctx, core.Callback{
+		ID: "cb", UserID: 42, ChatID: 42, MessageID: 3, Data: notice.Buttons[0][0].CallbackData,
+	}))
+	input := waitFor(t, ts.agents["claude"].inputs)
+	assert.Equal(t, "run the tests in carlogbook", input.Prompt)
+	assert.True(t, waitFor(t, ts.metrics.metrics).Success)
+	assert.Eventually(t, func() bool {
+		return ts.journal.status(2) == core.CommandStatusDone
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestProcessCommandDoesNotReportCancelledJobsAsFailures(t *testing.T) {
+	ts := newTestService(t)
+	ts.agents["claude"].blocking = true
+
+	ts.send(t, "run the tests in carlogbook")
+	waitFor(t, ts.agents["claude"].inputs)
+	ts.send(t, "/cancel")
+	waitFor(t, ts.metrics.metrics)
+
+	ts.telegram.mu.Lock()
+	defer ts.telegram.mu.Unlock()
+	for _, message := range ts.telegram.messages {
+		assert.NotContains(t, message.Message, "Failure ID")
+	}
+}
+
+func TestProcessCommandKeepsSessionOfFailedRuns(t *testing.T) {
+	ts := newTestService(t)
+	ts.agents["claude"].sessionID = "session-1"
+	ts.agents["claude"].failure = "the agent reached the maximum number of turns (10) before finishing"
+
+	ts.send(t, "refactor carlogbook")
+	waitFor(t, ts.agents["claude"].inputs)
+	waitFor(t, ts.metrics.metrics)
+
+	// "continue" picks up where the agent stopped
+	ts.agents["claude"].failure = ""
+	ts.send(t, "continue")
+	input := waitFor(t, ts.agents["claude"].inputs)
+	require.NotNil(t, input.SessionID)
+	assert.Equal(t, "session-1", *input.SessionID)
+	waitFor(t, ts.metrics.metrics)
+}
+
+func TestProcessCommandForgetsOnlyTheSessionOfTheFailedProject(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t)
+	for _, project := range []string{ts.scanner.path, "/home/users/projects/kumote"} {
+		require.NoError(t, ts.sessions.SaveSession(ctx, core.Session{
+			ChatID: 42, Project: project, AgentName: "claude", SessionID: "session-1", UpdatedAt: time.Now(),
+		}))
+	}
+	ts.agents["claude"].err = fmt.Errorf("failed to execute claude command: %w", core.ErrAgentExited)
+
+	ts.send(t, "run the tests in carlogbook")
+	input := waitFor(t, ts.agents["claude"].inputs)
+	require.NotNil(t, input.SessionID, "the stored session should be resumed")
+	waitFor(t, ts.metrics.metrics)
+
+	session, err := ts.sessions.GetSession(ctx, 42, ts.scanner.path)
+	require.NoError(t, err)
+	assert.Nil(t, session, "the session of the failed run should be forgotten")
+	session, err = ts.sessions.GetSession(ctx, 42, "/home/users/projects/kumote")
+	require.NoError(t, err)
+	assert.NotNil(t, session, "the sessions of other projects should be kept")
+}
@@ -0,0 +1,285 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxFinishedJobs is how many finished jobs are kept for `/jobs`
+	maxFinishedJobs = 20
+	// maxJobPromptLength is how many characters of the prompt are shown by `/jobs`
+	maxJobPromptLength = 40
+	// jobCancelGracePeriod is how long the shutdown waits for cancelled jobs to stop
+	jobCancelGracePeriod = 10 * time.Second
+)
+
+// trackedJob is a job along with the function cancelling its context
+type trackedJob struct {
+	job    Job
+	cancel context.CancelCauseFunc
+}
+
+// jobManager keeps track of the commands run by agents in background, so they can be
+// listed and cancelled, and waits for them on shutdown. Job IDs are short sequential
+// numbers that are easy to type in `/cancel <id>`.
+type jobManager struct {
+	mu      sync.Mutex
+	lastID  int
+	jobs    map[string]*trackedJob
+	closing bool
+	running sync.WaitGroup
+}
+
+func newJobManager() *jobManager {
+	return &jobManager{jobs: make(map[string]*trackedJob)}
+}
+
+// add registers the job as queued and returns it with its ID.
+// It fails with ErrShuttingDown once the shutdown started.
+func (m *jobManager) add(job Job, cancel context.CancelCauseFunc) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closing {
+		return Job{}, ErrShuttingDown
+	}
+
+	m.lastID++
+	job.ID = strconv.Itoa(m.lastID)
+	job.Status = JobStatusQueued
+	job.CreatedAt = time.Now()
+	m.jobs[job.ID] = &trackedJob{job: job, cancel: cancel}
+	m.running.Add(1)
+	m.pruneFinished()
+
+	return job, nil
+}
+
+// setStatus updates the status of the job, final statuses can't be changed anymore
+func (m *jobManager) setStatus(id string, status JobStatus) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tracked, ok := m.jobs[id]
+	if !ok || tracked.job.Status.IsFinal() {
+		return
+	}
+
+	tracked.job.Status = status
+	switch {
+	case status == JobStatusRunning:
+		tracked.job.StartedAt = time.Now()
+	case status.IsFinal():
+		tracked.job.FinishedAt = time.Now()
+		m.running.Done()
+	}
+}
+
+// cancel cancels the job of the chat with ErrJobCancelled as the cause.
+// Jobs already over are returned as they are.
+func (m *jobManager) cancel(id string, chatID int64) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tracked, ok := m.jobs[id]
+	if !ok || tracked.job.ChatID != chatID {
+		return Job{}, ErrJobNotFound
+	}
+	if !tracked.job.Status.IsFinal() {
+		tracked.cancel(ErrJobCancelled)
+	}
+
+	return tracked.job, nil
+}
+
+// list returns the jobs of the chat, newest first
+func (m *jobManager) list(chatID int64) []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var jobs []Job
+	for _, tracked := range m.jobs {
+		if tracked.job.ChatID == chatID {
+			jobs = append(jobs, tracked.job)
+		}
+	}
+	sortJobsNewestFirst(jobs)
+
+	return jobs
+}
+
+// active returns the jobs of the chat that are not over yet, newest first
+func (m *jobManager) active(chatID int64) []Job {
+	var jobs []Job
+	for _, job := range m.list(chatID) {
+		if !job.Status.IsFinal() {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+// shutdown stops accepting jobs and waits for the running ones to finish. Jobs still
+// running when the context is done are cancelled and given a short time to stop, it only
+// fails when they don't stop in time.
+func (m *jobManager) shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	m.closing = true
+	m.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		m.running.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+	}
+
+	m.mu.Lock()
+	cancelled := 0
+	for _, tracked := range m.jobs {
+		if !tracked.job.Status.IsFinal() {
+			tracked.cancel(ErrShuttingDown)
+			cancelled++
+		}
+	}
+	m.mu.Unlock()
+
+	slog.WarnContext(ctx, "Cancelled jobs still running after the shutdown timeout", slog.Int("jobs", cancelled))
+
+	select {
+	case <-drained:
+		return nil
+	case <-time.After(jobCancelGracePeriod):
+		return fmt.Errorf("%d cancelled jobs still running after the grace period", cancelled)
+	}
+}
+
+// pruneFinished drops the oldest finished jobs beyond maxFinishedJobs, the lock must be held
+func (m *jobManager) pruneFinished() {
+	var finished []Job
+	for _, tracked := range m.jobs {
+		if tracked.job.Status.IsFinal() {
+			finished = append(finished, tracked.job)
+		}
+	}
+	if len(finished) <= maxFinishedJobs {
+		return
+	}
+
+	sortJobsNewestFirst(finished)
+	for _, job := range finished[maxFinishedJobs:] {
+		delete(m.jobs, job.ID)
+	}
+}
+
+func sortJobsNewestFirst(jobs []Job) {
+	sort.Slice(jobs, func(i, j int) bool {
+		// IDs are sequential, compare them numerically
+		a, _ := strconv.Atoi(jobs[i].ID)
+		b, _ := strconv.Atoi(jobs[j].ID)
+		return a > b
+	})
+}
+
+// listJobs replies to `/jobs` with the recent jobs of the chat
+func (s *Service) listJobs(ctx context.Context, cmd Command, _ string) (*QueryResult, error) {
+	jobs := s.jobs.list(cmd.ReplyChatID())
+	if len(jobs) == 0 {
+		return s.reply(ctx, cmd, "No jobs yet.")
+	}
+
+	var sb strings.Builder
+	sb.WriteString("📋 Recent jobs:\n")
+	for _, job := range jobs {
+		sb.WriteString("\n" + formatJob(job))
+	}
+	if len(s.jobs.active(cmd.ReplyChatID())) > 0 {
+		sb.WriteString("\n\nSend /cancel <id> to stop a job.")
+	}
+
+	return s.reply(ctx, cmd, sb.String())
+}
+
+// cancel replies to `/cancel [id]`. Without an ID it cancels the pending project choice,
+// or the only active job of the chat.
+func (s *Service) cancel(ctx context.Context, cmd Command, args string) (*QueryResult, error) {
+	chatID := cmd.ReplyChatID()
+
+	id := strings.TrimPrefix(args, "#")
+	if id == "" {
+		if cancelled := s.projectChoices.cancel(chatID); len(cancelled) > 0 {
+			for _, choice := range cancelled {
+				s.dropProjectChoice(ctx, choice, ErrJobCancelled)
+			}
+			return s.reply(ctx, cmd, "🛑 Cancelled the pending project choice.")
+		}
+
+		active := s.jobs.active(chatID)
+		switch len(active) {
+		case 0:
+			return s.reply(ctx, cmd, "Nothing to cancel.")
+		case 1:
+			id = active[0].ID
+		default:
+			return s.reply(ctx, cmd, "More than one job is running, send /cancel <id> with one of the IDs shown by /jobs.")
+		}
+	}
+
+	job, err := s.jobs.cancel(id, chatID)
+	if err != nil {
+		return s.reply(ctx, cmd, fmt.Sprintf("Job %s not found, send /jobs to see the recent jobs.", id))
+	}
+	if job.Status.IsFinal() {
+		return s.reply(ctx, cmd, fmt.Sprintf("Job %s is already %s.", job.ID, job.Status))
+	}
+
+	slog.InfoContext(ctx, "Job cancelled by the user",
+		slog.String("job_id", job.ID),
+		slog.Int64("user_id", cmd.UserID))
+
+	return s.reply(ctx, cmd, fmt.Sprintf("🛑 Cancelling job %s…", job.ID))
+}
+
+// Shutdown stops accepting new jobs and waits for the running ones until the context is done,
+// then cancels the jobs still running. It fails when the cancelled jobs don't stop in time.
+// Queued jobs don't start anymore, they're resumed after the restart.
+func (s *Service) Shutdown(ctx context.Context) error {
+	s.scheduler.close()
+	return s.jobs.shutdown(ctx)
+}
+
+// formatJob describes the job in one line, e.g. "#3 🏃 running for 1m5s · carlogbook · claude · run the tests"
+func formatJob(job Job) string {
+	var status string
+	switch job.Status {
+	case JobStatusQueued:
+		status = "🕒 queued"
+	case JobStatusRunning:
+		status = fmt.Sprintf("🏃 running for %s", time.Since(job.StartedAt).Round(time.Second))
+	case JobStatusDone:
+		status = fmt.Sprintf("✅ done in %s", job.FinishedAt.Sub(job.StartedAt).Round(time.Second))
+	case JobStatusFailed:
+		status = "❌ failed"
+	case JobStatusCancelled:
+		status = "🛑 cancelled"
+	}
+
+	prompt := []rune(strings.Join(strings.Fields(job.Prompt), " "))
+	if len(prompt) > maxJobPromptLength {
+		prompt = append(prompt[:maxJobPromptLength], '…')
+	}
+
+	return fmt.Sprintf("#%s %s · %s · %s · %s", job.ID, status, job.Project, job.AgentName, string(prompt))
+}
@@ -0,0 +1,122 @@
+package core_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/izzddalfk/kumote/internal/assistant/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lastMessage returns the last message sent to the chat
+func (ts *testService) lastMessage(t *testing.T) string {
+	t.Helper()
+	ts.telegram.mu.Lock()
+	defer ts.telegram.mu.Unlock()
+	require.NotEmpty(t, ts.telegram.messages)
+	return ts.telegram.messages[len(ts.telegram.messages)-1].Message
+}
+
+// lastEdit returns the last edit of a message, e.g. the final status of the progress message
+func (ts *testService) lastEdit(t *testing.T) string {
+	t.Helper()
+	ts.telegram.mu.Lock()
+	defer ts.telegram.mu.Unlock()
+	if len(ts.telegram.edits) == 0 {
+		return ""
+	}
+	return ts.telegram.edits[len(ts.telegram.edits)-1].Message
+}
+
+func (ts *testService) send(t *testing.T, text string) *core.QueryResult {
+	t.Helper()
+	result, err := ts.service.ProcessCommand(context.Background(), core.Command{
+		ID: "1", UserID: 42, ChatID: 42, Text: text, Timestamp: time.Now(),
+	})
+	require.NoError(t, err)
+	return result
+}
+
+func TestProcessCommandCancelJob(t *testing.T) {
+	ts := newTestService(t)
+	ts.agents["claude"].blocking = true
+
+	ts.send(t, "run the tests in carlogbook")
+	waitFor(t, ts.agents["claude"].inputs)
+
+	ts.send(t, "/jobs")
+	assert.Contains(t, ts.lastMessage(t), "#1 🏃 running")
+	assert.Contains(t, ts.lastMessage(t), "mycar-logbook · claude · run the tests in carlogbook")
+
+	// jobs of other chats can't be cancelled
+	result, err := ts.service.ProcessCommand(context.Background(), core.Command{
+		ID: "2", UserID: 42, ChatID: 7, Text: "/cancel 1", Timestamp: time.Now(),
+	})
+	require.NoError(t, err)
+	assert.Contains(t, result.Response, "not found")
+
+	ts.send(t, "/cancel 1")
+	assert.Equal(t, "🛑 Cancelling job 1…", ts.lastMessage(t))
+
+	metrics := waitFor(t, ts.metrics.metrics)
+	assert.False(t, metrics.Success)
+	assert.Eventually(t, func() bool {
+		ts.send(t, "/jobs")
+		return strings.Contains(ts.lastMessage(t), "#1 🛑 cancelled")
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Contains(t, ts.lastEdit(t), "🛑 Cancelled")
+
+	ts.send(t, "/cancel 1")
+	assert.Equal(t, "Job 1 is already cancelled.", ts.lastMessage(t))
+}
+
+func TestProcessCommandCancelOnlyActiveJob(t *testing.T) {
+	ts := newTestService(t)
+	ts.agents["claude"].blocking = true
+
+	ts.send(t, "/cancel")
+	assert.Equal(t, "Nothing to cancel.", ts.lastMessage(t))
+
+	ts.send(t, "run the tests in carlogbook")
+	waitFor(t, ts.agents["claude"].inputs)
+
+	ts.send(t, "/cancel")
+	assert.Equal(t, "🛑 Cancelling job 1…", ts.lastMessage(t))
+	waitFor(t, ts.metrics.metrics)
+}
+
+func TestServiceShutdown(t *testing.T) {
+	t.Run("Waits for running jobs", func(t *testing.T) {
+		ts := newTestService(t)
+
+		ts.send(t, "run the tests in carlogbook")
+		waitFor(t, ts.agents["claude"].inputs)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		require.NoError(t, ts.service.Shutdown(ctx))
+		assert.Contains(t, ts.lastMessage(t), "answer from claude", "the job should finish before the shutdown")
+	})
+
+	t.Run("Cancels jobs still running after the timeout", func(t *testing.T) {
+		ts := newTestService(t)
+		ts.agents["claude"].blocking = true
+
+		ts.send(t, "run the tests in carlogbook")
+		waitFor(t, ts.agents["claude"].inputs)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		assert.NoError(t, ts.service.Shutdown(ctx), "the cancelled job stopped in time")
+		assert.Contains(t, ts.lastEdit(t), "Cancelled on shutdown")
+
+		// new requests are refused once the shutdown started
+		result := ts.send(t, "run the tests in carlogbook")
+		assert.False(t, result.Success)
+		assert.Contains(t, ts.lastMessage(t), "shutting down")
+		assert.Empty(t, ts.agents["claude"].inputs)
+	})
+}
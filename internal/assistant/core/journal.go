@@ -0,0 +1,202 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxHistoryEntries is how many commands are shown by `/history`
+	maxHistoryEntries = 10
+	// retryCallbackAction is the callback action of the retry button of interrupted and failed commands
+	retryCallbackAction = "retry"
+	// retryTTL is how long the retry button of a command works
+	retryTTL = 24 * time.Hour
+)
+
+// recordCommand journals the accepted command and returns the ID of its entry,
+// or 0 when it can't be journaled. The command is still processed then.
+func (s *Service) recordCommand(ctx context.Context, cmd Command) int64 {
+	now := time.Now()
+	id, err := s.journal.RecordCommand(ctx, JournalEntry{
+		CommandID: cmd.ID,
+		UserID:    cmd.UserID,
+		ChatID:    cmd.ReplyChatID(),
+		Text:      cmd.Text,
+		Status:    CommandStatusAccepted,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to journal command",
+			slog.String("command_id", cmd.ID),
+			slog.String("error", err.Error()))
+		return 0
+	}
+
+	return id
+}
+
+// updateCommand sets the status of the journal entry, failures are just logged
+func (s *Service) updateCommand(ctx context.Context, id int64, entry JournalEntry) {
+	if id == 0 {
+		return
+	}
+
+	entry.ID = id
+	entry.UpdatedAt = time.Now()
+	if err := s.journal.UpdateCommand(ctx, entry); err != nil {
+		slog.WarnContext(ctx, "Failed to update journaled command",
+			slog.Int64("journal_id", id),
+			slog.String("status", string(entry.Status)),
+			slog.String("error", err.Error()))
+	}
+}
+
+// completeCommand marks the journal entry of a command answered without an agent as done,
+// or failed with the error
+func (s *Service) completeCommand(ctx context.Context, id int64, err error) {
+	if err != nil {
+		s.updateCommand(ctx, id, JournalEntry{Status: CommandStatusFailed, Error: err.Error()})
+		return
+	}
+	s.updateCommand(ctx, id, JournalEntry{Status: CommandStatusDone})
+}
+
+// RecoverInterruptedCommands marks the commands left unfinished by the previous process as
+// interrupted, and offers their users to retry them. Queued commands aren't interrupted,
+// they're resumed by ResumeQueuedJobs.
+func (s *Service) RecoverInterruptedCommands(ctx context.Context) error {
+	entries, err := s.journal.InterruptCommands(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to interrupt unfinished commands: %w", err)
+	}
+
+	for _, entry := range entries {
+		buttons := s.retryButtons(ctx, entry.ID)
+		if buttons == nil {
+			continue
+		}
+
+		if _, err := s.telegram.SendTextMessage(ctx, TelegramTextMessageInput{
+			ChatID:  entry.ChatID,
+			Message: fmt.Sprintf("⚠️ Kumote restarted before finishing your request:\n\n%s", entry.Text),
+			Buttons: buttons,
+		}); err != nil {
+			slog.ErrorContext(ctx, "Failed to send Telegram message",
+				slog.Int64("chat_id", entry.ChatID),
+				slog.String("error", err.Error()))
+		}
+	}
+
+	if len(entries) > 0 {
+		slog.InfoContext(ctx, "Recovered interrupted commands", slog.Int("commands", len(entries)))
+	}
+
+	return nil
+}
+
+// handleRetry processes again the interrupted or failed command of the retry button.
+// The payload is the ID of its journal entry.
+func (s *Service) handleRetry(ctx context.Context, callback Callback, payload string) (string, error) {
+	id, err := strconv.ParseInt(payload, 10, 64)
+	if err != nil {
+		return "This button is not valid anymore.", fmt.Errorf("%w: %s", ErrCallbackInvalid, err.Error())
+	}
+
+	entry, err := s.journal.GetCommand(ctx, id)
+	if err != nil {
+		return "❌ Failed to retry the request.", fmt.Errorf("failed to get journaled command: %w", err)
+	}
+	if entry == nil || entry.ChatID != callback.ChatID || entry.UserID != callback.UserID {
+		return "This request can't be retried anymore.", ErrCallbackExpired
+	}
+
+	// drop the button so the request isn't retried twice
+	if err := s.telegram.EditTextMessage(ctx, TelegramEditMessageInput{
+		ChatID:    callback.ChatID,
+		MessageID: callback.MessageID,
+		Message:   fmt.Sprintf("🔁 Retrying your request:\n\n%s", entry.Text),
+	}); err != nil {
+		slog.WarnContext(ctx, "Failed to edit retry message",
+			slog.Int64("chat_id", callback.ChatID),
+			slog.String("error", err.Error()))
+	}
+
+	// the retry is a new command, journaled on its own
+	if _, err := s.ProcessCommand(ctx, Command{
+		ID:        fmt.Sprintf("retry-%d-%d", entry.ID, time.Now().UnixNano()),
+		UserID:    callback.UserID,
+		ChatID:    callback.ChatID,
+		Text:      entry.Text,
+		Timestamp: time.Now(),
+	}); err != nil {
+		return "❌ Failed to retry the request.", err
+	}
+
+	return "🔁 Retrying", nil
+}
+
+// showHistory replies to `/history` with the latest commands of the chat
+func (s *Service) showHistory(ctx context.Context, cmd Command, _ string) (*QueryResult, error) {
+	entries, err := s.journal.ListCommands(ctx, cmd.ReplyChatID(), maxHistoryEntries)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to list journaled commands",
+			slog.Int64("chat_id", cmd.ReplyChatID()),
+			slog.String("error", err.Error()))
+		return s.reply(ctx, cmd, "❌ Failed to load the command history.")
+	}
+	if len(entries) == 0 {
+		return s.reply(ctx, cmd, "No commands yet.")
+	}
+
+	var sb strings.Builder
+	sb.WriteString("🗂 Latest commands:\n")
+	for _, entry := range entries {
+		sb.WriteString("\n" + formatJournalEntry(entry))
+	}
+
+	return s.reply(ctx, cmd, sb.String())
+}
+
+// formatJournalEntry describes the entry in one line, e.g. "16 Oct 14:05 ✅ done · carlogbook · run the tests"
+func formatJournalEntry(entry JournalEntry) string {
+	var status string
+	switch entry.Status {
+	case CommandStatusAccepted:
+		status = "📥 accepted"
+	case CommandStatusWaiting:
+		status = "🤔 waiting for the project"
+	case CommandStatusQueued:
+		status = "🕒 queued"
+	case CommandStatusRunning:
+		status = "🏃 running"
+	case CommandStatusDone:
+		status = "✅ done"
+	case CommandStatusFailed:
+		status = "❌ failed"
+	case CommandStatusCancelled:
+		status = "🛑 cancelled"
+	case CommandStatusInterrupted:
+		status = "⚠️ interrupted"
+	default:
+		status = string(entry.Status)
+	}
+
+	parts := []string{entry.CreatedAt.Local().Format("02 Jan 15:04") + " " + status}
+	if entry.Project != "" {
+		parts = append(parts, entry.Project)
+	}
+
+	text := []rune(strings.Join(strings.Fields(entry.Text), " "))
+	if len(text) > maxJobPromptLength {
+		text = append(text[:maxJobPromptLength], '…')
+	}
+	parts = append(parts, string(text))
+
+	return strings.Join(parts, " · ")
+}
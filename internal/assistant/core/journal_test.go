@@ -0,0 +1,104 @@
+package core_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/izzddalfk/kumote/internal/assistant/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessCommandJournal(t *testing.T) {
+	ts := newTestService(t)
+
+	ts.send(t, "/status")
+	assert.Equal(t, core.CommandStatusDone, ts.journal.status(1), "built-in commands are done right away")
+
+	ts.send(t, "run the tests in carlogbook")
+	waitFor(t, ts.agents["claude"].inputs)
+	assert.Eventually(t, func() bool {
+		return ts.journal.status(2) == core.CommandStatusDone
+	}, 5*time.Second, 10*time.Millisecond)
+
+	entry, err := ts.journal.GetCommand(context.Background(), 2)
+	require.NoError(t, err)
+	assert.Equal(t, "claude", entry.AgentName)
+	assert.Equal(t, "mycar-logbook", entry.Project)
+	assert.Equal(t, "run the tests in carlogbook", entry.Text)
+
+	ts.agents["claude"].blocking = true
+	ts.send(t, "now fix them")
+	waitFor(t, ts.agents["claude"].inputs)
+	assert.Equal(t, core.CommandStatusRunning, ts.journal.status(3))
+	ts.send(t, "/cancel")
+	assert.Eventually(t, func() bool {
+		return ts.journal.status(3) == core.CommandStatusCancelled
+	}, 5*time.Second, 10*time.Millisecond)
+
+	ts.send(t, "/history")
+	history := ts.lastMessage(t)
+	assert.Contains(t, history, "🗂 Latest commands:")
+	assert.Contains(t, history, "🛑 cancelled · mycar-logbook · now fix them")
+	assert.Contains(t, history, "✅ done · mycar-logbook · run the tests in carlogbook")
+	assert.Contains(t, history, "✅ done · /status")
+}
+
+func TestRecoverInterruptedCommands(t *testing.T) {
+	ctx := context.Background()
+	queue := &fakeQueueStore{}
+	journal := &fakeJournal{}
+
+	// the process dies while the agent is running, the service after the restart is
+	// created up front since the stores must not change while the service is created
+	before := newTestServiceWithStores(t, queue, journal)
+	after := newTestServiceWithStores(t, queue, journal)
+	before.agents["claude"].blocking = true
+	before.send(t, "run the tests in carlogbook")
+	waitFor(t, before.agents["claude"].inputs)
+	t.Cleanup(func() {
+		shutdownCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		_ = before.service.Shutdown(shutdownCtx)
+	})
+
+	require.NoError(t, after.service.RecoverInterruptedCommands(ctx))
+	assert.Equal(t, core.CommandStatusInterrupted, journal.status(1))
+
+	after.telegram.mu.Lock()
+	require.Len(t, after.telegram.messages, 1)
+	notice := after.telegram.messages[0]
+	after.telegram.mu.Unlock()
+	assert.Equal(t, int64(42), notice.ChatID)
+	assert.Contains(t, notice.Message, "restarted before finishing your request:\n\nrun the tests in carlogbook")
+	require.Len(t, notice.Buttons, 1)
+	retry := notice.Buttons[0][0].CallbackData
+
+	// commands are only interrupted once
+	require.NoError(t, after.service.RecoverInterruptedCommands(ctx))
+
+	pressButton := func(userID int64) error {
+		return after.service.ProcessCallback(ctx, core.Callback{
+			ID: "cb", UserID: userID, ChatID: 42, MessageID: 1, Data: retry,
+		})
+	}
+	assert.ErrorIs(t, pressButton(7), core.ErrUserNotAuthorized)
+
+	require.NoError(t, pressButton(42))
+	input := waitFor(t, after.agents["claude"].inputs)
+	assert.Equal(t, "run the tests in carlogbook", input.Prompt)
+	waitFor(t, after.metrics.metrics)
+
+	assert.Eventually(t, func() bool {
+		return journal.status(2) == core.CommandStatusDone
+	}, 5*time.Second, 10*time.Millisecond, "the retry should be journaled as a new command")
+	assert.Equal(t, core.CommandStatusInterrupted, journal.status(1))
+
+	after.telegram.mu.Lock()
+	defer after.telegram.mu.Unlock()
+	require.NotEmpty(t, after.telegram.edits)
+	assert.Equal(t, core.TelegramEditMessageInput{
+		ChatID: 42, MessageID: 1, Message: "🔁 Retrying your request:\n\nrun the tests in carlogbook",
+	}, after.telegram.edits[0], "the retry button should be removed")
+}
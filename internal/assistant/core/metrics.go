@@ -0,0 +1,77 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+	"unicode/utf8"
+)
+
+// commandOutcome is how a command ended, as recorded in the command metrics
+type commandOutcome struct {
+	err            error // nil when the command succeeded
+	project        string
+	agentName      string
+	prompt         string
+	responseLength int
+	usage          Usage // what the agent run cost, when the agent reports it
+}
+
+// errorType maps the error of a failed command to the ErrorType constants, from the
+// sentinel errors it wraps. Errors wrapping none of them are internal errors.
+func errorType(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrRateLimitExceeded):
+		return ErrorTypeRateLimited
+	case errors.Is(err, ErrBudgetExceeded):
+		return ErrorTypeBudgetExceeded
+	case errors.Is(err, ErrUserNotAuthorized), errors.Is(err, ErrUserBlocked):
+		return ErrorTypeUnauthorized
+	case errors.Is(err, ErrProjectNotFound):
+		return ErrorTypeProjectNotFound
+	case errors.Is(err, ErrCommandTimeout), errors.Is(err, context.DeadlineExceeded):
+		return ErrorTypeTimeout
+	case errors.Is(err, ErrJobCancelled):
+		return ErrorTypeCancelled
+	case errors.Is(err, ErrProjectChoiceExpired):
+		return ErrorTypeExpired
+	case errors.Is(err, ErrShuttingDown):
+		return ErrorTypeShuttingDown
+	case errors.Is(err, ErrClaudeCodeUnavailable), errors.Is(err, ErrGeminiCLIUnavailable):
+		return ErrorTypeAgentUnavailable
+	case errors.Is(err, ErrCommandFailed):
+		return ErrorTypeAgentFailed
+	case errors.Is(err, ErrVoiceUnsupported):
+		return ErrorTypeVoiceRejected
+	case errors.Is(err, ErrTranscriptionFailed):
+		return ErrorTypeTranscription
+	default:
+		return ErrorTypeInternal
+	}
+}
+
+// recordMetrics records command execution metrics, failures are just logged
+func (s *Service) recordMetrics(ctx context.Context, cmd Command, startTime time.Time, outcome commandOutcome) {
+	metrics := CommandMetrics{
+		CommandID:      cmd.ID,
+		UserID:         cmd.UserID,
+		ExecutionTime:  time.Since(startTime),
+		Success:        outcome.err == nil,
+		ProjectUsed:    outcome.project,
+		AgentName:      outcome.agentName,
+		ErrorType:      errorType(outcome.err),
+		PromptLength:   utf8.RuneCountInString(outcome.prompt),
+		ResponseLength: outcome.responseLength,
+		Usage:          outcome.usage,
+		Timestamp:      time.Now(),
+	}
+
+	if err := s.metricsCollector.RecordCommandExecution(ctx, metrics); err != nil {
+		slog.WarnContext(ctx, "Failed to record metrics",
+			slog.String("command_id", cmd.ID),
+			slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,60 @@
+package core_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/izzddalfk/kumote/internal/assistant/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessCommandRecordsMetricsOnEveryOutcome(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t)
+
+	// built-in commands
+	ts.send(t, "/status")
+	metrics := ts.metrics.last(t)
+	assert.True(t, metrics.Success)
+	assert.Empty(t, metrics.ErrorType)
+	assert.Empty(t, metrics.AgentName)
+	assert.Equal(t, len("/status"), metrics.PromptLength)
+
+	// agent runs
+	ts.send(t, "@gemini what changed in carlogbook?")
+	metrics = waitFor(t, ts.metrics.metrics)
+	assert.True(t, metrics.Success)
+	assert.Equal(t, "gemini", metrics.AgentName)
+	assert.Equal(t, "mycar-logbook", metrics.ProjectUsed)
+	assert.Equal(t, len("what changed in carlogbook?"), metrics.PromptLength)
+	assert.Equal(t, len("answer from gemini"), metrics.ResponseLength)
+
+	// cancelled agent runs
+	ts.agents["claude"].blocking = true
+	ts.send(t, "run the tests")
+	waitFor(t, ts.agents["claude"].inputs)
+	ts.send(t, "/cancel")
+	metrics = waitFor(t, ts.metrics.metrics)
+	assert.False(t, metrics.Success)
+	assert.Equal(t, core.ErrorTypeCancelled, metrics.ErrorType)
+	assert.Equal(t, "claude", metrics.AgentName)
+
+	// unknown users
+	_, err := ts.service.ProcessCommand(ctx, core.Command{ID: "2", UserID: 7, ChatID: 7, Text: "hello", Timestamp: time.Now()})
+	require.NoError(t, err)
+	metrics = ts.metrics.last(t)
+	assert.False(t, metrics.Success)
+	assert.Equal(t, core.ErrorTypeUnauthorized, metrics.ErrorType)
+	assert.Equal(t, int64(7), metrics.UserID)
+
+	// messages that don't name a project, without a current project
+	fresh := newTestService(t)
+	fresh.scanner.matches = []core.ProjectMatch{}
+	fresh.send(t, "what's up")
+	metrics = fresh.metrics.last(t)
+	assert.False(t, metrics.Success)
+	assert.Equal(t, core.ErrorTypeProjectNotFound, metrics.ErrorType)
+	assert.Equal(t, "claude", metrics.AgentName)
+}
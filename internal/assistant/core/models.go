@@ -16,19 +16,40 @@ type User struct {
 // Command represents a user command that needs to be processed
 type Command struct {
 	ID          string     `json:"id"`
+	UpdateID    int64      `json:"update_id,omitempty"` // Telegram update the command came from, redelivered updates are ignored
 	UserID      int64      `json:"user_id"`
+	ChatID      int64      `json:"chat_id,omitempty"` // Telegram chat the command came from, replies go back there
 	Text        string     `json:"text"`
 	Timestamp   time.Time  `json:"timestamp"`
 	ProcessedAt *time.Time `json:"processed_at,omitempty"`
 	SessionID   *string    `json:"session_id,omitempty"` // Optional session ID for stateful interactions. Only supported by Claude Code.
+	Voice       *Voice     `json:"voice,omitempty"`      // Voice or audio message to transcribe into the text of the command
+}
+
+// Voice is a voice or audio message sent to the assistant, stored by Telegram until it's downloaded
+type Voice struct {
+	FileID   string        `json:"file_id"`
+	Duration time.Duration `json:"duration"`
+	MimeType string        `json:"mime_type,omitempty"`
+	FileSize int64         `json:"file_size,omitempty"`
+}
+
+// ReplyChatID returns the chat where replies to the command should be sent.
+// Private chats share the same ID as the user, so it falls back to the user ID.
+func (c Command) ReplyChatID() int64 {
+	if c.ChatID != 0 {
+		return c.ChatID
+	}
+	return c.UserID
 }
 
 // QueryResult represents the result of processing a user query
 type QueryResult struct {
-	Success  bool           `json:"success"`
-	Response string         `json:"response"`
-	Error    string         `json:"error,omitempty"`
-	Metadata map[string]any `json:"metadata,omitempty"`
+	Success   bool           `json:"success"`
+	Response  string         `json:"response"`
+	Error     string         `json:"error,omitempty"`
+	SessionID string         `json:"session_id,omitempty"` // Agent session that can be resumed by follow-up commands
+	Metadata  map[string]any `json:"metadata,omitempty"`
 }
 
 // ExecutionContext provides context for command execution
@@ -41,18 +62,223 @@ type ExecutionContext struct {
 
 // CommandMetrics represents metrics for command execution
 type CommandMetrics struct {
-	CommandID     string        `json:"command_id"`
-	UserID        int64         `json:"user_id"`
-	ExecutionTime time.Duration `json:"execution_time"`
-	Success       bool          `json:"success"`
-	ProjectUsed   string        `json:"project_used,omitempty"`
-	ErrorType     string        `json:"error_type,omitempty"`
-	Timestamp     time.Time     `json:"timestamp"`
+	CommandID      string        `json:"command_id"`
+	UserID         int64         `json:"user_id"`
+	ExecutionTime  time.Duration `json:"execution_time"`
+	Success        bool          `json:"success"`
+	ProjectUsed    string        `json:"project_used,omitempty"`
+	AgentName      string        `json:"agent_name,omitempty"`
+	ErrorType      string        `json:"error_type,omitempty"` // One of the ErrorType constants, empty on success
+	PromptLength   int           `json:"prompt_length"`        // In characters
+	ResponseLength int           `json:"response_length"`      // In characters
+	Usage
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Usage is what agent runs cost, as reported by the agents
+type Usage struct {
+	CostUSD      float64 `json:"cost_usd"`
+	InputTokens  int64   `json:"input_tokens"` // Including the tokens written to the prompt cache, not the ones read from it
+	OutputTokens int64   `json:"output_tokens"`
+}
+
+// Tokens returns the input and output tokens together
+func (u Usage) Tokens() int64 {
+	return u.InputTokens + u.OutputTokens
+}
+
+// UsageBudget limits what the agent runs of every user may cost per day and per calendar month,
+// in the local time of the server. Zero limits are unlimited.
+type UsageBudget struct {
+	DailyCostUSD   float64
+	MonthlyCostUSD float64
+	DailyTokens    int64
+	MonthlyTokens  int64
+}
+
+// MetricsSummary aggregates the command metrics of a period
+type MetricsSummary struct {
+	Commands         int           `json:"commands"`
+	Succeeded        int           `json:"succeeded"`
+	Failed           int           `json:"failed"`
+	SuccessRate      float64       `json:"success_rate"` // From 0 to 1, 0 when there are no commands
+	P50ExecutionTime time.Duration `json:"p50_execution_time"`
+	P95ExecutionTime time.Duration `json:"p95_execution_time"`
+}
+
+// ProjectMetrics is the summary of the commands run in a project
+type ProjectMetrics struct {
+	Project string `json:"project"` // Empty for commands that didn't run in a project
+	MetricsSummary
+}
+
+// UserMetrics is the summary of the commands sent by a user
+type UserMetrics struct {
+	UserID int64 `json:"user_id"`
+	MetricsSummary
+}
+
+// MetricsReport is the usage report of a period, breakdowns are sorted by commands, most first
+type MetricsReport struct {
+	Period   string           `json:"period"`
+	Since    time.Time        `json:"since"`
+	Until    time.Time        `json:"until"`
+	Projects []ProjectMetrics `json:"projects"`
+	Users    []UserMetrics    `json:"users"`
+	MetricsSummary
+}
+
+// Session links a chat and project to the last agent session,
+// so follow-up messages continue the same conversation
+type Session struct {
+	ChatID    int64     `json:"chat_id"`
+	Project   string    `json:"project"` // Working directory of the project
+	AgentName string    `json:"agent_name"`
+	SessionID string    `json:"session_id"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// JobStatus is the state of a command run by an agent in background
+type JobStatus string
+
+const (
+	JobStatusQueued    JobStatus = "queued"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusDone      JobStatus = "done"
+	JobStatusFailed    JobStatus = "failed"
+	JobStatusCancelled JobStatus = "cancelled"
+)
+
+// IsFinal reports whether the job is over
+func (s JobStatus) IsFinal() bool {
+	return s == JobStatusDone || s == JobStatusFailed || s == JobStatusCancelled
+}
+
+// Job is a command run by an agent in background
+type Job struct {
+	ID         string    `json:"id"`
+	CommandID  string    `json:"command_id"`
+	UserID     int64     `json:"user_id"`
+	ChatID     int64     `json:"chat_id"`
+	Project    string    `json:"project"` // Name of the project
+	AgentName  string    `json:"agent_name"`
+	Prompt     string    `json:"prompt"`
+	Status     JobStatus `json:"status"`
+	CreatedAt  time.Time `json:"created_at"`
+	StartedAt  time.Time `json:"started_at,omitzero"`
+	FinishedAt time.Time `json:"finished_at,omitzero"`
+}
+
+// CommandStatus is the state of a command in the command journal
+type CommandStatus string
+
+const (
+	CommandStatusAccepted    CommandStatus = "accepted"
+	CommandStatusWaiting     CommandStatus = "waiting" // for the user to choose the project
+	CommandStatusQueued      CommandStatus = CommandStatus(JobStatusQueued)
+	CommandStatusRunning     CommandStatus = CommandStatus(JobStatusRunning)
+	CommandStatusDone        CommandStatus = CommandStatus(JobStatusDone)
+	CommandStatusFailed      CommandStatus = CommandStatus(JobStatusFailed)
+	CommandStatusCancelled   CommandStatus = CommandStatus(JobStatusCancelled)
+	CommandStatusInterrupted CommandStatus = "interrupted" // the process stopped before the command finished
+)
+
+// JournalEntry is an accepted command along with its lifecycle, as kept in the command journal
+type JournalEntry struct {
+	ID        int64         `json:"id"`
+	CommandID string        `json:"command_id"`
+	UserID    int64         `json:"user_id"`
+	ChatID    int64         `json:"chat_id"`
+	Text      string        `json:"text"`
+	AgentName string        `json:"agent_name,omitempty"`
+	Project   string        `json:"project,omitempty"` // Name of the project the command ran in
+	Status    CommandStatus `json:"status"`
+	Error     string        `json:"error,omitempty"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+// QueuedJob is a job waiting for its turn, persisted so it's resumed after a restart
+type QueuedJob struct {
+	ID          string    `json:"id"`
+	Command     Command   `json:"command"`
+	AgentName   string    `json:"agent_name"`
+	Prompt      string    `json:"prompt"` // Prompt without the agent prefix
+	ProjectName string    `json:"project_name"`
+	ProjectPath string    `json:"project_path"`
+	JournalID   int64     `json:"journal_id,omitempty"` // Entry of the command in the command journal
+	QueuedAt    time.Time `json:"queued_at"`
+}
+
+// ChatProject is the project a chat works on, used when a message doesn't name one
+type ChatProject struct {
+	ChatID    int64     `json:"chat_id"`
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Project represents a project found in the projects directory
+type Project struct {
+	Name        string   `json:"name"`
+	Path        string   `json:"path"`
+	Aliases     []string `json:"aliases,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	TechStack   []string `json:"tech_stack,omitempty"`
+}
+
+// Callback represents a press of an inline keyboard button
+type Callback struct {
+	ID        string `json:"id"`                  // Callback query ID, used to answer it
+	UpdateID  int64  `json:"update_id,omitempty"` // Telegram update of the button press, redelivered updates are ignored
+	UserID    int64  `json:"user_id"`
+	ChatID    int64  `json:"chat_id"`
+	MessageID int64  `json:"message_id"` // Message the pressed button belongs to
+	Data      string `json:"data"`
+}
+
+// BotCommand is a command the assistant handles itself, as listed in Telegram clients
+type BotCommand struct {
+	Command     string `json:"command"` // Name without the leading slash
+	Description string `json:"description"`
+}
+
+// ProjectMatch is a project matching a query, with the similarity score between 0 and 1
+type ProjectMatch struct {
+	Name  string  `json:"name"`
+	Path  string  `json:"path"`
+	Score float64 `json:"score"`
 }
 
 type TelegramTextMessageInput struct {
 	ChatID  int64
 	Message string
+	// Buttons are shown as an inline keyboard below the message, one slice per row
+	Buttons [][]InlineButton
+}
+
+type TelegramAnswerCallbackInput struct {
+	CallbackQueryID string
+	Text            string // Optional notification shown to the user
+}
+
+// InlineButton is a button of an inline keyboard, pressing it sends the callback data back to the bot
+type InlineButton struct {
+	Text         string
+	CallbackData string
+}
+
+type TelegramEditMessageInput struct {
+	ChatID    int64
+	MessageID int64
+	Message   string
+}
+
+// TranscriptionInput is an audio recording to turn into text
+type TranscriptionInput struct {
+	Audio  []byte
+	Format string // One of the AudioFormat constants
 }
 
 type AgentCommandInput struct {
@@ -60,3 +286,15 @@ type AgentCommandInput struct {
 	ExecutionContext ExecutionContext
 	SessionID        *string // Optional session ID for stateful interactions. Only supported by Claude Code.
 }
+
+// Agent event types emitted while an agent is running
+const (
+	AgentEventText    = "text"     // Partial text written by the agent
+	AgentEventToolUse = "tool_use" // The agent called a tool, e.g. reading a file or running a command
+)
+
+// AgentEvent represents a progress event of a running agent
+type AgentEvent struct {
+	Type string
+	Text string // Partial text, or a short description of the tool call
+}
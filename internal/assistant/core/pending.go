@@ -0,0 +1,87 @@
+package core
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// pendingStore keeps what waits for the user to press a button, like the project choices
+// and the voice transcripts, in memory by a short random ID, short enough to fit in the
+// signed callback data of the buttons. Values are dropped once they expire.
+type pendingStore[T any] struct {
+	mu      sync.Mutex
+	pending map[string]pendingValue[T]
+}
+
+// pendingValue is a value waiting for the user in a chat
+type pendingValue[T any] struct {
+	value     T
+	userID    int64
+	chatID    int64
+	expiresAt time.Time
+}
+
+func newPendingStore[T any]() *pendingStore[T] {
+	return &pendingStore[T]{pending: make(map[string]pendingValue[T])}
+}
+
+// add stores the value for the user and returns its ID. When the value expires before it's
+// taken or cancelled, it's dropped and passed to onExpire, if any.
+func (p *pendingStore[T]) add(userID, chatID int64, value T, expiresAt time.Time, onExpire func(T)) (string, error) {
+	idBytes := make([]byte, 6)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(idBytes)
+
+	p.mu.Lock()
+	p.pending[id] = pendingValue[T]{value: value, userID: userID, chatID: chatID, expiresAt: expiresAt}
+	p.mu.Unlock()
+
+	time.AfterFunc(time.Until(expiresAt), func() {
+		p.mu.Lock()
+		pending, ok := p.pending[id]
+		delete(p.pending, id)
+		p.mu.Unlock()
+
+		if ok && onExpire != nil {
+			onExpire(pending.value)
+		}
+	})
+
+	return id, nil
+}
+
+// take removes and returns the value when it hasn't expired and belongs to the user.
+// Expired values are left to expire.
+func (p *pendingStore[T]) take(id string, userID int64) (T, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pending, ok := p.pending[id]
+	if !ok || pending.userID != userID || !time.Now().Before(pending.expiresAt) {
+		var zero T
+		return zero, false
+	}
+	delete(p.pending, id)
+
+	return pending.value, true
+}
+
+// cancel removes and returns the values pending in the chat
+func (p *pendingStore[T]) cancel(chatID int64) []T {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var cancelled []T
+	for id, pending := range p.pending {
+		if pending.chatID == chatID {
+			cancelled = append(cancelled, pending.value)
+			delete(p.pending, id)
+		}
+	}
+
+	return cancelled
+}
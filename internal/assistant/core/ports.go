@@ -2,6 +2,7 @@ package core
 
 import (
 	"context"
+	"time"
 )
 
 // Primary Ports (APIs that drive our application)
@@ -10,6 +11,13 @@ import (
 type AssistantService interface {
 	// ProcessCommand processes a user command and returns the result
 	ProcessCommand(ctx context.Context, cmd Command) (*QueryResult, error)
+
+	// ProcessCallback handles a press of an inline keyboard button sent by the assistant
+	ProcessCallback(ctx context.Context, callback Callback) error
+
+	// GetMetricsReport returns the usage report of the period ending now,
+	// one of the MetricsPeriod constants, or ErrInvalidMetricsPeriod
+	GetMetricsReport(ctx context.Context, period string) (*MetricsReport, error)
 }
 
 // Secondary Ports (SPIs that are driven by our application)
@@ -19,12 +27,45 @@ type Agent interface {
 	// ExecuteCommand runs an AI code command and returns the result
 	ExecuteCommand(ctx context.Context, input AgentCommandInput) (*QueryResult, error)
 
+	// ExecuteCommandStream runs an AI code command like ExecuteCommand while reporting
+	// progress events to onEvent as they happen. Agents that can't stream their output
+	// just return the result without emitting any event.
+	ExecuteCommandStream(ctx context.Context, input AgentCommandInput, onEvent func(AgentEvent)) (*QueryResult, error)
+
 	// IsAvailable checks if AI code executor is available and working
 	IsAvailable(ctx context.Context) bool
 }
 
+// AgentRegistry defines interface for looking up the configured agents by name
+type AgentRegistry interface {
+	// GetAgent returns the agent registered under the given name
+	GetAgent(name string) (Agent, bool)
+
+	// DefaultAgent returns the agent used when no specific agent is requested, along with its name
+	DefaultAgent() (string, Agent)
+}
+
 type TelegramStorage interface {
-	SendTextMessage(ctx context.Context, input TelegramTextMessageInput) error
+	// SendTextMessage sends a text message and returns the ID of the sent message
+	SendTextMessage(ctx context.Context, input TelegramTextMessageInput) (int64, error)
+
+	// EditTextMessage replaces the text of a previously sent message
+	EditTextMessage(ctx context.Context, input TelegramEditMessageInput) error
+
+	// AnswerCallbackQuery acknowledges a button press, optionally showing a notification
+	AnswerCallbackQuery(ctx context.Context, input TelegramAnswerCallbackInput) error
+
+	// SetMyCommands replaces the command list suggested by Telegram clients
+	SetMyCommands(ctx context.Context, commands []BotCommand) error
+
+	// DownloadFile returns the content of a file sent to the bot, such as a voice message
+	DownloadFile(ctx context.Context, fileID string) ([]byte, error)
+}
+
+// Transcriber defines interface for turning speech into text
+type Transcriber interface {
+	// Transcribe returns the text spoken in the audio
+	Transcribe(ctx context.Context, input TranscriptionInput) (string, error)
 }
 
 // UserRepository defines interface for managing user data
@@ -37,7 +78,66 @@ type UserRepository interface {
 }
 
 type ProjectScanner interface {
-	GetProjectDirectory(query string) (string, error)
+	// FindProjects returns the projects matching the query, best match first,
+	// or ErrProjectNotFound when there is none
+	FindProjects(query string) ([]ProjectMatch, error)
+	// ListProjects returns the projects of the project index
+	ListProjects(ctx context.Context) ([]Project, error)
+	// RefreshProjects scans the projects directory and rewrites the project index
+	RefreshProjects(ctx context.Context) ([]Project, error)
+}
+
+// SessionStore defines interface for persisting agent sessions per chat and project
+type SessionStore interface {
+	// GetSession returns the last session of the chat for the project, or nil when there is none
+	GetSession(ctx context.Context, chatID int64, project string) (*Session, error)
+
+	// SaveSession creates or replaces the session of the chat for the project
+	SaveSession(ctx context.Context, session Session) error
+
+	// DeleteSession removes the session of the chat for the project
+	DeleteSession(ctx context.Context, chatID int64, project string) error
+
+	// DeleteSessions removes every session of the chat
+	DeleteSessions(ctx context.Context, chatID int64) error
+
+	// GetChatProject returns the current project of the chat, or nil when there is none
+	GetChatProject(ctx context.Context, chatID int64) (*ChatProject, error)
+
+	// SaveChatProject creates or replaces the current project of the chat
+	SaveChatProject(ctx context.Context, project ChatProject) error
+}
+
+// QueueStore defines interface for persisting the jobs waiting for their turn
+type QueueStore interface {
+	// SaveQueuedJob stores a job waiting for its turn
+	SaveQueuedJob(ctx context.Context, job QueuedJob) error
+
+	// DeleteQueuedJob removes the job once it started or was cancelled
+	DeleteQueuedJob(ctx context.Context, id string) error
+
+	// ListQueuedJobs returns the stored jobs, oldest first
+	ListQueuedJobs(ctx context.Context) ([]QueuedJob, error)
+}
+
+// CommandJournal defines interface for recording the accepted commands and their lifecycle
+type CommandJournal interface {
+	// RecordCommand stores a newly accepted command and returns the ID of its entry
+	RecordCommand(ctx context.Context, entry JournalEntry) (int64, error)
+
+	// UpdateCommand sets the status of the entry with the same ID, along with
+	// its agent, project and error when they're not empty
+	UpdateCommand(ctx context.Context, entry JournalEntry) error
+
+	// GetCommand returns the entry, or nil when there is none
+	GetCommand(ctx context.Context, id int64) (*JournalEntry, error)
+
+	// ListCommands returns the latest entries of the chat, newest first
+	ListCommands(ctx context.Context, chatID int64, limit int) ([]JournalEntry, error)
+
+	// InterruptCommands marks the entries left accepted, waiting or running by a previous
+	// process as interrupted and returns them
+	InterruptCommands(ctx context.Context) ([]JournalEntry, error)
 }
 
 // MetricsCollector defines interface for collecting usage metrics
@@ -46,6 +146,15 @@ type MetricsCollector interface {
 	RecordCommandExecution(ctx context.Context, metrics CommandMetrics) error
 }
 
+// MetricsReporter defines interface for reading the collected usage metrics
+type MetricsReporter interface {
+	// ReportCommandMetrics aggregates the metrics of the commands executed in [since, until)
+	ReportCommandMetrics(ctx context.Context, since, until time.Time) (*MetricsReport, error)
+
+	// GetUserUsage sums the usage of the commands of the user executed since the given time
+	GetUserUsage(ctx context.Context, userID int64, since time.Time) (*Usage, error)
+}
+
 // RateLimiter defines interface for rate limiting
 type RateLimiter interface {
 	// IsAllowed checks if request is within rate limit
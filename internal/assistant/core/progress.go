@@ -0,0 +1,181 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxProgressToolCalls is how many of the latest tool calls are shown in the progress message
+	maxProgressToolCalls = 5
+	// maxProgressTextLength is how many characters of the latest partial text are shown
+	maxProgressTextLength = 500
+)
+
+// progressReporter keeps a placeholder message in the chat up to date with
+// the agent's progress. Edits are throttled to one per interval since Telegram
+// rate limits message edits.
+type progressReporter struct {
+	telegram TelegramStorage
+	chatID   int64
+	interval time.Duration
+	hint     string // shown below the progress while the agent is working
+
+	mu        sync.Mutex
+	messageID int64
+	startedAt time.Time
+	toolCalls []string
+	text      string
+	dirty     bool
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func newProgressReporter(telegram TelegramStorage, chatID int64, interval time.Duration, hint string) *progressReporter {
+	return &progressReporter{
+		telegram: telegram,
+		chatID:   chatID,
+		interval: interval,
+		hint:     hint,
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+}
+
+// Start posts the placeholder message and starts the periodic edits
+func (p *progressReporter) Start(ctx context.Context) {
+	p.startedAt = time.Now()
+
+	messageID, err := p.telegram.SendTextMessage(ctx, TelegramTextMessageInput{
+		ChatID:  p.chatID,
+		Message: p.render("⏳ Working on it…"),
+	})
+	if err != nil {
+		// Without the placeholder there is nothing to edit, the final response is still sent
+		slog.WarnContext(ctx, "Failed to send progress message",
+			slog.Int64("chat_id", p.chatID),
+			slog.String("error", err.Error()))
+		close(p.stopped)
+		return
+	}
+	p.messageID = messageID
+
+	go p.loop(ctx)
+}
+
+// OnEvent records an agent event, it's passed to the agent as the stream callback
+func (p *progressReporter) OnEvent(event AgentEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch event.Type {
+	case AgentEventToolUse:
+		p.toolCalls = append(p.toolCalls, event.Text)
+		if len(p.toolCalls) > maxProgressToolCalls {
+			p.toolCalls = p.toolCalls[len(p.toolCalls)-maxProgressToolCalls:]
+		}
+	case AgentEventText:
+		p.text = event.Text
+	default:
+		return
+	}
+	p.dirty = true
+}
+
+// Stop ends the periodic edits and leaves the placeholder with the final status
+func (p *progressReporter) Stop(ctx context.Context, status string) {
+	if p.messageID == 0 {
+		// placeholder was never sent
+		return
+	}
+
+	// the loop might have stopped already with the context, the final status is still shown
+	close(p.done)
+	<-p.stopped
+
+	p.mu.Lock()
+	p.toolCalls = nil
+	p.text = ""
+	p.hint = ""
+	p.mu.Unlock()
+
+	elapsed := time.Since(p.startedAt).Round(time.Second)
+	p.edit(ctx, fmt.Sprintf("%s in %s", status, elapsed))
+}
+
+func (p *progressReporter) loop(ctx context.Context) {
+	defer close(p.stopped)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			dirty := p.dirty
+			p.dirty = false
+			p.mu.Unlock()
+
+			if dirty {
+				elapsed := time.Since(p.startedAt).Round(time.Second)
+				p.edit(ctx, fmt.Sprintf("⏳ Working on it… (%s)", elapsed))
+			}
+		}
+	}
+}
+
+func (p *progressReporter) edit(ctx context.Context, status string) {
+	if err := p.telegram.EditTextMessage(ctx, TelegramEditMessageInput{
+		ChatID:    p.chatID,
+		MessageID: p.messageID,
+		Message:   p.render(status),
+	}); err != nil {
+		slog.WarnContext(ctx, "Failed to update progress message",
+			slog.Int64("chat_id", p.chatID),
+			slog.Int64("message_id", p.messageID),
+			slog.String("error", err.Error()))
+	}
+}
+
+// render builds the progress message from the status and the latest events
+func (p *progressReporter) render(status string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var sb strings.Builder
+	sb.WriteString(status)
+
+	if len(p.toolCalls) > 0 {
+		sb.WriteString("\n")
+		for _, toolCall := range p.toolCalls {
+			sb.WriteString("\n🔧 ")
+			sb.WriteString(toolCall)
+		}
+	}
+
+	if p.text != "" {
+		text := []rune(p.text)
+		if len(text) > maxProgressTextLength {
+			text = append([]rune("…"), text[len(text)-maxProgressTextLength:]...)
+		}
+		sb.WriteString("\n\n💬 ")
+		sb.WriteString(string(text))
+	}
+
+	if p.hint != "" {
+		sb.WriteString("\n\n")
+		sb.WriteString(p.hint)
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,163 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// projectAmbiguityMargin is how close to the best score another project must be
+	// for the match to be considered ambiguous
+	projectAmbiguityMargin = 0.05
+	// maxProjectChoices is how many projects are offered when the match is ambiguous
+	maxProjectChoices = 5
+	// projectChoiceTTL is how long the user has to choose a project
+	projectChoiceTTL = 10 * time.Minute
+	// projectChoiceCallbackAction is the callback action of the project buttons
+	projectChoiceCallbackAction = "project"
+)
+
+// ambiguousMatches returns the matches scoring about as well as the best one.
+// An exact match only competes with other exact matches.
+func ambiguousMatches(matches []ProjectMatch) []ProjectMatch {
+	if len(matches) == 0 {
+		return nil
+	}
+
+	best := matches[0].Score
+	margin := projectAmbiguityMargin
+	if best >= 1 {
+		margin = 0
+	}
+
+	var candidates []ProjectMatch
+	for _, match := range matches {
+		if best-match.Score > margin || len(candidates) == maxProjectChoices {
+			break
+		}
+		candidates = append(candidates, match)
+	}
+
+	return candidates
+}
+
+// askForProject keeps the request until the user picks one of the candidate projects
+// from the inline keyboard sent to the chat. Without a request, the picked project
+// just becomes the current project of the chat.
+func (s *Service) askForProject(ctx context.Context, cmd Command, request *agentRequest, candidates []ProjectMatch) (*QueryResult, error) {
+	expiresAt := time.Now().Add(projectChoiceTTL)
+	choice := pendingProjectChoice{
+		chatID:     cmd.ReplyChatID(),
+		request:    request,
+		candidates: candidates,
+	}
+	// Drop the request when the user doesn't choose in time, so it isn't left waiting
+	id, err := s.projectChoices.add(cmd.UserID, cmd.ReplyChatID(), choice, expiresAt, func(choice pendingProjectChoice) {
+		s.dropProjectChoice(context.WithoutCancel(ctx), choice, ErrProjectChoiceExpired)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to keep the pending project choice: %w", err)
+	}
+
+	buttons := make([][]InlineButton, 0, len(candidates))
+	for i, candidate := range candidates {
+		callbackData, err := s.callbacks.sign(projectChoiceCallbackAction, fmt.Sprintf("%s.%d", id, i), expiresAt)
+		if err != nil {
+			return nil, err
+		}
+		buttons = append(buttons, []InlineButton{{
+			Text:         candidate.Name,
+			CallbackData: callbackData,
+		}})
+	}
+
+	if request != nil {
+		s.updateCommand(ctx, request.journalID, JournalEntry{Status: CommandStatusWaiting})
+	}
+
+	slog.DebugContext(ctx, "Ambiguous project match, asking the user",
+		slog.String("command_id", cmd.ID),
+		slog.Int("candidates", len(candidates)))
+
+	message := "🤔 Your message matches more than one project. Which one do you mean?"
+	chatID := cmd.ReplyChatID()
+	if _, err := s.telegram.SendTextMessage(ctx, TelegramTextMessageInput{
+		ChatID:  chatID,
+		Message: message,
+		Buttons: buttons,
+	}); err != nil {
+		slog.ErrorContext(ctx, "Failed to send Telegram message",
+			slog.Int64("chat_id", chatID),
+			slog.String("error", err.Error()))
+	}
+
+	return &QueryResult{
+		Success:  true,
+		Response: message,
+	}, nil
+}
+
+// handleProjectChoice runs the pending request in the project picked by the user, which
+// becomes the current project of the chat. The payload is the ID of the pending choice
+// and the index of the picked candidate.
+func (s *Service) handleProjectChoice(ctx context.Context, callback Callback, payload string) (string, error) {
+	id, indexText, _ := strings.Cut(payload, ".")
+	index, err := strconv.Atoi(indexText)
+	if err != nil {
+		return "This button is not valid anymore.", fmt.Errorf("%w: %s", ErrCallbackInvalid, err.Error())
+	}
+
+	choice, ok := s.projectChoices.take(id, callback.UserID)
+	if !ok || index < 0 || index >= len(choice.candidates) {
+		return "⌛ This choice has expired, please send your message again.", ErrCallbackExpired
+	}
+	project := choice.candidates[index]
+
+	// replace the question, and its buttons, with the choice so it can't be picked twice
+	if err := s.telegram.EditTextMessage(ctx, TelegramEditMessageInput{
+		ChatID:    callback.ChatID,
+		MessageID: callback.MessageID,
+		Message:   "📁 " + project.Name,
+	}); err != nil {
+		slog.WarnContext(ctx, "Failed to edit project choice message",
+			slog.Int64("chat_id", callback.ChatID),
+			slog.String("error", err.Error()))
+	}
+
+	if choice.request == nil {
+		s.rememberProject(ctx, choice.chatID, project)
+		return "📁 " + project.Name, nil
+	}
+	if _, err := s.startAgentJob(ctx, *choice.request, project); err != nil {
+		return "❌ Failed to start the request.", err
+	}
+
+	return "📁 " + project.Name, nil
+}
+
+// dropProjectChoice completes the request waiting for the project choice as cancelled, when
+// there's one, and records why it was dropped: ErrJobCancelled or ErrProjectChoiceExpired
+func (s *Service) dropProjectChoice(ctx context.Context, choice pendingProjectChoice, err error) {
+	request := choice.request
+	if request == nil {
+		return
+	}
+
+	s.updateCommand(ctx, request.journalID, JournalEntry{Status: CommandStatusCancelled, Error: err.Error()})
+	s.recordMetrics(ctx, request.cmd, request.startTime, commandOutcome{
+		err:       err,
+		agentName: request.agentName,
+		prompt:    request.prompt,
+	})
+}
+
+// pendingProjectChoice is a request waiting for the user to choose its project
+type pendingProjectChoice struct {
+	chatID     int64
+	request    *agentRequest // nil when the user is only picking the current project
+	candidates []ProjectMatch
+}
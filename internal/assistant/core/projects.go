@@ -0,0 +1,59 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// refreshProjectsCommand rescans the projects directory, as listed in the help message
+const refreshProjectsCommand = "refresh projects"
+
+// commandIntent detects the intent of commands handled by the assistant itself.
+// Everything else is a general query for the agent.
+func commandIntent(text string) string {
+	if strings.EqualFold(strings.Join(strings.Fields(text), " "), refreshProjectsCommand) {
+		return IntentRefresh
+	}
+	return IntentGeneralQuery
+}
+
+// refreshProjects rebuilds the project index and replies with the projects found
+func (s *Service) refreshProjects(ctx context.Context, cmd Command, _ string) (*QueryResult, error) {
+	chatID := cmd.ReplyChatID()
+
+	projects, err := s.projectScanner.RefreshProjects(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to refresh projects",
+			slog.Int64("chat_id", chatID),
+			slog.String("error", err.Error()))
+		s.sendMessage(ctx, chatID, "❌ Failed to refresh the project index. Please check the logs.")
+		return nil, fmt.Errorf("failed to refresh projects: %w", err)
+	}
+
+	if len(projects) == 0 {
+		return s.reply(ctx, cmd, "🔄 Project index refreshed, but no projects were found.")
+	}
+	return s.reply(ctx, cmd, fmt.Sprintf("🔄 Project index refreshed, found %d projects:\n%s", len(projects), formatProjectList(projects)))
+}
+
+// formatProjectList lists the projects with their tech stack and aliases, up to MaxProjectsToShow
+func formatProjectList(projects []Project) string {
+	var sb strings.Builder
+	for i, project := range projects {
+		if i == MaxProjectsToShow {
+			fmt.Fprintf(&sb, "\n…and %d more", len(projects)-MaxProjectsToShow)
+			break
+		}
+		sb.WriteString("\n• " + project.Name)
+		if len(project.TechStack) > 0 {
+			sb.WriteString(" (" + strings.Join(project.TechStack, ", ") + ")")
+		}
+		if len(project.Aliases) > 0 {
+			sb.WriteString(" aka " + strings.Join(project.Aliases, ", "))
+		}
+	}
+
+	return sb.String()
+}
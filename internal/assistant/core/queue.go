@@ -0,0 +1,93 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// queueJob persists the job waiting for its turn and returns it, or nil when it can't be
+// persisted. The job still runs then, but it's interrupted on restart instead of resumed.
+func (s *Service) queueJob(ctx context.Context, job Job, request agentRequest, project ProjectMatch) *QueuedJob {
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		slog.WarnContext(ctx, "Failed to generate queued job ID", slog.String("error", err.Error()))
+		return nil
+	}
+
+	queued := QueuedJob{
+		ID:          hex.EncodeToString(idBytes),
+		Command:     request.cmd,
+		AgentName:   request.agentName,
+		Prompt:      request.prompt,
+		ProjectName: project.Name,
+		ProjectPath: project.Path,
+		JournalID:   request.journalID,
+		QueuedAt:    job.CreatedAt,
+	}
+	if err := s.queue.SaveQueuedJob(ctx, queued); err != nil {
+		slog.WarnContext(ctx, "Failed to persist queued job",
+			slog.String("job_id", job.ID),
+			slog.String("error", err.Error()))
+		return nil
+	}
+
+	return &queued
+}
+
+// dequeueJob removes the persisted job once it started or was cancelled, failures are just logged
+func (s *Service) dequeueJob(ctx context.Context, queued *QueuedJob) {
+	if queued == nil {
+		return
+	}
+	if err := s.queue.DeleteQueuedJob(ctx, queued.ID); err != nil {
+		slog.WarnContext(ctx, "Failed to delete queued job",
+			slog.String("queued_job_id", queued.ID),
+			slog.String("error", err.Error()))
+	}
+}
+
+// ResumeQueuedJobs queues again the jobs that were waiting for their turn when Kumote stopped
+func (s *Service) ResumeQueuedJobs(ctx context.Context) error {
+	queuedJobs, err := s.queue.ListQueuedJobs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list queued jobs: %w", err)
+	}
+
+	for _, queued := range queuedJobs {
+		// the job is queued again under a new ID
+		s.dequeueJob(ctx, &queued)
+
+		agent, ok := s.agents.GetAgent(queued.AgentName)
+		if !ok {
+			slog.WarnContext(ctx, "Agent of the queued job is not available anymore, using the default one",
+				slog.String("agent", queued.AgentName))
+			queued.AgentName, agent = s.agents.DefaultAgent()
+		}
+
+		chatID := queued.Command.ReplyChatID()
+		s.sendMessage(ctx, chatID, fmt.Sprintf("♻️ Kumote restarted, resuming your queued request in %s.", queued.ProjectName))
+
+		if _, err := s.startAgentJob(ctx, agentRequest{
+			cmd:       queued.Command,
+			agentName: queued.AgentName,
+			agent:     agent,
+			prompt:    queued.Prompt,
+			startTime: time.Now(),
+			journalID: queued.JournalID,
+		}, ProjectMatch{Name: queued.ProjectName, Path: queued.ProjectPath}); err != nil {
+			slog.ErrorContext(ctx, "Failed to resume queued job",
+				slog.String("command_id", queued.Command.ID),
+				slog.String("error", err.Error()))
+		}
+	}
+
+	if len(queuedJobs) > 0 {
+		slog.InfoContext(ctx, "Resumed queued jobs", slog.Int("jobs", len(queuedJobs)))
+	}
+
+	return nil
+}
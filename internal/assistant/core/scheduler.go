@@ -0,0 +1,147 @@
+package core
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+)
+
+// jobScheduler decides when jobs start. Only one job runs per working directory at a time,
+// so two agents never edit the same working tree at once, and at most maxConcurrent jobs
+// run overall. Waiting jobs start in the order they were queued.
+type jobScheduler struct {
+	mu            sync.Mutex
+	maxConcurrent int
+	running       int
+	busyDirs      map[string]bool
+	waiting       []*schedulerTicket
+	closed        bool
+}
+
+// schedulerTicket is the place of a job in the scheduler
+type schedulerTicket struct {
+	dir     string
+	ready   chan struct{} // closed once the job starts or the scheduler is closed
+	started bool
+}
+
+func newJobScheduler(maxConcurrent int) *jobScheduler {
+	return &jobScheduler{
+		maxConcurrent: maxConcurrent,
+		busyDirs:      make(map[string]bool),
+	}
+}
+
+// enqueue queues a job running in the directory and returns its ticket along with
+// its position in the queue, which is 0 when the job starts right away
+func (s *jobScheduler) enqueue(dir string) (*schedulerTicket, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ticket := &schedulerTicket{dir: filepath.Clean(dir), ready: make(chan struct{})}
+	if s.closed {
+		// it won't start, but it's still queued to be resumed after the restart
+		close(ticket.ready)
+		return ticket, 1
+	}
+	s.waiting = append(s.waiting, ticket)
+	s.dispatch()
+	if ticket.started {
+		return ticket, 0
+	}
+
+	for i, waiting := range s.waiting {
+		if waiting == ticket {
+			return ticket, i + 1
+		}
+	}
+	return ticket, len(s.waiting)
+}
+
+// wait blocks until the job of the ticket starts. When the context is done first, the job
+// leaves the queue and the cause of the context is returned. It returns ErrShuttingDown
+// when the scheduler is closed before the job starts.
+func (s *jobScheduler) wait(ctx context.Context, ticket *schedulerTicket) error {
+	select {
+	case <-ticket.ready:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if !ticket.started {
+			return ErrShuttingDown
+		}
+		return nil
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ticket.started {
+		// started at the same time, give the slot back
+		s.free(ticket)
+	} else {
+		s.remove(ticket)
+	}
+	s.dispatch()
+
+	return context.Cause(ctx)
+}
+
+// done frees the slot of a job that started, letting the next ones start
+func (s *jobScheduler) done(ticket *schedulerTicket) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.free(ticket)
+	s.dispatch()
+}
+
+// close stops starting jobs, the waiting ones are released with ErrShuttingDown
+func (s *jobScheduler) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for _, ticket := range s.waiting {
+		close(ticket.ready)
+	}
+	s.waiting = nil
+}
+
+// dispatch starts the waiting jobs that can run, the lock must be held.
+// A job never overtakes an earlier one waiting for the same directory.
+func (s *jobScheduler) dispatch() {
+	if s.closed {
+		return
+	}
+
+	blockedDirs := make(map[string]bool)
+	remaining := make([]*schedulerTicket, 0, len(s.waiting))
+	for _, ticket := range s.waiting {
+		if s.running < s.maxConcurrent && !s.busyDirs[ticket.dir] && !blockedDirs[ticket.dir] {
+			ticket.started = true
+			s.running++
+			s.busyDirs[ticket.dir] = true
+			close(ticket.ready)
+			continue
+		}
+		blockedDirs[ticket.dir] = true
+		remaining = append(remaining, ticket)
+	}
+	s.waiting = remaining
+}
+
+// free releases the slot of a started job, the lock must be held
+func (s *jobScheduler) free(ticket *schedulerTicket) {
+	s.running--
+	delete(s.busyDirs, ticket.dir)
+}
+
+// remove drops a waiting job from the queue, the lock must be held
+func (s *jobScheduler) remove(ticket *schedulerTicket) {
+	for i, waiting := range s.waiting {
+		if waiting == ticket {
+			s.waiting = append(s.waiting[:i], s.waiting[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/izzddalfk/kumote/internal/assistant/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (q *fakeQueueStore) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.jobs)
+}
+
+func TestSchedulerSerializesJobsPerProject(t *testing.T) {
+	ts := newTestService(t)
+	ts.agents["claude"].blocking = true
+
+	ts.send(t, "run the tests in carlogbook")
+	waitFor(t, ts.agents["claude"].inputs)
+
+	// the second job waits for the first one in the same project
+	ts.send(t, "now fix the failing test in carlogbook")
+	assert.Contains(t, ts.lastMessage(t), "Job 2 is queued at position 1")
+	assert.Empty(t, ts.agents["claude"].inputs)
+	assert.Equal(t, 1, ts.queue.len(), "the queued job should be persisted")
+
+	ts.send(t, "/cancel 1")
+	waitFor(t, ts.metrics.metrics)
+
+	input := waitFor(t, ts.agents["claude"].inputs)
+	assert.Equal(t, "now fix the failing test in carlogbook", input.Prompt)
+	assert.Equal(t, 0, ts.queue.len(), "started jobs are not queued anymore")
+
+	ts.send(t, "/cancel 2")
+	waitFor(t, ts.metrics.metrics)
+}
+
+func TestSchedulerLimitsConcurrentJobs(t *testing.T) {
+	ts := newTestService(t)
+	ts.agents["claude"].blocking = true
+
+	sendFor := func(project string) {
+		ts.scanner.mu.Lock()
+		ts.scanner.matches = []core.ProjectMatch{{Name: project, Path: "/projects/" + project, Score: 1}}
+		ts.scanner.mu.Unlock()
+		ts.send(t, "run the tests in "+project)
+	}
+
+	// jobs of different projects run side by side, up to the default limit
+	sendFor("carlogbook")
+	sendFor("taqwaboard")
+	dirs := []string{
+		waitFor(t, ts.agents["claude"].inputs).ExecutionContext.WorkingDir,
+		waitFor(t, ts.agents["claude"].inputs).ExecutionContext.WorkingDir,
+	}
+	assert.ElementsMatch(t, []string{"/projects/carlogbook", "/projects/taqwaboard"}, dirs)
+
+	sendFor("kumote")
+	assert.Contains(t, ts.lastMessage(t), "Job 3 is queued at position 1")
+
+	// cancelling a queued job drops it from the queue
+	ts.send(t, "/cancel 3")
+	assert.Eventually(t, func() bool { return ts.queue.len() == 0 }, 5*time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		return ts.lastMessage(t) == "🛑 Job 3 was cancelled before it started."
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Empty(t, ts.agents["claude"].inputs)
+
+	ts.send(t, "/cancel 1")
+	ts.send(t, "/cancel 2")
+	waitFor(t, ts.metrics.metrics)
+	waitFor(t, ts.metrics.metrics)
+}
+
+func TestSchedulerResumesQueuedJobsAfterRestart(t *testing.T) {
+	queue := &fakeQueueStore{}
+	journal := &fakeJournal{}
+	before := newTestServiceWithStores(t, queue, journal)
+	// created up front, the stores must not change while the service is created
+	after := newTestServiceWithStores(t, queue, journal)
+	before.agents["claude"].blocking = true
+
+	before.send(t, "run the tests in carlogbook")
+	waitFor(t, before.agents["claude"].inputs)
+	before.send(t, "now fix the failing test in carlogbook")
+	require.Equal(t, 1, queue.len())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.NoError(t, before.service.Shutdown(ctx), "the running job should be cancelled")
+	assert.Equal(t, 1, queue.len(), "the queued job should stay persisted on shutdown")
+	assert.Empty(t, before.agents["claude"].inputs)
+
+	require.NoError(t, after.service.ResumeQueuedJobs(context.Background()))
+
+	input := waitFor(t, after.agents["claude"].inputs)
+	assert.Equal(t, "now fix the failing test in carlogbook", input.Prompt)
+	assert.Equal(t, after.scanner.path, input.ExecutionContext.WorkingDir)
+	waitFor(t, after.metrics.metrics)
+	assert.Equal(t, 0, queue.len())
+	assert.Equal(t, core.CommandStatusCancelled, journal.status(1))
+	assert.Eventually(t, func() bool {
+		return journal.status(2) == core.CommandStatusDone
+	}, 5*time.Second, 10*time.Millisecond, "the resumed job should keep its journal entry")
+
+	after.telegram.mu.Lock()
+	defer after.telegram.mu.Unlock()
+	require.NotEmpty(t, after.telegram.messages)
+	assert.Contains(t, after.telegram.messages[0].Message, "resuming your queued request in mycar-logbook")
+}
+
+func TestSchedulerInterruptsQueuedJobsThatCantBePersisted(t *testing.T) {
+	journal := &fakeJournal{}
+	ts := newTestServiceWithStores(t, &fakeQueueStore{err: errors.New("database is locked")}, journal)
+	ts.agents["claude"].blocking = true
+
+	ts.send(t, "run the tests in carlogbook")
+	waitFor(t, ts.agents["claude"].inputs)
+	ts.send(t, "now fix the failing test in carlogbook")
+	assert.Contains(t, ts.lastMessage(t), "Job 2 is queued at position 1")
+	assert.Equal(t, core.CommandStatusAccepted, journal.status(2),
+		"the job isn't resumed after a restart, so it must be interrupted")
+
+	interrupted, err := journal.InterruptCommands(context.Background())
+	require.NoError(t, err)
+	require.Len(t, interrupted, 2, "both the running and the queued job should be interrupted")
+	assert.Equal(t, int64(2), interrupted[1].ID)
+
+	ts.send(t, "/cancel 2")
+	ts.send(t, "/cancel 1")
+	waitFor(t, ts.metrics.metrics)
+	waitFor(t, ts.metrics.metrics)
+}
@@ -2,30 +2,65 @@ package core
 
 import (
 	"context"
+	"crypto/rand"
+	"errors"
 	"fmt"
 	"log/slog"
+	"regexp"
+	"strings"
 	"time"
 
 	"gopkg.in/validator.v2"
 )
 
+// agentPrefixPattern matches messages starting with `@agent` followed by the prompt
+var agentPrefixPattern = regexp.MustCompile(`(?s)^@([A-Za-z][\w-]*)\s+(.+)$`)
+
 // Service implements the AssistantService interface
 type Service struct {
-	agent            Agent
+	agents           AgentRegistry
 	telegram         TelegramStorage
 	rateLimiter      RateLimiter
 	userRepo         UserRepository
 	projectScanner   ProjectScanner
 	metricsCollector MetricsCollector
+	metricsReporter  MetricsReporter
+	sessions         SessionStore
+	projectChoices   *pendingStore[pendingProjectChoice]
+	transcriber      Transcriber
+	voiceTranscripts *pendingStore[pendingTranscript]
+	callbacks        *callbackDispatcher
+	commands         *commandRouter
+	jobs             *jobManager
+	scheduler        *jobScheduler
+	queue            QueueStore
+	journal          CommandJournal
+	updates          *updateDeduplicator
+	budget           UsageBudget
+	startedAt        time.Time
+
+	sessionIdleTimeout     time.Duration
+	progressUpdateInterval time.Duration
 }
 
 type ServiceConfig struct {
-	Agent            Agent            `validate:"nonnil"`
+	Agents           AgentRegistry    `validate:"nonnil"`
 	Telegram         TelegramStorage  `validate:"nonnil"`
 	RateLimiter      RateLimiter      `validate:"nonnil"`
 	UserRepo         UserRepository   `validate:"nonnil"`
 	ProjectScanner   ProjectScanner   `validate:"nonnil"`
 	MetricsCollector MetricsCollector `validate:"nonnil"`
+	MetricsReporter  MetricsReporter  `validate:"nonnil"`
+	Sessions         SessionStore     `validate:"nonnil"`
+	Queue            QueueStore       `validate:"nonnil"`
+	Journal          CommandJournal   `validate:"nonnil"`
+	Transcriber      Transcriber      // Optional, voice messages are declined without it
+
+	SessionIdleTimeout     time.Duration // Sessions idle for longer than this start a new conversation
+	MaxConcurrentJobs      int           // How many agent jobs run at the same time, one per project at most
+	ProgressUpdateInterval time.Duration // Minimum time between edits of the progress message
+	CallbackSecret         []byte        // Key signing the callback data of buttons, a random one is generated when empty
+	Budget                 UsageBudget   // Daily and monthly limits of the agent usage of every user, unlimited by default
 }
 
 // NewService creates a new assistant service with all dependencies
@@ -33,22 +68,84 @@ func NewService(config ServiceConfig) (*Service, error) {
 	if err := validator.Validate(config); err != nil {
 		return nil, fmt.Errorf("invalid service configuration: %w", err)
 	}
-	return &Service{
-		agent:            config.Agent,
-		telegram:         config.Telegram,
-		rateLimiter:      config.RateLimiter,
-		userRepo:         config.UserRepo,
-		projectScanner:   config.ProjectScanner,
-		metricsCollector: config.MetricsCollector,
-	}, nil
+
+	sessionIdleTimeout := DefaultSessionIdleTimeout
+	if config.SessionIdleTimeout > 0 {
+		sessionIdleTimeout = config.SessionIdleTimeout
+	}
+
+	progressUpdateInterval := DefaultProgressUpdateInterval
+	if config.ProgressUpdateInterval > 0 {
+		progressUpdateInterval = config.ProgressUpdateInterval
+	}
+
+	maxConcurrentJobs := DefaultMaxConcurrentJobs
+	if config.MaxConcurrentJobs > 0 {
+		maxConcurrentJobs = config.MaxConcurrentJobs
+	}
+
+	callbackSecret := config.CallbackSecret
+	if len(callbackSecret) == 0 {
+		// buttons sent before a restart stop working, which is fine for short-lived choices
+		callbackSecret = make([]byte, 32)
+		if _, err := rand.Read(callbackSecret); err != nil {
+			return nil, fmt.Errorf("failed to generate callback secret: %w", err)
+		}
+	}
+
+	service := &Service{
+		agents:             config.Agents,
+		telegram:           config.Telegram,
+		rateLimiter:        config.RateLimiter,
+		userRepo:           config.UserRepo,
+		projectScanner:     config.ProjectScanner,
+		metricsCollector:   config.MetricsCollector,
+		metricsReporter:    config.MetricsReporter,
+		sessions:           config.Sessions,
+		projectChoices:     newPendingStore[pendingProjectChoice](),
+		transcriber:        config.Transcriber,
+		voiceTranscripts:   newPendingStore[pendingTranscript](),
+		callbacks:          newCallbackDispatcher(callbackSecret),
+		commands:           newCommandRouter(),
+		jobs:               newJobManager(),
+		scheduler:          newJobScheduler(maxConcurrentJobs),
+		queue:              config.Queue,
+		journal:            config.Journal,
+		updates:            newUpdateDeduplicator(updateDedupTTL, maxDedupUpdates),
+		budget:             config.Budget,
+		startedAt:          time.Now(),
+		sessionIdleTimeout: sessionIdleTimeout,
+
+		progressUpdateInterval: progressUpdateInterval,
+	}
+	service.callbacks.register(projectChoiceCallbackAction, service.handleProjectChoice)
+	service.callbacks.register(retryCallbackAction, service.handleRetry)
+	service.callbacks.register(voiceCallbackAction, service.handleVoiceTranscript)
+	service.registerCommands()
+
+	return service, nil
 }
 
-// ProcessCommand processes a user command and returns the result
+// ProcessCommand processes a user command and returns the result. A command from
+// a Telegram update that was already processed returns the original result.
 func (s *Service) ProcessCommand(ctx context.Context, cmd Command) (*QueryResult, error) {
+	result, duplicate, err := s.updates.do(ctx, cmd.UpdateID, func() (*QueryResult, error) {
+		return s.processCommand(ctx, cmd)
+	})
+	if duplicate {
+		slog.InfoContext(ctx, "Ignored redelivered update",
+			slog.Int64("update_id", cmd.UpdateID),
+			slog.String("command_id", cmd.ID))
+	}
+	return result, err
+}
+
+func (s *Service) processCommand(ctx context.Context, cmd Command) (*QueryResult, error) {
 	startTime := time.Now()
 
 	// Check rate limit
 	if !s.rateLimiter.IsAllowed(ctx, cmd.UserID) {
+		s.recordMetrics(ctx, cmd, startTime, commandOutcome{err: ErrRateLimitExceeded, prompt: cmd.Text})
 		result := &QueryResult{
 			Success: false,
 			Error:   "Rate limit exceeded. Please try again later.",
@@ -75,6 +172,7 @@ func (s *Service) ProcessCommand(ctx context.Context, cmd Command) (*QueryResult
 	}
 
 	if !user.IsAllowed {
+		s.recordMetrics(ctx, cmd, startTime, commandOutcome{err: ErrUserNotAuthorized, prompt: cmd.Text})
 		result := &QueryResult{
 			Success: false,
 			Error:   "You are not authorized to use this assistant.",
@@ -82,27 +180,111 @@ func (s *Service) ProcessCommand(ctx context.Context, cmd Command) (*QueryResult
 		return result, nil
 	}
 
+	// voice messages run once the user confirms their transcript, which is journaled instead
+	if cmd.Voice != nil {
+		return s.transcribeVoice(ctx, cmd, startTime)
+	}
+
+	// journal the accepted command, so it can be retried if Kumote stops before it's done
+	journalID := s.recordCommand(ctx, cmd)
+
+	// built-in commands like `/help` are answered without invoking an agent,
+	// any other slash command is left to the agent
+	if handler, args, ok := s.commands.route(cmd.Text); ok {
+		result, err := handler(ctx, cmd, args)
+		s.completeCommand(ctx, journalID, err)
+		s.recordMetrics(ctx, cmd, startTime, commandOutcome{err: err, prompt: cmd.Text})
+		return result, err
+	}
+
+	// "refresh projects" rebuilds the project index
+	if commandIntent(cmd.Text) == IntentRefresh {
+		result, err := s.refreshProjects(ctx, cmd, "")
+		s.completeCommand(ctx, journalID, err)
+		s.recordMetrics(ctx, cmd, startTime, commandOutcome{err: err, prompt: cmd.Text})
+		return result, err
+	}
+
+	// agents don't run for users who used up their budget
+	if exceeded := s.exceededBudget(ctx, cmd.UserID); exceeded != nil {
+		message, err := exceeded.decline()
+		s.sendMessage(ctx, cmd.ReplyChatID(), message)
+		s.completeCommand(ctx, journalID, err)
+		s.recordMetrics(ctx, cmd, startTime, commandOutcome{err: err, prompt: cmd.Text})
+		return &QueryResult{
+			Success: false,
+			Error:   message,
+		}, nil
+	}
+
+	// pick the agent from the optional `@agent` prefix
+	agentName, agent, prompt := s.selectAgent(ctx, cmd.Text)
+	request := agentRequest{
+		cmd:       cmd,
+		agentName: agentName,
+		agent:     agent,
+		prompt:    prompt,
+		startTime: startTime,
+		journalID: journalID,
+	}
+	current := s.currentProject(ctx, cmd.ReplyChatID())
+
 	// use project index scanner to determine the working directory
-	projectPath, err := s.projectScanner.GetProjectDirectory(cmd.Text)
+	matches, err := s.projectScanner.FindProjects(prompt)
 	if err != nil {
-		slog.ErrorContext(ctx, fmt.Sprintf("failed to get project directory: %s", err.Error()),
-			slog.String("query", cmd.Text),
-			slog.Int64("user_id", cmd.UserID))
+		if !errors.Is(err, ErrProjectNotFound) {
+			slog.ErrorContext(ctx, fmt.Sprintf("failed to get project directory: %s", err.Error()),
+				slog.String("query", cmd.Text),
+				slog.Int64("user_id", cmd.UserID))
+		}
+		// follow-ups that don't name a project continue in the current one
+		if current != nil {
+			return s.startAgentJob(ctx, request, ProjectMatch{Name: current.Name, Path: current.Path})
+		}
 		// Just send to Telegram that the project folder not found and ignore the error
-		s.telegram.SendTextMessage(ctx, TelegramTextMessageInput{
-			ChatID:  cmd.UserID,
-			Message: "Project folder not found. Please add more specific project name in your query.",
-		})
+		s.sendMessage(ctx, cmd.ReplyChatID(), "Project folder not found. Please add more specific project name in your query, or set one with /project <name>.")
+		s.completeCommand(ctx, journalID, nil)
+		s.recordMetrics(ctx, cmd, startTime, commandOutcome{err: ErrProjectNotFound, agentName: agentName, prompt: prompt})
 		return &QueryResult{
 			Success:  true,
 			Response: "Your request is being processed.",
 		}, nil
 	}
 
+	// let the user choose when the query matches several projects equally well,
+	// unless one of them is the current project
+	if candidates := ambiguousMatches(matches); len(candidates) > 1 {
+		for _, candidate := range candidates {
+			if current != nil && candidate.Path == current.Path {
+				return s.startAgentJob(ctx, request, candidate)
+			}
+		}
+		// the metrics are recorded once the job in the chosen project is done
+		return s.askForProject(ctx, cmd, &request, candidates)
+	}
+
+	return s.startAgentJob(ctx, request, matches[0])
+}
+
+// agentRequest is a command ready to be sent to an agent once its project is known
+type agentRequest struct {
+	cmd       Command
+	agentName string
+	agent     Agent
+	prompt    string
+	startTime time.Time
+	journalID int64 // Entry of the command in the command journal, 0 when it isn't journaled
+}
+
+// startAgentJob runs the agent for the request in the project directory in the background
+// and makes the project the current one of the chat
+func (s *Service) startAgentJob(ctx context.Context, request agentRequest, project ProjectMatch) (*QueryResult, error) {
+	cmd := request.cmd
+
 	// Create execution context
 	execCtx := ExecutionContext{
 		UserID:      cmd.UserID,
-		WorkingDir:  projectPath,
+		WorkingDir:  project.Path,
 		Timeout:     600 * time.Second,
 		Environment: make(map[string]string),
 	}
@@ -111,48 +293,140 @@ func (s *Service) ProcessCommand(ctx context.Context, cmd Command) (*QueryResult
 		slog.WarnContext(ctx, "Working directory not found for command execution",
 			slog.String("command_id", cmd.ID),
 			slog.Int64("user_id", cmd.UserID))
-		return nil, fmt.Errorf("working directory not found for command execution")
+		err := fmt.Errorf("%w: working directory not found for command execution", ErrProjectNotFound)
+		s.completeCommand(ctx, request.journalID, err)
+		s.recordMetrics(ctx, cmd, request.startTime, commandOutcome{err: err, agentName: request.agentName, prompt: request.prompt})
+		return nil, err
+	}
+
+	s.rememberProject(ctx, cmd.ReplyChatID(), project)
+
+	// Continue the previous conversation of the chat for this project, if any
+	sessionID := cmd.SessionID
+	if sessionID == nil {
+		sessionID = s.resumableSessionID(ctx, cmd.ReplyChatID(), execCtx.WorkingDir, request.agentName)
 	}
 
 	// Return early with a success response to the webhook
-	// Create a copy of the context that won't be canceled when the request completes
-	bgCtx, cancel := context.WithTimeout(context.Background(), execCtx.Timeout)
+	// Create a context that won't be canceled when the request completes, only by `/cancel`
+	// or the shutdown. The timeout only starts once the job leaves the queue.
+	jobCtx, cancelJob := context.WithCancelCause(context.Background())
+
+	job, err := s.jobs.add(Job{
+		CommandID: cmd.ID,
+		UserID:    cmd.UserID,
+		ChatID:    cmd.ReplyChatID(),
+		Project:   project.Name,
+		AgentName: request.agentName,
+		Prompt:    request.prompt,
+	}, cancelJob)
+	if err != nil {
+		cancelJob(err)
+		s.completeCommand(ctx, request.journalID, err)
+		s.recordMetrics(ctx, cmd, request.startTime, commandOutcome{
+			err:       err,
+			project:   project.Name,
+			agentName: request.agentName,
+			prompt:    request.prompt,
+		})
+		message := "🛑 Kumote is shutting down, please send your message again in a moment."
+		s.sendMessage(ctx, cmd.ReplyChatID(), message)
+		return &QueryResult{
+			Success: false,
+			Error:   message,
+		}, nil
+	}
+
+	// Wait for the other jobs in the same project, the queued job is persisted
+	// so it's resumed after a restart
+	ticket, position := s.scheduler.enqueue(execCtx.WorkingDir)
+	var queued *QueuedJob
+	commandStatus := CommandStatusRunning
+	if position > 0 {
+		// A job that can't be persisted isn't resumed after a restart, it stays accepted
+		// so it's interrupted and offered to retry instead
+		commandStatus = CommandStatusAccepted
+		if queued = s.queueJob(ctx, job, request, project); queued != nil {
+			commandStatus = CommandStatusQueued
+		}
+	}
+	s.updateCommand(ctx, request.journalID, JournalEntry{
+		Status:    commandStatus,
+		AgentName: request.agentName,
+		Project:   project.Name,
+	})
+	if position > 0 {
+		s.sendMessage(ctx, cmd.ReplyChatID(), fmt.Sprintf(
+			"🕒 Job %s is queued at position %d, it starts once the jobs before it are done. Send /cancel %s to drop it.",
+			job.ID, position, job.ID))
+	}
 
 	// Process the command to AI assistant asynchronously in a goroutine
 	go func() {
-		defer cancel()
-		// Process the command to AI assistant
-		result, err := s.agent.ExecuteCommand(bgCtx, AgentCommandInput{
-			Prompt:           cmd.Text,
-			ExecutionContext: execCtx,
-			SessionID:        cmd.SessionID, // Pass session ID if available
-		})
-		if err != nil {
-			slog.ErrorContext(bgCtx, "Failed to process command asynchronously",
-				slog.String("command_id", cmd.ID),
-				slog.Int64("user_id", cmd.UserID),
-				slog.String("error", err.Error()))
-			s.recordMetrics(bgCtx, cmd, startTime, false, "")
+		defer cancelJob(nil)
+		reportCtx := context.WithoutCancel(jobCtx)
+
+		if err := s.scheduler.wait(jobCtx, ticket); err != nil {
+			s.jobs.setStatus(job.ID, JobStatusCancelled)
+			// queued jobs are resumed after the restart
+			if errors.Is(err, ErrShuttingDown) {
+				return
+			}
+			s.updateCommand(reportCtx, request.journalID, JournalEntry{Status: CommandStatusCancelled})
+			s.recordMetrics(reportCtx, cmd, request.startTime, commandOutcome{
+				err:       err,
+				project:   project.Name,
+				agentName: request.agentName,
+				prompt:    request.prompt,
+			})
+			s.dequeueJob(reportCtx, queued)
+			s.sendMessage(reportCtx, cmd.ReplyChatID(), fmt.Sprintf("🛑 Job %s was cancelled before it started.", job.ID))
 			return
 		}
+		defer s.scheduler.done(ticket)
+		s.dequeueJob(reportCtx, queued)
 
-		// Send the AI assistant's response via Telegram
-		if err := s.telegram.SendTextMessage(bgCtx, TelegramTextMessageInput{
-			ChatID:  cmd.UserID,
-			Message: result.Response,
-		}); err != nil {
-			slog.ErrorContext(bgCtx, "Failed to send Telegram message",
-				slog.String("command_id", cmd.ID),
-				slog.Int64("user_id", cmd.UserID),
-				slog.String("error", err.Error()))
+		// the budget may have been used up while the job waited for its turn or its project
+		if exceeded := s.exceededBudget(reportCtx, cmd.UserID); exceeded != nil {
+			message, err := exceeded.decline()
+			s.jobs.setStatus(job.ID, JobStatusFailed)
+			s.completeCommand(reportCtx, request.journalID, err)
+			s.recordMetrics(reportCtx, cmd, request.startTime, commandOutcome{
+				err:       err,
+				project:   project.Name,
+				agentName: request.agentName,
+				prompt:    request.prompt,
+			})
+			s.sendMessage(reportCtx, cmd.ReplyChatID(), message)
+			return
 		}
 
-		slog.DebugContext(bgCtx, "Command processed successfully in background",
-			slog.String("command_id", cmd.ID),
-			slog.String("result", result.Response))
+		runCtx, cancelTimeout := context.WithTimeoutCause(jobCtx, execCtx.Timeout, ErrCommandTimeout)
+		defer cancelTimeout()
 
-		// Record metrics
-		s.recordMetrics(bgCtx, cmd, startTime, result.Success, "")
+		s.jobs.setStatus(job.ID, JobStatusRunning)
+		if position > 0 {
+			s.updateCommand(reportCtx, request.journalID, JournalEntry{Status: CommandStatusRunning})
+		}
+		status, err := s.runAgentJob(runCtx, agentJob{
+			id:          job.ID,
+			cmd:         cmd,
+			agentName:   request.agentName,
+			agent:       request.agent,
+			prompt:      request.prompt,
+			projectName: project.Name,
+			execCtx:     execCtx,
+			sessionID:   sessionID,
+			startTime:   request.startTime,
+			journalID:   request.journalID,
+		})
+		s.jobs.setStatus(job.ID, status)
+
+		entry := JournalEntry{Status: CommandStatus(status)}
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		s.updateCommand(reportCtx, request.journalID, entry)
 	}()
 
 	// Return immediate success response
@@ -162,20 +436,37 @@ func (s *Service) ProcessCommand(ctx context.Context, cmd Command) (*QueryResult
 	}, nil
 }
 
-// recordMetrics records command execution metrics
-func (s *Service) recordMetrics(ctx context.Context, cmd Command, startTime time.Time, success bool, projectUsed string) {
-	metrics := CommandMetrics{
-		CommandID:     cmd.ID,
-		UserID:        cmd.UserID,
-		ExecutionTime: time.Since(startTime),
-		Success:       success,
-		ProjectUsed:   projectUsed,
-		Timestamp:     time.Now(),
+// selectAgent picks the agent requested with an `@agent` prefix, e.g. "@gemini what changed in carlogbook",
+// and returns the prompt without the prefix. Unknown names fall back to the default agent
+// and keep the text untouched since the prefix might be part of the prompt itself.
+func (s *Service) selectAgent(ctx context.Context, text string) (string, Agent, string) {
+	defaultName, defaultAgent := s.agents.DefaultAgent()
+
+	matches := agentPrefixPattern.FindStringSubmatch(text)
+	if matches == nil {
+		return defaultName, defaultAgent, text
 	}
 
-	if err := s.metricsCollector.RecordCommandExecution(ctx, metrics); err != nil {
-		slog.WarnContext(ctx, "Failed to record metrics",
-			slog.String("command_id", cmd.ID),
+	name := strings.ToLower(matches[1])
+	agent, ok := s.agents.GetAgent(name)
+	if !ok {
+		slog.DebugContext(ctx, "Unknown agent prefix, using default agent",
+			slog.String("requested_agent", name),
+			slog.String("default_agent", defaultName))
+		return defaultName, defaultAgent, text
+	}
+
+	return name, agent, matches[2]
+}
+
+// sendMessage sends a reply to the chat, failures are just logged
+func (s *Service) sendMessage(ctx context.Context, chatID int64, message string) {
+	if _, err := s.telegram.SendTextMessage(ctx, TelegramTextMessageInput{
+		ChatID:  chatID,
+		Message: message,
+	}); err != nil {
+		slog.ErrorContext(ctx, "Failed to send Telegram message",
+			slog.Int64("chat_id", chatID),
 			slog.String("error", err.Error()))
 	}
 }
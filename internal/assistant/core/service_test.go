@@ -0,0 +1,912 @@
+package core_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/izzddalfk/kumote/internal/assistant/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAgent sends every input it receives to the inputs channel
+type fakeAgent struct {
+	inputs    chan core.AgentCommandInput
+	response  string
+	sessionID string
+	// blocking makes the agent run until its context is cancelled
+	blocking bool
+	// err fails the runs with the error, failure makes the agent report the failure in the result
+	err     error
+	failure string
+	// metadata is returned with the results, e.g. the cost of the run
+	metadata map[string]any
+}
+
+func newFakeAgent(response string) *fakeAgent {
+	return &fakeAgent{inputs: make(chan core.AgentCommandInput, 10), response: response}
+}
+
+func (a *fakeAgent) ExecuteCommand(ctx context.Context, input core.AgentCommandInput) (*core.QueryResult, error) {
+	a.inputs <- input
+	if a.blocking {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if a.err != nil {
+		return nil, a.err
+	}
+	if a.failure != "" {
+		return &core.QueryResult{Success: false, Error: a.failure, SessionID: a.sessionID}, nil
+	}
+	return &core.QueryResult{Success: true, Response: a.response, SessionID: a.sessionID, Metadata: a.metadata}, nil
+}
+
+func (a *fakeAgent) ExecuteCommandStream(ctx context.Context, input core.AgentCommandInput, onEvent func(core.AgentEvent)) (*core.QueryResult, error) {
+	onEvent(core.AgentEvent{Type: core.AgentEventToolUse, Text: "Read: main.go"})
+	return a.ExecuteCommand(ctx, input)
+}
+
+func (a *fakeAgent) IsAvailable(ctx context.Context) bool { return true }
+
+type fakeAgentRegistry struct {
+	agents       map[string]core.Agent
+	defaultAgent string
+}
+
+func (r *fakeAgentRegistry) GetAgent(name string) (core.Agent, bool) {
+	agent, ok := r.agents[name]
+	return agent, ok
+}
+
+func (r *fakeAgentRegistry) DefaultAgent() (string, core.Agent) {
+	return r.defaultAgent, r.agents[r.defaultAgent]
+}
+
+type fakeTelegram struct {
+	mu       sync.Mutex
+	messages []core.TelegramTextMessageInput
+	edits    []core.TelegramEditMessageInput
+	answers  []core.TelegramAnswerCallbackInput
+	commands []core.BotCommand
+	files    map[string][]byte // files that can be downloaded, by file ID
+}
+
+func (t *fakeTelegram) SendTextMessage(ctx context.Context, input core.TelegramTextMessageInput) (int64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.messages = append(t.messages, input)
+	return int64(len(t.messages)), nil
+}
+
+func (t *fakeTelegram) EditTextMessage(ctx context.Context, input core.TelegramEditMessageInput) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.edits = append(t.edits, input)
+	return nil
+}
+
+func (t *fakeTelegram) AnswerCallbackQuery(ctx context.Context, input core.TelegramAnswerCallbackInput) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.answers = append(t.answers, input)
+	return nil
+}
+
+func (t *fakeTelegram) SetMyCommands(ctx context.Context, commands []core.BotCommand) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.commands = commands
+	return nil
+}
+
+func (t *fakeTelegram) DownloadFile(ctx context.Context, fileID string) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	content, ok := t.files[fileID]
+	if !ok {
+		return nil, fmt.Errorf("file %s not found", fileID)
+	}
+	return content, nil
+}
+
+type fakeRateLimiter struct{}
+
+func (fakeRateLimiter) IsAllowed(ctx context.Context, userID int64) bool      { return true }
+func (fakeRateLimiter) RecordRequest(ctx context.Context, userID int64) error { return nil }
+
+// allowedUserID is the only user allowed by fakeUserRepository
+const allowedUserID = 42
+
+type fakeUserRepository struct{}
+
+func (fakeUserRepository) GetUser(ctx context.Context, userID int64) (*core.User, error) {
+	return &core.User{ID: userID, IsAllowed: userID == allowedUserID}, nil
+}
+
+func (fakeUserRepository) IsUserAllowed(ctx context.Context, userID int64) bool {
+	return userID == allowedUserID
+}
+
+// fakeProjectScanner resolves every query to the same directory, or to the configured
+// matches, and remembers the last query
+type fakeProjectScanner struct {
+	mu        sync.Mutex
+	lastQuery string
+	path      string
+	matches   []core.ProjectMatch
+	refreshes int
+}
+
+func (p *fakeProjectScanner) FindProjects(query string) ([]core.ProjectMatch, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastQuery = query
+	if p.matches != nil {
+		if len(p.matches) == 0 {
+			return nil, core.ErrProjectNotFound
+		}
+		return p.matches, nil
+	}
+	return []core.ProjectMatch{{Name: "mycar-logbook", Path: p.path, Score: 1}}, nil
+}
+
+func (p *fakeProjectScanner) ListProjects(ctx context.Context) ([]core.Project, error) {
+	return []core.Project{{Name: "mycar-logbook", Path: p.path, Aliases: []string{"car"}}}, nil
+}
+
+func (p *fakeProjectScanner) RefreshProjects(ctx context.Context) ([]core.Project, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.refreshes++
+	return []core.Project{{Name: "mycar-logbook", Path: p.path, Aliases: []string{"car"}, TechStack: []string{"docker", "go"}}}, nil
+}
+
+// fakeMetricsCollector keeps every recorded metrics, the ones of commands that reached
+// a project are also sent to the metrics channel to wait for background jobs
+type fakeMetricsCollector struct {
+	mu       sync.Mutex
+	recorded []core.CommandMetrics
+	metrics  chan core.CommandMetrics
+	report   core.MetricsReport // returned by every report
+	since    time.Time          // start of the last reported period
+}
+
+func (m *fakeMetricsCollector) RecordCommandExecution(ctx context.Context, metrics core.CommandMetrics) error {
+	m.mu.Lock()
+	m.recorded = append(m.recorded, metrics)
+	m.mu.Unlock()
+	if metrics.ProjectUsed != "" {
+		m.metrics <- metrics
+	}
+	return nil
+}
+
+// last returns the last recorded metrics
+func (m *fakeMetricsCollector) last(t *testing.T) core.CommandMetrics {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	require.NotEmpty(t, m.recorded)
+	return m.recorded[len(m.recorded)-1]
+}
+
+func (m *fakeMetricsCollector) ReportCommandMetrics(ctx context.Context, since, until time.Time) (*core.MetricsReport, error) {
+	m.since = since
+	report := m.report
+	return &report, nil
+}
+
+func (m *fakeMetricsCollector) GetUserUsage(ctx context.Context, userID int64, since time.Time) (*core.Usage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var usage core.Usage
+	for _, metrics := range m.recorded {
+		if metrics.UserID == userID && !metrics.Timestamp.Before(since) {
+			usage.CostUSD += metrics.CostUSD
+			usage.InputTokens += metrics.InputTokens
+			usage.OutputTokens += metrics.OutputTokens
+		}
+	}
+	return &usage, nil
+}
+
+// fakeSessionStore keeps sessions and chat projects in memory
+type fakeSessionStore struct {
+	mu       sync.Mutex
+	sessions map[int64]map[string]core.Session
+	projects map[int64]core.ChatProject
+}
+
+func newFakeSessionStore() *fakeSessionStore {
+	return &fakeSessionStore{
+		sessions: make(map[int64]map[string]core.Session),
+		projects: make(map[int64]core.ChatProject),
+	}
+}
+
+func (f *fakeSessionStore) GetSession(ctx context.Context, chatID int64, project string) (*core.Session, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	session, ok := f.sessions[chatID][project]
+	if !ok {
+		return nil, nil
+	}
+	return &session, nil
+}
+
+func (f *fakeSessionStore) SaveSession(ctx context.Context, session core.Session) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.sessions[session.ChatID] == nil {
+		f.sessions[session.ChatID] = make(map[string]core.Session)
+	}
+	f.sessions[session.ChatID][session.Project] = session
+	return nil
+}
+
+func (f *fakeSessionStore) DeleteSession(ctx context.Context, chatID int64, project string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.sessions[chatID], project)
+	return nil
+}
+
+func (f *fakeSessionStore) DeleteSessions(ctx context.Context, chatID int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.sessions, chatID)
+	return nil
+}
+
+func (f *fakeSessionStore) GetChatProject(ctx context.Context, chatID int64) (*core.ChatProject, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	project, ok := f.projects[chatID]
+	if !ok {
+		return nil, nil
+	}
+	return &project, nil
+}
+
+func (f *fakeSessionStore) SaveChatProject(ctx context.Context, project core.ChatProject) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.projects[project.ChatID] = project
+	return nil
+}
+
+// fakeQueueStore keeps queued jobs in memory
+type fakeQueueStore struct {
+	mu   sync.Mutex
+	jobs []core.QueuedJob
+	err  error // fails the saves
+}
+
+func (f *fakeQueueStore) SaveQueuedJob(ctx context.Context, job core.QueuedJob) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.jobs = append(f.jobs, job)
+	return nil
+}
+
+func (f *fakeQueueStore) DeleteQueuedJob(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, job := range f.jobs {
+		if job.ID == id {
+			f.jobs = append(f.jobs[:i], f.jobs[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (f *fakeQueueStore) ListQueuedJobs(ctx context.Context) ([]core.QueuedJob, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]core.QueuedJob(nil), f.jobs...), nil
+}
+
+// fakeJournal keeps journaled commands in memory
+type fakeJournal struct {
+	mu      sync.Mutex
+	entries []core.JournalEntry
+}
+
+func (f *fakeJournal) RecordCommand(ctx context.Context, entry core.JournalEntry) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	entry.ID = int64(len(f.entries) + 1)
+	f.entries = append(f.entries, entry)
+	return entry.ID, nil
+}
+
+func (f *fakeJournal) UpdateCommand(ctx context.Context, entry core.JournalEntry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stored := &f.entries[entry.ID-1]
+	stored.Status = entry.Status
+	if entry.AgentName != "" {
+		stored.AgentName = entry.AgentName
+	}
+	if entry.Project != "" {
+		stored.Project = entry.Project
+	}
+	if entry.Error != "" {
+		stored.Error = entry.Error
+	}
+	stored.UpdatedAt = entry.UpdatedAt
+	return nil
+}
+
+func (f *fakeJournal) GetCommand(ctx context.Context, id int64) (*core.JournalEntry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if id < 1 || id > int64(len(f.entries)) {
+		return nil, nil
+	}
+	entry := f.entries[id-1]
+	return &entry, nil
+}
+
+func (f *fakeJournal) ListCommands(ctx context.Context, chatID int64, limit int) ([]core.JournalEntry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var entries []core.JournalEntry
+	for i := len(f.entries) - 1; i >= 0 && len(entries) < limit; i-- {
+		if f.entries[i].ChatID == chatID {
+			entries = append(entries, f.entries[i])
+		}
+	}
+	return entries, nil
+}
+
+func (f *fakeJournal) InterruptCommands(ctx context.Context) ([]core.JournalEntry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var interrupted []core.JournalEntry
+	for i, entry := range f.entries {
+		switch entry.Status {
+		case core.CommandStatusAccepted, core.CommandStatusWaiting, core.CommandStatusRunning:
+			f.entries[i].Status = core.CommandStatusInterrupted
+			interrupted = append(interrupted, f.entries[i])
+		}
+	}
+	return interrupted, nil
+}
+
+// status returns the journaled status of the entry
+func (f *fakeJournal) status(id int64) core.CommandStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.entries[id-1].Status
+}
+
+type testService struct {
+	service  *core.Service
+	agents   map[string]*fakeAgent
+	scanner  *fakeProjectScanner
+	metrics  *fakeMetricsCollector
+	sessions *fakeSessionStore
+	queue    *fakeQueueStore
+	journal  *fakeJournal
+	telegram *fakeTelegram
+}
+
+func newTestService(t *testing.T) *testService {
+	t.Helper()
+	return newTestServiceWithStores(t, &fakeQueueStore{}, &fakeJournal{})
+}
+
+// newTestServiceWithStores creates a test service using the queue store and the journal,
+// which can be shared with another service to simulate a restart. The configuration of
+// the service can be changed with configure.
+func newTestServiceWithStores(t *testing.T, queue *fakeQueueStore, journal *fakeJournal, configure ...func(*core.ServiceConfig)) *testService {
+	t.Helper()
+
+	claude := newFakeAgent("answer from claude")
+	gemini := newFakeAgent("answer from gemini")
+	scanner := &fakeProjectScanner{path: "/home/users/projects/mycar-logbook"}
+	metrics := &fakeMetricsCollector{metrics: make(chan core.CommandMetrics, 10)}
+	sessions := newFakeSessionStore()
+	telegram := &fakeTelegram{}
+
+	config := core.ServiceConfig{
+		Agents: &fakeAgentRegistry{
+			agents:       map[string]core.Agent{"claude": claude, "gemini": gemini},
+			defaultAgent: "claude",
+		},
+		Telegram:         telegram,
+		RateLimiter:      fakeRateLimiter{},
+		UserRepo:         fakeUserRepository{},
+		ProjectScanner:   scanner,
+		MetricsCollector: metrics,
+		MetricsReporter:  metrics,
+		Sessions:         sessions,
+		Queue:            queue,
+		Journal:          journal,
+
+		ProgressUpdateInterval: 10 * time.Millisecond,
+	}
+	for _, configure := range configure {
+		configure(&config)
+	}
+	service, err := core.NewService(config)
+	require.NoError(t, err)
+
+	return &testService{
+		service:  service,
+		agents:   map[string]*fakeAgent{"claude": claude, "gemini": gemini},
+		scanner:  scanner,
+		metrics:  metrics,
+		sessions: sessions,
+		queue:    queue,
+		journal:  journal,
+		telegram: telegram,
+	}
+}
+
+func waitFor[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for background processing")
+	}
+	var zero T
+	return zero
+}
+
+func TestProcessCommandAgentPrefix(t *testing.T) {
+	testCases := []struct {
+		name           string
+		text           string
+		expectedAgent  string
+		expectedPrompt string
+	}{
+		{
+			name:           "No prefix uses default agent",
+			text:           "what changed in carlogbook",
+			expectedAgent:  "claude",
+			expectedPrompt: "what changed in carlogbook",
+		},
+		{
+			name:           "Known prefix routes to the agent",
+			text:           "@gemini what changed in carlogbook",
+			expectedAgent:  "gemini",
+			expectedPrompt: "what changed in carlogbook",
+		},
+		{
+			name:           "Prefix is case insensitive",
+			text:           "@Gemini what changed\nin carlogbook",
+			expectedAgent:  "gemini",
+			expectedPrompt: "what changed\nin carlogbook",
+		},
+		{
+			name:           "Unknown prefix falls back to default agent",
+			text:           "@gpt what changed in carlogbook",
+			expectedAgent:  "claude",
+			expectedPrompt: "@gpt what changed in carlogbook",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := newTestService(t)
+
+			result, err := ts.service.ProcessCommand(context.Background(), core.Command{
+				ID:        "1",
+				UserID:    42,
+				Text:      tc.text,
+				Timestamp: time.Now(),
+			})
+			require.NoError(t, err)
+			assert.True(t, result.Success)
+
+			input := waitFor(t, ts.agents[tc.expectedAgent].inputs)
+			assert.Equal(t, tc.expectedPrompt, input.Prompt)
+
+			metrics := waitFor(t, ts.metrics.metrics)
+			assert.Equal(t, tc.expectedAgent, metrics.AgentName)
+
+			ts.scanner.mu.Lock()
+			assert.Equal(t, tc.expectedPrompt, ts.scanner.lastQuery, "project detection should not see the agent prefix")
+			ts.scanner.mu.Unlock()
+		})
+	}
+}
+
+func TestProcessCommandSessions(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t)
+	ts.agents["claude"].sessionID = "session-1"
+
+	newCommand := func(text string) core.Command {
+		return core.Command{ID: "1", UserID: 42, ChatID: 42, Text: text, Timestamp: time.Now()}
+	}
+
+	// First message starts a new conversation and stores its session
+	_, err := ts.service.ProcessCommand(ctx, newCommand("what changed in carlogbook"))
+	require.NoError(t, err)
+	input := waitFor(t, ts.agents["claude"].inputs)
+	assert.Nil(t, input.SessionID)
+	waitFor(t, ts.metrics.metrics)
+
+	// Follow-up message continues the stored session
+	_, err = ts.service.ProcessCommand(ctx, newCommand("now run the tests in carlogbook"))
+	require.NoError(t, err)
+	input = waitFor(t, ts.agents["claude"].inputs)
+	require.NotNil(t, input.SessionID)
+	assert.Equal(t, "session-1", *input.SessionID)
+	waitFor(t, ts.metrics.metrics)
+
+	// Another agent doesn't resume a Claude session
+	_, err = ts.service.ProcessCommand(ctx, newCommand("@gemini summarize carlogbook"))
+	require.NoError(t, err)
+	input = waitFor(t, ts.agents["gemini"].inputs)
+	assert.Nil(t, input.SessionID)
+	waitFor(t, ts.metrics.metrics)
+
+	// `/new` forgets the session without calling any agent
+	result, err := ts.service.ProcessCommand(ctx, newCommand("/new"))
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+	session, err := ts.sessions.GetSession(ctx, 42, ts.scanner.path)
+	require.NoError(t, err)
+	assert.Nil(t, session)
+
+	// Idle sessions are not resumed
+	require.NoError(t, ts.sessions.SaveSession(ctx, core.Session{
+		ChatID:    42,
+		Project:   ts.scanner.path,
+		AgentName: "claude",
+		SessionID: "stale",
+		UpdatedAt: time.Now().Add(-core.DefaultSessionIdleTimeout - time.Minute),
+	}))
+	_, err = ts.service.ProcessCommand(ctx, newCommand("what changed in carlogbook"))
+	require.NoError(t, err)
+	input = waitFor(t, ts.agents["claude"].inputs)
+	assert.Nil(t, input.SessionID)
+	waitFor(t, ts.metrics.metrics)
+}
+
+func TestProcessCommandProgressMessage(t *testing.T) {
+	ts := newTestService(t)
+
+	_, err := ts.service.ProcessCommand(context.Background(), core.Command{
+		ID: "1", UserID: 42, ChatID: 42, Text: "what changed in carlogbook", Timestamp: time.Now(),
+	})
+	require.NoError(t, err)
+	waitFor(t, ts.agents["claude"].inputs)
+	waitFor(t, ts.metrics.metrics)
+
+	ts.telegram.mu.Lock()
+	defer ts.telegram.mu.Unlock()
+
+	// placeholder first, then the agent response
+	require.Len(t, ts.telegram.messages, 2)
+	assert.Contains(t, ts.telegram.messages[0].Message, "Working on it")
+	assert.Equal(t, "📁 mycar-logbook\n\nanswer from claude", ts.telegram.messages[1].Message)
+
+	// the placeholder ends with the final status
+	require.NotEmpty(t, ts.telegram.edits)
+	lastEdit := ts.telegram.edits[len(ts.telegram.edits)-1]
+	assert.Equal(t, int64(1), lastEdit.MessageID)
+	assert.Contains(t, lastEdit.Message, "Done")
+}
+
+func TestProcessCommandRefreshProjects(t *testing.T) {
+	ts := newTestService(t)
+
+	result, err := ts.service.ProcessCommand(context.Background(), core.Command{
+		ID: "1", UserID: 42, ChatID: 42, Text: "Refresh  projects", Timestamp: time.Now(),
+	})
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+
+	ts.scanner.mu.Lock()
+	assert.Equal(t, 1, ts.scanner.refreshes)
+	assert.Empty(t, ts.scanner.lastQuery, "refreshing should not look up a project")
+	ts.scanner.mu.Unlock()
+
+	ts.telegram.mu.Lock()
+	defer ts.telegram.mu.Unlock()
+	require.Len(t, ts.telegram.messages, 1)
+	assert.Contains(t, ts.telegram.messages[0].Message, "found 1 projects")
+	assert.Contains(t, ts.telegram.messages[0].Message, "mycar-logbook (docker, go) aka car")
+}
+
+func TestProcessCommandBuiltInCommands(t *testing.T) {
+	testCases := []struct {
+		name            string
+		text            string
+		expectedMessage string
+	}{
+		{name: "Start", text: "/start", expectedMessage: core.WelcomeMessage},
+		{name: "Help", text: "/help", expectedMessage: core.HelpMessage},
+		{name: "Command addressed to the bot", text: "/help@kumote_bot", expectedMessage: core.HelpMessage},
+		{name: "Command is case insensitive", text: "/HELP", expectedMessage: core.HelpMessage},
+		{name: "Projects", text: "/projects", expectedMessage: "📂 1 projects:\n\n• mycar-logbook aka car"},
+		{name: "Cancel without pending choice", text: "/cancel", expectedMessage: "Nothing to cancel."},
+		{name: "Status", text: "/status", expectedMessage: "🤖 Default agent: claude (available)"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := newTestService(t)
+
+			result, err := ts.service.ProcessCommand(context.Background(), core.Command{
+				ID: "1", UserID: 42, ChatID: 42, Text: tc.text, Timestamp: time.Now(),
+			})
+			require.NoError(t, err)
+			assert.True(t, result.Success)
+			assert.Empty(t, ts.agents["claude"].inputs, "built-in commands should not call the agent")
+
+			ts.telegram.mu.Lock()
+			defer ts.telegram.mu.Unlock()
+			require.Len(t, ts.telegram.messages, 1)
+			assert.Contains(t, ts.telegram.messages[0].Message, tc.expectedMessage)
+		})
+	}
+}
+
+func TestProcessCommandUnknownCommandGoesToAgent(t *testing.T) {
+	ts := newTestService(t)
+
+	_, err := ts.service.ProcessCommand(context.Background(), core.Command{
+		ID: "1", UserID: 42, ChatID: 42, Text: "/lint carlogbook", Timestamp: time.Now(),
+	})
+	require.NoError(t, err)
+
+	input := waitFor(t, ts.agents["claude"].inputs)
+	assert.Equal(t, "/lint carlogbook", input.Prompt)
+	waitFor(t, ts.metrics.metrics)
+}
+
+func TestProcessCommandCancelPendingChoice(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t)
+	ts.scanner.matches = []core.ProjectMatch{
+		{Name: "carlogbook", Path: "/projects/carlogbook", Score: 0.8},
+		{Name: "car-wash", Path: "/projects/car-wash", Score: 0.8},
+	}
+
+	_, err := ts.service.ProcessCommand(ctx, core.Command{
+		ID: "1", UserID: 42, ChatID: 42, Text: "run the car tests", Timestamp: time.Now(),
+	})
+	require.NoError(t, err)
+	result, err := ts.service.ProcessCommand(ctx, core.Command{
+		ID: "2", UserID: 42, ChatID: 42, Text: "/cancel", Timestamp: time.Now(),
+	})
+	require.NoError(t, err)
+	assert.Contains(t, result.Response, "Cancelled")
+	assert.Equal(t, core.CommandStatusCancelled, ts.journal.status(1), "the request shouldn't be left waiting")
+
+	ts.metrics.mu.Lock()
+	require.NotEmpty(t, ts.metrics.recorded)
+	assert.Equal(t, "1", ts.metrics.recorded[0].CommandID)
+	assert.Equal(t, core.ErrorTypeCancelled, ts.metrics.recorded[0].ErrorType)
+	ts.metrics.mu.Unlock()
+
+	ts.telegram.mu.Lock()
+	buttons := ts.telegram.messages[0].Buttons
+	ts.telegram.mu.Unlock()
+	require.NotEmpty(t, buttons)
+
+	err = ts.service.ProcessCallback(ctx, core.Callback{
+		ID: "cb", UserID: 42, ChatID: 42, MessageID: 1, Data: buttons[0][0].CallbackData,
+	})
+	assert.ErrorIs(t, err, core.ErrCallbackExpired)
+	assert.Empty(t, ts.agents["claude"].inputs)
+}
+
+func TestRegisterCommands(t *testing.T) {
+	ts := newTestService(t)
+
+	require.NoError(t, ts.service.RegisterCommands(context.Background()))
+
+	ts.telegram.mu.Lock()
+	defer ts.telegram.mu.Unlock()
+	var names []string
+	for _, command := range ts.telegram.commands {
+		assert.NotEmpty(t, command.Description)
+		names = append(names, command.Command)
+	}
+	assert.Equal(t, []string{"start", "help", "projects", "project", "new", "refresh", "status", "jobs", "cancel", "history", "stats", "usage"}, names)
+}
+
+func TestProcessCommandProjectMatching(t *testing.T) {
+	testCases := []struct {
+		name            string
+		matches         []core.ProjectMatch
+		expectedButtons []string
+		expectedProject string
+	}{
+		{
+			name: "Clear best match runs the agent",
+			matches: []core.ProjectMatch{
+				{Name: "carlogbook", Path: "/projects/carlogbook", Score: 0.9},
+				{Name: "car-wash", Path: "/projects/car-wash", Score: 0.6},
+			},
+			expectedProject: "/projects/carlogbook",
+		},
+		{
+			name: "Exact match wins over a close one",
+			matches: []core.ProjectMatch{
+				{Name: "carlogbook", Path: "/projects/carlogbook", Score: 1},
+				{Name: "carlogbooks", Path: "/projects/carlogbooks", Score: 0.98},
+			},
+			expectedProject: "/projects/carlogbook",
+		},
+		{
+			name: "Near tie asks the user",
+			matches: []core.ProjectMatch{
+				{Name: "carlogbook", Path: "/projects/carlogbook", Score: 0.8},
+				{Name: "car-wash", Path: "/projects/car-wash", Score: 0.78},
+				{Name: "cardgame", Path: "/projects/cardgame", Score: 0.5},
+			},
+			expectedButtons: []string{"carlogbook", "car-wash"},
+		},
+		{
+			name:    "No match",
+			matches: []core.ProjectMatch{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := newTestService(t)
+			ts.scanner.matches = tc.matches
+
+			result, err := ts.service.ProcessCommand(context.Background(), core.Command{
+				ID: "1", UserID: 42, ChatID: 42, Text: "run the car tests", Timestamp: time.Now(),
+			})
+			require.NoError(t, err)
+			assert.True(t, result.Success)
+
+			if tc.expectedProject != "" {
+				input := waitFor(t, ts.agents["claude"].inputs)
+				assert.Equal(t, tc.expectedProject, input.ExecutionContext.WorkingDir)
+				waitFor(t, ts.metrics.metrics)
+				return
+			}
+
+			ts.telegram.mu.Lock()
+			defer ts.telegram.mu.Unlock()
+			require.Len(t, ts.telegram.messages, 1)
+			message := ts.telegram.messages[0]
+
+			if tc.expectedButtons == nil {
+				assert.Contains(t, message.Message, "Project folder not found")
+				assert.Empty(t, message.Buttons)
+				return
+			}
+
+			var buttons []string
+			for _, row := range message.Buttons {
+				require.Len(t, row, 1)
+				assert.LessOrEqual(t, len(row[0].CallbackData), 64, "callback data must fit in Telegram's limit")
+				buttons = append(buttons, row[0].Text)
+			}
+			assert.Equal(t, tc.expectedButtons, buttons)
+			assert.Empty(t, ts.agents["claude"].inputs, "the agent should wait for the choice")
+		})
+	}
+}
+
+func TestProcessCommandCurrentProject(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t)
+
+	newCommand := func(text string) core.Command {
+		return core.Command{ID: "1", UserID: 42, ChatID: 42, Text: text, Timestamp: time.Now()}
+	}
+	lastMessage := func() string {
+		ts.telegram.mu.Lock()
+		defer ts.telegram.mu.Unlock()
+		require.NotEmpty(t, ts.telegram.messages)
+		return ts.telegram.messages[len(ts.telegram.messages)-1].Message
+	}
+
+	// nothing to show before a project is used
+	_, err := ts.service.ProcessCommand(ctx, newCommand("/project"))
+	require.NoError(t, err)
+	assert.Contains(t, lastMessage(), "No current project")
+
+	// `/project <name>` sets the current project without calling any agent
+	ts.scanner.matches = []core.ProjectMatch{{Name: "carlogbook", Path: "/projects/carlogbook", Score: 1}}
+	_, err = ts.service.ProcessCommand(ctx, newCommand("/project carlogbook"))
+	require.NoError(t, err)
+	assert.Contains(t, lastMessage(), "Current project: carlogbook")
+	assert.Empty(t, ts.agents["claude"].inputs)
+
+	ts.scanner.mu.Lock()
+	assert.Equal(t, "carlogbook", ts.scanner.lastQuery)
+	ts.scanner.mu.Unlock()
+
+	// follow-ups without a project name run in the current project
+	ts.scanner.matches = []core.ProjectMatch{}
+	_, err = ts.service.ProcessCommand(ctx, newCommand("now run the tests"))
+	require.NoError(t, err)
+	input := waitFor(t, ts.agents["claude"].inputs)
+	assert.Equal(t, "/projects/carlogbook", input.ExecutionContext.WorkingDir)
+	waitFor(t, ts.metrics.metrics)
+	assert.Equal(t, "📁 carlogbook\n\nanswer from claude", lastMessage())
+
+	// a message naming another project switches to it
+	ts.scanner.matches = nil
+	_, err = ts.service.ProcessCommand(ctx, newCommand("what changed in mycar-logbook"))
+	require.NoError(t, err)
+	waitFor(t, ts.agents["claude"].inputs)
+	waitFor(t, ts.metrics.metrics)
+
+	_, err = ts.service.ProcessCommand(ctx, newCommand("/project"))
+	require.NoError(t, err)
+	assert.Equal(t, "📁 Current project: mycar-logbook", lastMessage())
+}
+
+func TestProcessCallbackProjectChoice(t *testing.T) {
+	ctx := context.Background()
+	ts := newTestService(t)
+	ts.scanner.matches = []core.ProjectMatch{
+		{Name: "carlogbook", Path: "/projects/carlogbook", Score: 0.8},
+		{Name: "car-wash", Path: "/projects/car-wash", Score: 0.8},
+	}
+
+	_, err := ts.service.ProcessCommand(ctx, core.Command{
+		ID: "1", UserID: 42, ChatID: 42, Text: "run the car tests", Timestamp: time.Now(),
+	})
+	require.NoError(t, err)
+
+	ts.telegram.mu.Lock()
+	require.Len(t, ts.telegram.messages, 1)
+	buttons := ts.telegram.messages[0].Buttons
+	ts.telegram.mu.Unlock()
+	require.Len(t, buttons, 2)
+	carWash := buttons[1][0].CallbackData
+
+	pressButton := func(userID int64, data string) error {
+		return ts.service.ProcessCallback(ctx, core.Callback{
+			ID: "cb", UserID: userID, ChatID: 42, MessageID: 1, Data: data,
+		})
+	}
+
+	// tampered callback data is rejected
+	tampered := strings.Replace(carWash, ".1:", ".0:", 1)
+	assert.ErrorIs(t, pressButton(42, tampered), core.ErrCallbackInvalid)
+
+	// the choice runs the pending request in the picked project
+	require.NoError(t, pressButton(42, carWash))
+	input := waitFor(t, ts.agents["claude"].inputs)
+	assert.Equal(t, "/projects/car-wash", input.ExecutionContext.WorkingDir)
+	assert.Equal(t, "run the car tests", input.Prompt)
+	waitFor(t, ts.metrics.metrics)
+
+	// the same choice can't be made twice
+	assert.ErrorIs(t, pressButton(42, buttons[0][0].CallbackData), core.ErrCallbackExpired)
+
+	ts.telegram.mu.Lock()
+	defer ts.telegram.mu.Unlock()
+	require.Len(t, ts.telegram.answers, 3, "every button press should be answered")
+	assert.Equal(t, "📁 car-wash", ts.telegram.answers[1].Text)
+	require.NotEmpty(t, ts.telegram.edits)
+	assert.Equal(t, core.TelegramEditMessageInput{ChatID: 42, MessageID: 1, Message: "📁 car-wash"}, ts.telegram.edits[0])
+}
+
+func TestProcessCallbackRejectsUnknownUsers(t *testing.T) {
+	ts := newTestService(t)
+
+	err := ts.service.ProcessCallback(context.Background(), core.Callback{
+		ID: "cb", UserID: 7, ChatID: 7, MessageID: 1, Data: "project:abc.0:x:sig",
+	})
+	assert.ErrorIs(t, err, core.ErrUserNotAuthorized)
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// startNewConversation forgets every session of the chat
+func (s *Service) startNewConversation(ctx context.Context, cmd Command, _ string) (*QueryResult, error) {
+	chatID := cmd.ReplyChatID()
+	if err := s.sessions.DeleteSessions(ctx, chatID); err != nil {
+		slog.ErrorContext(ctx, "Failed to delete sessions",
+			slog.Int64("chat_id", chatID),
+			slog.String("error", err.Error()))
+		return nil, err
+	}
+
+	message := "🆕 Started a new conversation. Your next message won't include the previous context."
+	s.sendMessage(ctx, chatID, message)
+
+	return &QueryResult{
+		Success:  true,
+		Response: message,
+	}, nil
+}
+
+// resumableSessionID returns the session to resume for the chat and project.
+// Sessions of another agent or idle for longer than the idle timeout are not resumed.
+func (s *Service) resumableSessionID(ctx context.Context, chatID int64, project, agentName string) *string {
+	session, err := s.sessions.GetSession(ctx, chatID, project)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to get session, starting a new conversation",
+			slog.Int64("chat_id", chatID),
+			slog.String("error", err.Error()))
+		return nil
+	}
+	if session == nil || session.AgentName != agentName {
+		return nil
+	}
+	if time.Since(session.UpdatedAt) > s.sessionIdleTimeout {
+		slog.DebugContext(ctx, "Session expired, starting a new conversation",
+			slog.Int64("chat_id", chatID),
+			slog.String("session_id", session.SessionID))
+		return nil
+	}
+
+	return &session.SessionID
+}
+
+// saveSession stores the session, failures only cost the conversation context so they're just logged
+func (s *Service) saveSession(ctx context.Context, session Session) {
+	if err := s.sessions.SaveSession(ctx, session); err != nil {
+		slog.WarnContext(ctx, "Failed to save session",
+			slog.Int64("chat_id", session.ChatID),
+			slog.String("session_id", session.SessionID),
+			slog.String("error", err.Error()))
+	}
+}
+
+// forgetSession removes the session of the chat for the project, failures are just logged
+func (s *Service) forgetSession(ctx context.Context, chatID int64, project string) {
+	if err := s.sessions.DeleteSession(ctx, chatID, project); err != nil {
+		slog.WarnContext(ctx, "Failed to delete session",
+			slog.Int64("chat_id", chatID),
+			slog.String("project", project),
+			slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,130 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultMetricsPeriod is the period of `/stats` without arguments
+	defaultMetricsPeriod = MetricsPeriodDay
+	// maxStatsBreakdown is how many projects and users are shown by `/stats`
+	maxStatsBreakdown = 5
+)
+
+// metricsPeriods maps the metrics periods to their length, reports cover the period ending now
+var metricsPeriods = map[string]time.Duration{
+	MetricsPeriodHour:  time.Hour,
+	MetricsPeriodDay:   24 * time.Hour,
+	MetricsPeriodWeek:  7 * 24 * time.Hour,
+	MetricsPeriodMonth: 30 * 24 * time.Hour,
+}
+
+// GetMetricsReport returns the usage report of the period ending now
+func (s *Service) GetMetricsReport(ctx context.Context, period string) (*MetricsReport, error) {
+	length, ok := metricsPeriods[period]
+	if !ok {
+		return nil, fmt.Errorf("%w %q, must be one of %s, %s, %s or %s", ErrInvalidMetricsPeriod, period,
+			MetricsPeriodHour, MetricsPeriodDay, MetricsPeriodWeek, MetricsPeriodMonth)
+	}
+
+	until := time.Now()
+	since := until.Add(-length)
+	report, err := s.metricsReporter.ReportCommandMetrics(ctx, since, until)
+	if err != nil {
+		return nil, fmt.Errorf("failed to report command metrics: %w", err)
+	}
+	report.Period, report.Since, report.Until = period, since, until
+
+	return report, nil
+}
+
+// showStats replies to `/stats [hour|day|week|month]` with the usage report of the period
+func (s *Service) showStats(ctx context.Context, cmd Command, args string) (*QueryResult, error) {
+	period := strings.ToLower(strings.TrimSpace(args))
+	if period == "" {
+		period = defaultMetricsPeriod
+	}
+
+	report, err := s.GetMetricsReport(ctx, period)
+	if err != nil {
+		if _, ok := metricsPeriods[period]; !ok {
+			return s.reply(ctx, cmd, "Usage: /stats [hour|day|week|month]")
+		}
+		slog.ErrorContext(ctx, "Failed to get metrics report",
+			slog.String("period", period),
+			slog.String("error", err.Error()))
+		return s.reply(ctx, cmd, "❌ Failed to load the usage stats.")
+	}
+
+	return s.reply(ctx, cmd, formatMetricsReport(report))
+}
+
+// formatMetricsReport describes the report for the chat, e.g.
+//
+//	📊 Stats of the last day
+//	12 commands · 92% succeeded · p50 8s · p95 1m2s
+//
+//	Projects:
+//	• carlogbook: 7 commands · 100% succeeded · p50 9s · p95 41s
+func formatMetricsReport(report *MetricsReport) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "📊 Stats of the last %s\n", report.Period)
+	if report.Commands == 0 {
+		sb.WriteString("No commands yet.")
+		return sb.String()
+	}
+	sb.WriteString(formatMetricsSummary(report.MetricsSummary))
+
+	if len(report.Projects) > 0 {
+		sb.WriteString("\n\nProjects:")
+		for i, project := range report.Projects {
+			if i == maxStatsBreakdown {
+				fmt.Fprintf(&sb, "\n• and %d more", len(report.Projects)-i)
+				break
+			}
+			name := project.Project
+			if name == "" {
+				name = "no project"
+			}
+			fmt.Fprintf(&sb, "\n• %s: %s", name, formatMetricsSummary(project.MetricsSummary))
+		}
+	}
+
+	if len(report.Users) > 1 {
+		sb.WriteString("\n\nUsers:")
+		for i, user := range report.Users {
+			if i == maxStatsBreakdown {
+				fmt.Fprintf(&sb, "\n• and %d more", len(report.Users)-i)
+				break
+			}
+			fmt.Fprintf(&sb, "\n• %d: %s", user.UserID, formatMetricsSummary(user.MetricsSummary))
+		}
+	}
+
+	return sb.String()
+}
+
+// formatMetricsSummary describes the summary in one line, e.g. "12 commands · 92% succeeded · p50 8s · p95 1m2s"
+func formatMetricsSummary(summary MetricsSummary) string {
+	commands := "commands"
+	if summary.Commands == 1 {
+		commands = "command"
+	}
+
+	return fmt.Sprintf("%d %s · %.0f%% succeeded · p50 %s · p95 %s",
+		summary.Commands, commands, summary.SuccessRate*100,
+		roundExecutionTime(summary.P50ExecutionTime), roundExecutionTime(summary.P95ExecutionTime))
+}
+
+// roundExecutionTime rounds to the second, or to the millisecond for commands
+// answered in less than a second
+func roundExecutionTime(d time.Duration) time.Duration {
+	if d < time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(time.Second)
+}
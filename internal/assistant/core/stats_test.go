@@ -0,0 +1,53 @@
+package core_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/izzddalfk/kumote/internal/assistant/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessCommandStats(t *testing.T) {
+	ts := newTestService(t)
+
+	ts.send(t, "/stats")
+	assert.Equal(t, "📊 Stats of the last day\nNo commands yet.", ts.lastMessage(t))
+	assert.WithinDuration(t, time.Now().Add(-24*time.Hour), ts.metrics.since, time.Minute)
+
+	ts.metrics.report = core.MetricsReport{
+		MetricsSummary: core.MetricsSummary{
+			Commands: 12, Succeeded: 11, Failed: 1, SuccessRate: 11.0 / 12,
+			P50ExecutionTime: 8200 * time.Millisecond, P95ExecutionTime: 62 * time.Second,
+		},
+		Projects: []core.ProjectMetrics{
+			{Project: "carlogbook", MetricsSummary: core.MetricsSummary{
+				Commands: 11, Succeeded: 11, SuccessRate: 1, P50ExecutionTime: 9 * time.Second, P95ExecutionTime: 41 * time.Second,
+			}},
+			{MetricsSummary: core.MetricsSummary{
+				Commands: 1, P50ExecutionTime: 120 * time.Millisecond, P95ExecutionTime: 120 * time.Millisecond,
+			}},
+		},
+		Users: []core.UserMetrics{{UserID: 42}},
+	}
+	ts.send(t, "/stats WEEK")
+	assert.Equal(t, "📊 Stats of the last week\n"+
+		"12 commands · 92% succeeded · p50 8s · p95 1m2s\n\n"+
+		"Projects:\n"+
+		"• carlogbook: 11 commands · 100% succeeded · p50 9s · p95 41s\n"+
+		"• no project: 1 command · 0% succeeded · p50 120ms · p95 120ms", ts.lastMessage(t))
+	assert.WithinDuration(t, time.Now().Add(-7*24*time.Hour), ts.metrics.since, time.Minute)
+
+	ts.send(t, "/stats year")
+	assert.Equal(t, "Usage: /stats [hour|day|week|month]", ts.lastMessage(t))
+
+	_, err := ts.service.GetMetricsReport(context.Background(), "year")
+	assert.ErrorIs(t, err, core.ErrInvalidMetricsPeriod)
+
+	report, err := ts.service.GetMetricsReport(context.Background(), core.MetricsPeriodHour)
+	require.NoError(t, err)
+	assert.Equal(t, core.MetricsPeriodHour, report.Period)
+	assert.Equal(t, time.Hour, report.Until.Sub(report.Since))
+}
@@ -0,0 +1,232 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+const (
+	// transcriptionTimeout is how long downloading and transcribing a voice message may take
+	transcriptionTimeout = 2 * time.Minute
+	// voiceTranscriptTTL is how long the user has to confirm a transcript
+	voiceTranscriptTTL = 10 * time.Minute
+	// voiceCallbackAction is the callback action of the transcript confirmation buttons
+	voiceCallbackAction = "voice"
+	// voiceConfirm and voiceDiscard tell the pressed button apart in the callback payload
+	voiceConfirm = "y"
+	voiceDiscard = "n"
+)
+
+// audioFormats maps the MIME types Telegram reports for voice and audio messages to the
+// AudioFormat constants
+var audioFormats = map[string]string{
+	"audio/ogg":    AudioFormatOGG,
+	"audio/opus":   AudioFormatOGG,
+	"audio/x-opus": AudioFormatOGG,
+	"audio/mpeg":   AudioFormatMP3,
+	"audio/mp3":    AudioFormatMP3,
+	"audio/wav":    AudioFormatWAV,
+	"audio/x-wav":  AudioFormatWAV,
+	"audio/wave":   AudioFormatWAV,
+	"audio/mp4":    AudioFormatM4A,
+	"audio/m4a":    AudioFormatM4A,
+	"audio/x-m4a":  AudioFormatM4A,
+	"audio/aac":    AudioFormatM4A,
+}
+
+// audioFormat returns the format of the voice message, or ErrVoiceUnsupported along with
+// the reason told to the user when it can't be transcribed
+func audioFormat(voice Voice) (string, error) {
+	if voice.Duration > MaxAudioDuration {
+		return "", fmt.Errorf("%w: %s long, at most %s", ErrVoiceUnsupported, voice.Duration, MaxAudioDuration)
+	}
+	if voice.FileSize > MaxAudioFileSize {
+		return "", fmt.Errorf("%w: %d bytes, at most %d", ErrVoiceUnsupported, voice.FileSize, MaxAudioFileSize)
+	}
+
+	mimeType, _, _ := strings.Cut(strings.ToLower(voice.MimeType), ";")
+	format, ok := audioFormats[strings.TrimSpace(mimeType)]
+	if !ok {
+		return "", fmt.Errorf("%w: unsupported format %q", ErrVoiceUnsupported, voice.MimeType)
+	}
+	return format, nil
+}
+
+// transcribeVoice answers right away and turns the voice message of the command into text in
+// background, then echoes it back with buttons to confirm it. The confirmed transcript is processed
+// as a new command, journaled on its own.
+func (s *Service) transcribeVoice(ctx context.Context, cmd Command, startTime time.Time) (*QueryResult, error) {
+	if s.transcriber == nil {
+		return s.failTranscription(ctx, cmd, startTime, fmt.Errorf("%w: no transcriber configured", ErrVoiceUnsupported),
+			"🎙 Voice messages aren't enabled, please send your request as text.")
+	}
+	format, err := audioFormat(*cmd.Voice)
+	if err != nil {
+		return s.failTranscription(ctx, cmd, startTime, err, fmt.Sprintf("🎙 I can only transcribe voice messages up to %d minutes and %dMB, in OGG, MP3, WAV or M4A.",
+			int(MaxAudioDuration.Minutes()), MaxAudioFileSize/(1024*1024)))
+	}
+
+	message := "🎙 Transcribing your voice message…"
+	s.sendMessage(ctx, cmd.ReplyChatID(), message)
+
+	// Transcribe in a goroutine, with a context that won't be canceled when the request completes
+	go s.confirmTranscript(context.WithoutCancel(ctx), cmd, format, startTime)
+
+	return &QueryResult{
+		Success:  true,
+		Response: message,
+	}, nil
+}
+
+// confirmTranscript downloads and transcribes the voice message of the command, and sends the
+// transcript with buttons to send or discard it. Only failures are recorded in the metrics,
+// the confirmed transcript is recorded as the command it becomes.
+func (s *Service) confirmTranscript(ctx context.Context, cmd Command, format string, startTime time.Time) {
+	chatID := cmd.ReplyChatID()
+	voice := *cmd.Voice
+
+	transcribeCtx, cancel := context.WithTimeout(ctx, transcriptionTimeout)
+	defer cancel()
+
+	audio, err := s.telegram.DownloadFile(transcribeCtx, voice.FileID)
+	if err != nil {
+		s.failTranscription(ctx, cmd, startTime, fmt.Errorf("%w: failed to download voice message: %w", ErrTranscriptionFailed, err),
+			"❌ I couldn't download your voice message, please send it again.")
+		return
+	}
+
+	transcript, err := s.transcriber.Transcribe(transcribeCtx, TranscriptionInput{Audio: audio, Format: format})
+	switch {
+	case errors.Is(err, ErrTranscriberUnavailable):
+		s.failTranscription(ctx, cmd, startTime, fmt.Errorf("%w: %w", ErrTranscriptionFailed, err),
+			"🔌 The transcriber isn't available on the server, please send your request as text.")
+		return
+	case err != nil:
+		s.failTranscription(ctx, cmd, startTime, fmt.Errorf("%w: %w", ErrTranscriptionFailed, err),
+			"❌ I couldn't transcribe your voice message, please try again or send it as text.")
+		return
+	case transcript == "":
+		s.failTranscription(ctx, cmd, startTime, fmt.Errorf("%w: nothing was heard", ErrTranscriptionFailed),
+			"🙉 I couldn't hear anything in your voice message.")
+		return
+	}
+
+	buttons, err := s.transcriptButtons(cmd, transcript)
+	if err != nil {
+		s.failTranscription(ctx, cmd, startTime, err,
+			"❌ I couldn't transcribe your voice message, please try again or send it as text.")
+		return
+	}
+
+	slog.DebugContext(ctx, "Transcribed voice message, asking the user to confirm it",
+		slog.String("command_id", cmd.ID),
+		slog.Duration("duration", voice.Duration),
+		slog.Int("transcript_length", len(transcript)))
+
+	if _, err := s.telegram.SendTextMessage(ctx, TelegramTextMessageInput{
+		ChatID:  chatID,
+		Message: "🎙 I heard:\n\n" + transcript,
+		Buttons: buttons,
+	}); err != nil {
+		slog.ErrorContext(ctx, "Failed to send Telegram message",
+			slog.Int64("chat_id", chatID),
+			slog.String("error", err.Error()))
+	}
+}
+
+// transcriptButtons keeps the transcript pending and returns the buttons to send or discard it
+func (s *Service) transcriptButtons(cmd Command, transcript string) ([][]InlineButton, error) {
+	expiresAt := time.Now().Add(voiceTranscriptTTL)
+	id, err := s.voiceTranscripts.add(cmd.UserID, cmd.ReplyChatID(), pendingTranscript{
+		commandID: cmd.ID,
+		chatID:    cmd.ReplyChatID(),
+		text:      transcript,
+	}, expiresAt, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to keep the pending transcript: %w", err)
+	}
+
+	confirmData, err := s.callbacks.sign(voiceCallbackAction, id+"."+voiceConfirm, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	discardData, err := s.callbacks.sign(voiceCallbackAction, id+"."+voiceDiscard, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return [][]InlineButton{{
+		{Text: "✅ Send", CallbackData: confirmData},
+		{Text: "❌ Discard", CallbackData: discardData},
+	}}, nil
+}
+
+// failTranscription tells the user why the voice message can't be transcribed and records the failure
+func (s *Service) failTranscription(ctx context.Context, cmd Command, startTime time.Time, err error, message string) (*QueryResult, error) {
+	slog.WarnContext(ctx, "Failed to transcribe voice message",
+		slog.String("command_id", cmd.ID),
+		slog.Int64("user_id", cmd.UserID),
+		slog.String("error", err.Error()))
+	s.sendMessage(ctx, cmd.ReplyChatID(), message)
+	s.recordMetrics(ctx, cmd, startTime, commandOutcome{err: err})
+
+	return &QueryResult{
+		Success: false,
+		Error:   message,
+	}, nil
+}
+
+// handleVoiceTranscript processes the transcript confirmed by the user as a text command, or drops
+// it when the user discards it. The payload is the ID of the pending transcript and the pressed button.
+func (s *Service) handleVoiceTranscript(ctx context.Context, callback Callback, payload string) (string, error) {
+	id, choice, _ := strings.Cut(payload, ".")
+	if choice != voiceConfirm && choice != voiceDiscard {
+		return "This button is not valid anymore.", fmt.Errorf("%w: unknown choice %q", ErrCallbackInvalid, choice)
+	}
+
+	transcript, ok := s.voiceTranscripts.take(id, callback.UserID)
+	if !ok {
+		return "⌛ This transcript has expired, please send your voice message again.", ErrCallbackExpired
+	}
+
+	// replace the transcript, and its buttons, so it can't be sent twice
+	message, notification := "🎙 "+transcript.text, "✅ Sent"
+	if choice == voiceDiscard {
+		message, notification = "🗑 Discarded: "+transcript.text, "🗑 Discarded"
+	}
+	if err := s.telegram.EditTextMessage(ctx, TelegramEditMessageInput{
+		ChatID:    callback.ChatID,
+		MessageID: callback.MessageID,
+		Message:   message,
+	}); err != nil {
+		slog.WarnContext(ctx, "Failed to edit transcript message",
+			slog.Int64("chat_id", callback.ChatID),
+			slog.String("error", err.Error()))
+	}
+
+	if choice == voiceDiscard {
+		return notification, nil
+	}
+	if _, err := s.ProcessCommand(ctx, Command{
+		ID:        "voice-" + transcript.commandID,
+		UserID:    callback.UserID,
+		ChatID:    transcript.chatID,
+		Text:      transcript.text,
+		Timestamp: time.Now(),
+	}); err != nil {
+		return "❌ Failed to send the request.", err
+	}
+
+	return notification, nil
+}
+
+// pendingTranscript is the transcript of a voice message waiting for the user to confirm it
+type pendingTranscript struct {
+	commandID string
+	chatID    int64
+	text      string
+}
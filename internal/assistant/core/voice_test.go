@@ -0,0 +1,193 @@
+package core_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/izzddalfk/kumote/internal/assistant/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTranscriber returns the transcript, or the error, for every audio and sends the audio
+// to the inputs channel
+type fakeTranscriber struct {
+	transcript string
+	err        error
+	inputs     chan core.TranscriptionInput
+}
+
+func (f *fakeTranscriber) Transcribe(ctx context.Context, input core.TranscriptionInput) (string, error) {
+	f.inputs <- input
+	return f.transcript, f.err
+}
+
+func (ts *testService) sendVoice(t *testing.T, voice core.Voice) *core.QueryResult {
+	t.Helper()
+	result, err := ts.service.ProcessCommand(context.Background(), core.Command{
+		ID: "1", UserID: 42, ChatID: 42, Voice: &voice, Timestamp: time.Now(),
+	})
+	require.NoError(t, err)
+	return result
+}
+
+// waitForTranscriptionFailure waits for the transcription running in background to record its failure
+func (ts *testService) waitForTranscriptionFailure(t *testing.T) core.CommandMetrics {
+	t.Helper()
+	assert.Eventually(t, func() bool {
+		ts.metrics.mu.Lock()
+		defer ts.metrics.mu.Unlock()
+		return len(ts.metrics.recorded) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	return ts.metrics.last(t)
+}
+
+// waitForTranscript waits for the transcription running in background to send the transcript
+func (ts *testService) waitForTranscript(t *testing.T) {
+	t.Helper()
+	assert.Eventually(t, func() bool {
+		ts.telegram.mu.Lock()
+		defer ts.telegram.mu.Unlock()
+		return len(ts.telegram.messages) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// pressTranscriptButton presses a button of the transcript message, 0 to send it and 1 to discard it
+func (ts *testService) pressTranscriptButton(t *testing.T, button int) error {
+	t.Helper()
+	ts.telegram.mu.Lock()
+	messages := ts.telegram.messages
+	ts.telegram.mu.Unlock()
+	require.GreaterOrEqual(t, len(messages), 2, "the transcript should follow the transcribing message")
+	message := messages[1]
+	require.Len(t, message.Buttons, 1)
+	require.Len(t, message.Buttons[0], 2)
+
+	return ts.service.ProcessCallback(context.Background(), core.Callback{
+		ID: "cb", UserID: 42, ChatID: 42, MessageID: 2, Data: message.Buttons[0][button].CallbackData,
+	})
+}
+
+var testVoice = core.Voice{FileID: "voice-1", Duration: 5 * time.Second, MimeType: "audio/ogg"}
+
+func TestProcessCommandVoiceConfirmed(t *testing.T) {
+	transcriber := &fakeTranscriber{transcript: "Run the tests of carlogbook.", inputs: make(chan core.TranscriptionInput, 1)}
+	ts := newTestServiceWithStores(t, &fakeQueueStore{}, &fakeJournal{}, func(config *core.ServiceConfig) {
+		config.Transcriber = transcriber
+	})
+	ts.telegram.files = map[string][]byte{testVoice.FileID: []byte("OggS voice")}
+
+	result := ts.sendVoice(t, testVoice)
+	assert.True(t, result.Success)
+	assert.Equal(t, "🎙 Transcribing your voice message…", result.Response)
+	input := waitFor(t, transcriber.inputs)
+	assert.Equal(t, core.TranscriptionInput{Audio: []byte("OggS voice"), Format: core.AudioFormatOGG}, input)
+	ts.waitForTranscript(t)
+	assert.Equal(t, "🎙 I heard:\n\nRun the tests of carlogbook.", ts.lastMessage(t))
+	assert.Empty(t, ts.agents["claude"].inputs, "the agent should wait for the confirmation")
+	assert.Empty(t, ts.journal.entries, "the voice message itself isn't journaled")
+
+	require.NoError(t, ts.pressTranscriptButton(t, 0))
+	assert.Equal(t, "🎙 Run the tests of carlogbook.", ts.lastEdit(t))
+	prompt := waitFor(t, ts.agents["claude"].inputs)
+	assert.Equal(t, "Run the tests of carlogbook.", prompt.Prompt)
+	metrics := waitFor(t, ts.metrics.metrics)
+	assert.Equal(t, "voice-1", metrics.CommandID)
+	ts.metrics.mu.Lock()
+	assert.Len(t, ts.metrics.recorded, 1, "the voice request should be recorded once")
+	ts.metrics.mu.Unlock()
+
+	// the transcript is sent once
+	assert.ErrorIs(t, ts.pressTranscriptButton(t, 0), core.ErrCallbackExpired)
+}
+
+func TestProcessCommandVoiceDiscarded(t *testing.T) {
+	ts := newTestServiceWithStores(t, &fakeQueueStore{}, &fakeJournal{}, func(config *core.ServiceConfig) {
+		config.Transcriber = &fakeTranscriber{transcript: "Delete the carlogbook repository.", inputs: make(chan core.TranscriptionInput, 1)}
+	})
+	ts.telegram.files = map[string][]byte{testVoice.FileID: []byte("OggS voice")}
+
+	ts.sendVoice(t, testVoice)
+	ts.waitForTranscript(t)
+	require.NoError(t, ts.pressTranscriptButton(t, 1))
+	assert.Equal(t, "🗑 Discarded: Delete the carlogbook repository.", ts.lastEdit(t))
+	assert.Empty(t, ts.agents["claude"].inputs)
+
+	ts.telegram.mu.Lock()
+	defer ts.telegram.mu.Unlock()
+	assert.Equal(t, "🗑 Discarded", ts.telegram.answers[len(ts.telegram.answers)-1].Text)
+}
+
+func TestProcessCommandVoiceFailures(t *testing.T) {
+	testCases := []struct {
+		name            string
+		transcriber     *fakeTranscriber
+		voice           core.Voice
+		expectedMessage string
+		expectedType    string
+	}{
+		{
+			name:            "Transcription disabled",
+			voice:           testVoice,
+			expectedMessage: "🎙 Voice messages aren't enabled, please send your request as text.",
+			expectedType:    core.ErrorTypeVoiceRejected,
+		},
+		{
+			name:            "Too long",
+			transcriber:     &fakeTranscriber{transcript: "hello"},
+			voice:           core.Voice{FileID: "voice-1", Duration: 11 * time.Minute, MimeType: "audio/ogg"},
+			expectedMessage: "🎙 I can only transcribe voice messages up to 10 minutes and 20MB, in OGG, MP3, WAV or M4A.",
+			expectedType:    core.ErrorTypeVoiceRejected,
+		},
+		{
+			name:            "Unsupported format",
+			transcriber:     &fakeTranscriber{transcript: "hello"},
+			voice:           core.Voice{FileID: "voice-1", Duration: 5 * time.Second, MimeType: "audio/flac"},
+			expectedMessage: "🎙 I can only transcribe voice messages up to 10 minutes and 20MB, in OGG, MP3, WAV or M4A.",
+			expectedType:    core.ErrorTypeVoiceRejected,
+		},
+		{
+			name:            "Download failed",
+			transcriber:     &fakeTranscriber{transcript: "hello"},
+			voice:           core.Voice{FileID: "missing", Duration: 5 * time.Second, MimeType: "audio/ogg"},
+			expectedMessage: "❌ I couldn't download your voice message, please send it again.",
+			expectedType:    core.ErrorTypeTranscription,
+		},
+		{
+			name:            "Transcriber unavailable",
+			transcriber:     &fakeTranscriber{err: fmt.Errorf("failed to execute whisper.cpp: %w", core.ErrTranscriberUnavailable)},
+			voice:           testVoice,
+			expectedMessage: "🔌 The transcriber isn't available on the server, please send your request as text.",
+			expectedType:    core.ErrorTypeTranscription,
+		},
+		{
+			name:            "Nothing heard",
+			transcriber:     &fakeTranscriber{},
+			voice:           testVoice,
+			expectedMessage: "🙉 I couldn't hear anything in your voice message.",
+			expectedType:    core.ErrorTypeTranscription,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var transcriber core.Transcriber
+			if tc.transcriber != nil {
+				tc.transcriber.inputs = make(chan core.TranscriptionInput, 1)
+				transcriber = tc.transcriber
+			}
+			ts := newTestServiceWithStores(t, &fakeQueueStore{}, &fakeJournal{}, func(config *core.ServiceConfig) {
+				config.Transcriber = transcriber
+			})
+			ts.telegram.files = map[string][]byte{testVoice.FileID: []byte("OggS voice")}
+
+			ts.sendVoice(t, tc.voice)
+			metrics := ts.waitForTranscriptionFailure(t)
+			assert.False(t, metrics.Success)
+			assert.Equal(t, tc.expectedType, metrics.ErrorType)
+			assert.Equal(t, tc.expectedMessage, ts.lastMessage(t))
+		})
+	}
+}
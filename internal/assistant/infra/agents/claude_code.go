@@ -1,17 +1,25 @@
 package agents
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"os/exec"
 	"strings"
 
 	"github.com/izzddalfk/kumote/internal/assistant/core"
+	"github.com/izzddalfk/kumote/internal/shared/utils/cliprocess"
 	"gopkg.in/validator.v2"
 )
 
+// maxStreamLineSize is the maximum size of a single stream-json event,
+// tool results (e.g. a whole file read by the agent) can be large
+const maxStreamLineSize = 10 * 1024 * 1024
+
 // ClaudeCodeAgent implements the AICodeExecutor interface using Claude CLI
 type ClaudeCodeAgent struct {
 	executablePath string
@@ -41,36 +49,162 @@ func NewClaudeCodeAgent(config ClaudeCodeAgentConfig) (*ClaudeCodeAgent, error)
 	}, nil
 }
 
+// Subtypes of the result event of Claude Code
+const (
+	claudeCodeSubtypeSuccess              = "success"
+	claudeCodeSubtypeErrorMaxTurns        = "error_max_turns"
+	claudeCodeSubtypeErrorDuringExecution = "error_during_execution"
+)
+
 type claudeCodeResponse struct {
-	Type      string `json:"type"`
-	SessionID string `json:"session_id,omitempty"`
-	SubType   string `json:"subtype,omitempty"`
-	IsError   bool   `json:"is_error,omitempty"`
-	Result    string `json:"result,omitempty"`
+	Type          string   `json:"type"`
+	SessionID     string   `json:"session_id,omitempty"`
+	SubType       string   `json:"subtype,omitempty"`
+	IsError       bool     `json:"is_error,omitempty"`
+	Result        string   `json:"result,omitempty"`
+	TotalCostUSD  *float64 `json:"total_cost_usd,omitempty"`
+	CostUSD       *float64 `json:"cost_usd,omitempty"` // older versions of Claude Code
+	DurationMs    int64    `json:"duration_ms,omitempty"`
+	DurationAPIMs int64    `json:"duration_api_ms,omitempty"`
+	NumTurns      int      `json:"num_turns,omitempty"`
+	Usage         *struct {
+		InputTokens              int64 `json:"input_tokens"`
+		OutputTokens             int64 `json:"output_tokens"`
+		CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+		CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
+	} `json:"usage,omitempty"`
+}
+
+// failure describes why the run failed, or returns an empty string when it succeeded
+func (r *claudeCodeResponse) failure() string {
+	switch {
+	case r.SubType == claudeCodeSubtypeErrorMaxTurns:
+		return fmt.Sprintf("the agent reached the maximum number of turns (%d) before finishing", r.NumTurns)
+	case r.SubType == claudeCodeSubtypeErrorDuringExecution:
+		return "the agent failed during execution"
+	case r.SubType != "" && r.SubType != claudeCodeSubtypeSuccess:
+		return fmt.Sprintf("the agent run ended with %s", r.SubType)
+	case r.IsError && r.Result != "":
+		// e.g. API errors, the result is the error message
+		return r.Result
+	case r.IsError:
+		return "the agent reported an error"
+	default:
+		return ""
+	}
+}
+
+// metadata returns the subtype, cost, tokens, duration and turns of the run reported by Claude Code
+func (r *claudeCodeResponse) metadata() map[string]any {
+	metadata := map[string]any{
+		core.MetadataDurationMs:    r.DurationMs,
+		core.MetadataAPIDurationMs: r.DurationAPIMs,
+		core.MetadataTurns:         r.NumTurns,
+	}
+	if r.SubType != "" {
+		metadata[core.MetadataSubtype] = r.SubType
+	}
+	switch {
+	case r.TotalCostUSD != nil:
+		metadata[core.MetadataCostUSD] = *r.TotalCostUSD
+	case r.CostUSD != nil:
+		metadata[core.MetadataCostUSD] = *r.CostUSD
+	}
+	if r.Usage != nil {
+		// Cache reads are the conversation read again on every turn, at a tenth of the price.
+		// They're reported apart so they don't use up the token budgets.
+		metadata[core.MetadataInputTokens] = r.Usage.InputTokens + r.Usage.CacheCreationInputTokens
+		metadata[core.MetadataOutputTokens] = r.Usage.OutputTokens
+		metadata[core.MetadataCacheReadTokens] = r.Usage.CacheReadInputTokens
+	}
+	return metadata
+}
+
+// claudeCodeStreamEvent is a single line of `--output-format stream-json`.
+// The last event has type "result" and carries the same fields as the JSON output.
+type claudeCodeStreamEvent struct {
+	claudeCodeResponse
+	Message *struct {
+		Content []struct {
+			Type  string          `json:"type"`
+			Text  string          `json:"text,omitempty"`
+			Name  string          `json:"name,omitempty"`
+			Input json.RawMessage `json:"input,omitempty"`
+		} `json:"content"`
+	} `json:"message,omitempty"`
 }
 
 // ExecuteCommand runs an AI code command and returns the result
 func (c *ClaudeCodeAgent) ExecuteCommand(ctx context.Context, input core.AgentCommandInput) (*core.QueryResult, error) {
-	// Execute Claude CLI command
-	rawOutput, err := c.runClaudeCommand(ctx, input)
+	return c.ExecuteCommandStream(ctx, input, nil)
+}
+
+// ExecuteCommandStream runs an AI code command and reports text and tool calls
+// of the agent to onEvent while they're streamed by Claude CLI
+func (c *ClaudeCodeAgent) ExecuteCommandStream(ctx context.Context, input core.AgentCommandInput, onEvent func(core.AgentEvent)) (*core.QueryResult, error) {
+	if onEvent == nil {
+		onEvent = func(core.AgentEvent) {}
+	}
+
+	var (
+		response  *claudeCodeResponse
+		rawOutput strings.Builder
+	)
+	err := c.runClaudeCommand(ctx, input, func(line []byte) {
+		var event claudeCodeStreamEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			rawOutput.Write(line)
+			rawOutput.WriteString("\n")
+			return
+		}
+
+		switch event.Type {
+		case "assistant":
+			if event.Message == nil {
+				return
+			}
+			for _, content := range event.Message.Content {
+				switch content.Type {
+				case "text":
+					onEvent(core.AgentEvent{Type: core.AgentEventText, Text: content.Text})
+				case "tool_use":
+					onEvent(core.AgentEvent{Type: core.AgentEventToolUse, Text: describeToolUse(content.Name, content.Input)})
+				}
+			}
+		case "result":
+			response = &event.claudeCodeResponse
+		}
+	})
+
+	// Without a result event the outcome of the run is unknown, whatever was printed
+	if response == nil {
+		if err != nil {
+			return nil, err
+		}
+		slog.WarnContext(ctx, "failed to parse Claude Code output", slog.String("output", rawOutput.String()))
+		return nil, fmt.Errorf("%w: claude output has no result event", core.ErrAgentOutputInvalid)
+	}
+	// The result event tells the outcome even when the CLI exits with an error afterwards,
+	// e.g. it exits with 1 after reporting an error result
 	if err != nil {
-		return nil, err
+		slog.WarnContext(ctx, "Claude Code exited with an error after its result", slog.String("error", err.Error()))
 	}
 
-	// Parse JSON response
-	var response claudeCodeResponse
-	if err := json.Unmarshal([]byte(rawOutput), &response); err != nil {
-		slog.WarnContext(ctx, "failed to parse Claude Code output", slog.String("output", rawOutput))
-		// If JSON parsing fails, return the raw output
+	if failure := response.failure(); failure != "" {
 		return &core.QueryResult{
-			Success:  true,
-			Response: string(rawOutput),
+			Success:   false,
+			Response:  response.Result,
+			Error:     failure,
+			SessionID: response.SessionID,
+			Metadata:  response.metadata(),
 		}, nil
 	}
 
 	return &core.QueryResult{
-		Success:  true,
-		Response: response.Result,
+		Success:   true,
+		Response:  response.Result,
+		SessionID: response.SessionID,
+		Metadata:  response.metadata(),
 	}, nil
 }
 
@@ -81,12 +215,15 @@ func (c *ClaudeCodeAgent) IsAvailable(ctx context.Context) bool {
 	return err == nil
 }
 
-// runClaudeCommand executes the Claude CLI with the given prompt
-func (c *ClaudeCodeAgent) runClaudeCommand(ctx context.Context, input core.AgentCommandInput, args ...string) (string, error) {
+// runClaudeCommand executes the Claude CLI with the given prompt and passes
+// every line of its streamed output to onLine
+func (c *ClaudeCodeAgent) runClaudeCommand(ctx context.Context, input core.AgentCommandInput, onLine func([]byte), args ...string) error {
 	// Construct the command
+	// stream-json requires verbose mode when running with `-p`
 	cmdArgs := []string{
 		"--model", c.defaultModel,
-		"--output-format", "json",
+		"--output-format", "stream-json",
+		"--verbose",
 	}
 	// If the session ID is provided, add it to the command
 	if input.SessionID != nil {
@@ -97,8 +234,9 @@ func (c *ClaudeCodeAgent) runClaudeCommand(ctx context.Context, input core.Agent
 	// always add the prompt as the last argument
 	cmdArgs = append(cmdArgs, "-p", input.Prompt)
 
-	// Create the command
+	// Create the command, cancelling the context stops the CLI and everything it started
 	cmd := exec.CommandContext(ctx, c.executablePath, cmdArgs...)
+	cliprocess.KillTreeOnCancel(cmd)
 
 	// Set working directory if specified
 	cmd.Dir = input.ExecutionContext.WorkingDir
@@ -106,11 +244,70 @@ func (c *ClaudeCodeAgent) runClaudeCommand(ctx context.Context, input core.Agent
 	// Set the prompt as input
 	cmd.Stdin = strings.NewReader(input.Prompt)
 
-	// Capture output
-	output, err := cmd.CombinedOutput()
+	// Read the streamed events from stdout, keep stderr aside for error reporting
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return "", fmt.Errorf("failed to execute claude command: %w", err)
+		return fmt.Errorf("failed to open claude output: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to execute claude command: %w", processError(err, core.ErrClaudeCodeUnavailable))
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), maxStreamLineSize)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if c.debug {
+			slog.DebugContext(ctx, "Claude Code stream event", slog.String("event", string(line)))
+		}
+		onLine(line)
+	}
+	scanErr := scanner.Err()
+	if scanErr != nil {
+		// drain the rest of the output so the process isn't blocked on a full pipe
+		_, _ = io.Copy(io.Discard, stdout)
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("failed to execute claude command: %w (stderr: %s)",
+			processError(err, core.ErrClaudeCodeUnavailable), strings.TrimSpace(stderr.String()))
+	}
+	if scanErr != nil {
+		return fmt.Errorf("failed to read claude output: %w: %w", core.ErrAgentOutputInvalid, scanErr)
+	}
+
+	if c.debug && stderr.Len() > 0 {
+		slog.DebugContext(ctx, "Claude Code stderr", slog.String("stderr", stderr.String()))
+	}
+
+	return nil
+}
+
+// describeToolUse builds a short description of a tool call for progress updates,
+// e.g. "Bash: go test ./..." or "Read: internal/core/service.go"
+func describeToolUse(name string, rawInput json.RawMessage) string {
+	var input map[string]any
+	if err := json.Unmarshal(rawInput, &input); err != nil {
+		return name
+	}
+
+	for _, key := range []string{"command", "file_path", "path", "pattern", "url", "description"} {
+		value, ok := input[key].(string)
+		if !ok || value == "" {
+			continue
+		}
+		value = strings.Join(strings.Fields(value), " ")
+		if runes := []rune(value); len(runes) > 80 {
+			value = string(runes[:80]) + "…"
+		}
+		return fmt.Sprintf("%s: %s", name, value)
 	}
 
-	return string(output), nil
+	return name
 }
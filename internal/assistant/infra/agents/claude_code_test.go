@@ -0,0 +1,167 @@
+package agents_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/izzddalfk/kumote/internal/assistant/core"
+	"github.com/izzddalfk/kumote/internal/assistant/infra/agents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClaudeCodeAgentExecuteCommandStream(t *testing.T) {
+	script := `cat <<'EOF'
+{"type":"system","subtype":"init","session_id":"abc-123"}
+{"type":"assistant","message":{"content":[{"type":"text","text":"Let me check the tests."}]}}
+{"type":"assistant","message":{"content":[{"type":"tool_use","name":"Bash","input":{"command":"go test ./..."}}]}}
+{"type":"user","message":{"content":[{"type":"tool_result","content":"ok"}]}}
+{"type":"result","subtype":"success","is_error":false,"result":"All tests pass.","session_id":"abc-123","total_cost_usd":0.0421,"duration_ms":8120,"duration_api_ms":6500,"num_turns":3,"usage":{"input_tokens":12,"cache_creation_input_tokens":2000,"cache_read_input_tokens":30000,"output_tokens":450}}
+EOF
+`
+	agent, err := agents.NewClaudeCodeAgent(agents.ClaudeCodeAgentConfig{
+		ExecutablePath: writeFakeExecutable(t, script),
+		DefaultModel:   "sonnet",
+		BaseWorkDir:    t.TempDir(),
+	})
+	require.NoError(t, err)
+
+	var events []core.AgentEvent
+	result, err := agent.ExecuteCommandStream(context.Background(), core.AgentCommandInput{
+		Prompt:           "run the tests",
+		ExecutionContext: core.ExecutionContext{WorkingDir: t.TempDir()},
+	}, func(event core.AgentEvent) {
+		events = append(events, event)
+	})
+	require.NoError(t, err)
+
+	assert.True(t, result.Success)
+	assert.Equal(t, "All tests pass.", result.Response)
+	assert.Equal(t, "abc-123", result.SessionID)
+	assert.Equal(t, map[string]any{
+		core.MetadataSubtype:         "success",
+		core.MetadataCostUSD:         0.0421,
+		core.MetadataDurationMs:      int64(8120),
+		core.MetadataAPIDurationMs:   int64(6500),
+		core.MetadataTurns:           3,
+		core.MetadataInputTokens:     int64(2012),
+		core.MetadataOutputTokens:    int64(450),
+		core.MetadataCacheReadTokens: int64(30000),
+	}, result.Metadata)
+	assert.Equal(t, []core.AgentEvent{
+		{Type: core.AgentEventText, Text: "Let me check the tests."},
+		{Type: core.AgentEventToolUse, Text: "Bash: go test ./..."},
+	}, events)
+}
+
+func TestClaudeCodeAgentErrors(t *testing.T) {
+	testCases := []struct {
+		name           string
+		executablePath func(t *testing.T) string
+		expectedErr    error
+	}{
+		{
+			name: "CLI missing",
+			executablePath: func(t *testing.T) string {
+				return filepath.Join(t.TempDir(), "claude")
+			},
+			expectedErr: core.ErrClaudeCodeUnavailable,
+		},
+		{
+			name: "Non-zero exit",
+			executablePath: func(t *testing.T) string {
+				return writeFakeExecutable(t, `echo "Invalid API key" >&2; exit 1`)
+			},
+			expectedErr: core.ErrAgentExited,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			agent, err := agents.NewClaudeCodeAgent(agents.ClaudeCodeAgentConfig{
+				ExecutablePath: tc.executablePath(t),
+				DefaultModel:   "sonnet",
+				BaseWorkDir:    t.TempDir(),
+			})
+			require.NoError(t, err)
+
+			_, err = agent.ExecuteCommand(context.Background(), core.AgentCommandInput{
+				Prompt:           "run the tests",
+				ExecutionContext: core.ExecutionContext{WorkingDir: t.TempDir()},
+			})
+			assert.ErrorIs(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestClaudeCodeAgentResults(t *testing.T) {
+	testCases := []struct {
+		name             string
+		output           string
+		exitCode         int
+		expectedErr      error
+		expectedResponse string
+		expectedError    string
+	}{
+		{
+			name:          "Maximum turns reached",
+			output:        `{"type":"result","subtype":"error_max_turns","is_error":false,"session_id":"abc-123","num_turns":10,"cost_usd":0.5}`,
+			expectedError: "the agent reached the maximum number of turns (10) before finishing",
+		},
+		{
+			name:          "Error during execution",
+			output:        `{"type":"result","subtype":"error_during_execution","is_error":true,"session_id":"abc-123"}`,
+			expectedError: "the agent failed during execution",
+		},
+		{
+			name:             "Error reported in the result",
+			output:           `{"type":"result","subtype":"success","is_error":true,"result":"API Error: 529 overloaded","session_id":"abc-123"}`,
+			expectedResponse: "API Error: 529 overloaded",
+			expectedError:    "API Error: 529 overloaded",
+		},
+		{
+			name:             "Error result before a non-zero exit",
+			output:           `{"type":"result","subtype":"success","is_error":true,"result":"Credit balance is too low","session_id":"abc-123"}`,
+			exitCode:         1,
+			expectedResponse: "Credit balance is too low",
+			expectedError:    "Credit balance is too low",
+		},
+		{
+			name:        "No result event",
+			output:      `Loading configuration...`,
+			expectedErr: core.ErrAgentOutputInvalid,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// stderr noise must not end up in the result
+			script := "echo 'warning: update available' >&2\ncat <<'EOF'\n" + tc.output + "\nEOF\n" +
+				fmt.Sprintf("exit %d\n", tc.exitCode)
+			agent, err := agents.NewClaudeCodeAgent(agents.ClaudeCodeAgentConfig{
+				ExecutablePath: writeFakeExecutable(t, script),
+				DefaultModel:   "sonnet",
+				BaseWorkDir:    t.TempDir(),
+			})
+			require.NoError(t, err)
+
+			result, err := agent.ExecuteCommand(context.Background(), core.AgentCommandInput{
+				Prompt:           "run the tests",
+				ExecutionContext: core.ExecutionContext{WorkingDir: t.TempDir()},
+			})
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.False(t, result.Success)
+			assert.Equal(t, tc.expectedResponse, result.Response)
+			assert.Equal(t, tc.expectedError, result.Error)
+			assert.Equal(t, "abc-123", result.SessionID, "the session can still be resumed")
+			assert.NotEmpty(t, result.Metadata[core.MetadataSubtype])
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package agents
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+
+	"github.com/izzddalfk/kumote/internal/assistant/core"
+	"github.com/izzddalfk/kumote/internal/shared/utils/cliprocess"
+	"gopkg.in/validator.v2"
+)
+
+// GeminiCLIAgent implements the Agent interface using Gemini CLI
+type GeminiCLIAgent struct {
+	executablePath string
+	defaultModel   string
+	debug          bool
+}
+
+type GeminiCLIAgentConfig struct {
+	ExecutablePath string `validate:"nonzero"`
+	DefaultModel   string // Optional, Gemini CLI picks its own default model when empty
+	Debug          bool
+}
+
+// NewGeminiCLIAgent creates a new instance of GeminiCLIAgent
+func NewGeminiCLIAgent(config GeminiCLIAgentConfig) (*GeminiCLIAgent, error) {
+	if err := validator.Validate(config); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	return &GeminiCLIAgent{
+		executablePath: config.ExecutablePath,
+		defaultModel:   config.DefaultModel,
+		debug:          config.Debug,
+	}, nil
+}
+
+// geminiCLIResponse follows the output of `gemini --output-format json`
+type geminiCLIResponse struct {
+	Response string         `json:"response"`
+	Stats    map[string]any `json:"stats,omitempty"`
+	Error    *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+		Code    any    `json:"code,omitempty"`
+	} `json:"error,omitempty"`
+}
+
+// ExecuteCommand runs a prompt through Gemini CLI and returns the result
+func (g *GeminiCLIAgent) ExecuteCommand(ctx context.Context, input core.AgentCommandInput) (*core.QueryResult, error) {
+	rawOutput, err := g.runGeminiCommand(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	// Older Gemini CLI versions don't support JSON output and print plain text instead
+	trimmedOutput := strings.TrimSpace(rawOutput)
+	if !strings.HasPrefix(trimmedOutput, "{") {
+		return &core.QueryResult{
+			Success:  true,
+			Response: trimmedOutput,
+		}, nil
+	}
+
+	var response geminiCLIResponse
+	if err := json.Unmarshal([]byte(trimmedOutput), &response); err != nil {
+		// e.g. the CLI crashed while writing its output
+		slog.WarnContext(ctx, "failed to parse Gemini CLI output", slog.String("output", rawOutput))
+		return nil, fmt.Errorf("failed to parse gemini output: %w: %w", core.ErrAgentOutputInvalid, err)
+	}
+
+	if response.Error != nil {
+		return &core.QueryResult{
+			Success: false,
+			Error:   fmt.Sprintf("%s: %s", response.Error.Type, response.Error.Message),
+		}, nil
+	}
+
+	result := &core.QueryResult{
+		Success:  true,
+		Response: response.Response,
+	}
+	if len(response.Stats) > 0 {
+		result.Metadata = map[string]any{"stats": response.Stats}
+	}
+
+	return result, nil
+}
+
+// ExecuteCommandStream runs a prompt through Gemini CLI. Gemini CLI output is
+// only read once it finishes, so no progress event is emitted.
+func (g *GeminiCLIAgent) ExecuteCommandStream(ctx context.Context, input core.AgentCommandInput, onEvent func(core.AgentEvent)) (*core.QueryResult, error) {
+	return g.ExecuteCommand(ctx, input)
+}
+
+// IsAvailable checks if Gemini CLI is available
+func (g *GeminiCLIAgent) IsAvailable(ctx context.Context) bool {
+	cmd := exec.CommandContext(ctx, g.executablePath, "--version")
+	err := cmd.Run()
+	return err == nil
+}
+
+// runGeminiCommand executes Gemini CLI in non-interactive mode with the given prompt.
+// Gemini CLI doesn't support resuming a session by ID, so the session ID is ignored.
+func (g *GeminiCLIAgent) runGeminiCommand(ctx context.Context, input core.AgentCommandInput) (string, error) {
+	cmdArgs := []string{
+		"--output-format", "json",
+	}
+	if g.defaultModel != "" {
+		cmdArgs = append(cmdArgs, "--model", g.defaultModel)
+	}
+
+	// always add the prompt as the last argument
+	cmdArgs = append(cmdArgs, "--prompt", input.Prompt)
+
+	cmd := exec.CommandContext(ctx, g.executablePath, cmdArgs...)
+	cliprocess.KillTreeOnCancel(cmd)
+	cmd.Dir = input.ExecutionContext.WorkingDir
+
+	// Gemini CLI writes progress logs to stderr, keep them away from the response
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to execute gemini command: %w (stderr: %s)",
+			processError(err, core.ErrGeminiCLIUnavailable), strings.TrimSpace(stderr.String()))
+	}
+
+	if g.debug && stderr.Len() > 0 {
+		slog.DebugContext(ctx, "Gemini CLI stderr", slog.String("stderr", stderr.String()))
+	}
+
+	return stdout.String(), nil
+}
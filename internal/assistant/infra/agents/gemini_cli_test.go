@@ -0,0 +1,121 @@
+package agents_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/izzddalfk/kumote/internal/assistant/core"
+	"github.com/izzddalfk/kumote/internal/assistant/infra/agents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeFakeExecutable creates a shell script that stands in for an agent CLI
+func writeFakeExecutable(t *testing.T, script string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake executables are shell scripts")
+	}
+
+	path := filepath.Join(t.TempDir(), "fake-cli")
+	err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755)
+	require.NoError(t, err, "failed to write fake executable")
+
+	return path
+}
+
+func TestGeminiCLIAgentExecuteCommand(t *testing.T) {
+	testCases := []struct {
+		name             string
+		script           string
+		expectError      bool
+		expectedErr      error
+		expectedSuccess  bool
+		expectedResponse string
+		expectedError    string
+	}{
+		{
+			name: "JSON response",
+			script: `echo "Loaded cached credentials." >&2
+cat <<'EOF'
+{"response": "The project uses Go and SQLite.", "stats": {"models": {}}}
+EOF
+`,
+			expectedSuccess:  true,
+			expectedResponse: "The project uses Go and SQLite.",
+		},
+		{
+			name: "JSON error",
+			script: `cat <<'EOF'
+{"response": "", "error": {"type": "ApiError", "message": "quota exceeded", "code": 429}}
+EOF
+`,
+			expectedSuccess: false,
+			expectedError:   "ApiError: quota exceeded",
+		},
+		{
+			name:             "Plain text output from older versions",
+			script:           `echo "Plain answer"`,
+			expectedSuccess:  true,
+			expectedResponse: "Plain answer",
+		},
+		{
+			name:        "Truncated JSON output",
+			script:      `printf '{"response": "The project uses'`,
+			expectError: true,
+			expectedErr: core.ErrAgentOutputInvalid,
+		},
+		{
+			name:        "Non-zero exit",
+			script:      `echo "boom" >&2; exit 1`,
+			expectError: true,
+			expectedErr: core.ErrAgentExited,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			agent, err := agents.NewGeminiCLIAgent(agents.GeminiCLIAgentConfig{
+				ExecutablePath: writeFakeExecutable(t, tc.script),
+			})
+			require.NoError(t, err)
+
+			result, err := agent.ExecuteCommand(context.Background(), core.AgentCommandInput{
+				Prompt:           "what is the tech stack?",
+				ExecutionContext: core.ExecutionContext{WorkingDir: t.TempDir()},
+			})
+			if tc.expectError {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedSuccess, result.Success)
+			assert.Equal(t, tc.expectedResponse, result.Response)
+			assert.Equal(t, tc.expectedError, result.Error)
+		})
+	}
+}
+
+func TestGeminiCLIAgentArguments(t *testing.T) {
+	// The fake CLI echoes its working directory and arguments back as the response
+	script := `printf '{"response": "%s|%s"}' "$(pwd)" "$*"`
+	agent, err := agents.NewGeminiCLIAgent(agents.GeminiCLIAgentConfig{
+		ExecutablePath: writeFakeExecutable(t, script),
+		DefaultModel:   "gemini-2.5-flash",
+	})
+	require.NoError(t, err)
+
+	workDir, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+
+	result, err := agent.ExecuteCommand(context.Background(), core.AgentCommandInput{
+		Prompt:           "list the packages",
+		ExecutionContext: core.ExecutionContext{WorkingDir: workDir},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, workDir+"|--output-format json --model gemini-2.5-flash --prompt list the packages", result.Response)
+}
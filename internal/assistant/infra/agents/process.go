@@ -0,0 +1,25 @@
+package agents
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+
+	"github.com/izzddalfk/kumote/internal/assistant/core"
+	"github.com/izzddalfk/kumote/internal/shared/utils/cliprocess"
+)
+
+// processError wraps the error of running an agent CLI with the core error of its kind:
+// ErrAgentExited when the CLI failed with a non-zero exit code, or the unavailable error
+// of the agent when the CLI can't be started at all
+func processError(err, unavailable error) error {
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		return fmt.Errorf("%w: %w", core.ErrAgentExited, err)
+	case cliprocess.IsUnavailable(err):
+		return fmt.Errorf("%w: %w", unavailable, err)
+	default:
+		return err
+	}
+}
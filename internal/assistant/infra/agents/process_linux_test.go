@@ -0,0 +1,71 @@
+package agents_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/izzddalfk/kumote/internal/assistant/core"
+	"github.com/izzddalfk/kumote/internal/assistant/infra/agents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// processAlive checks /proc for the process, zombies waiting to be reaped are not alive
+func processAlive(pid int) bool {
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return false
+	}
+	// the state follows the command name, which is in parentheses
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
+}
+
+func TestClaudeCodeAgentCancelKillsProcessTree(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "child.pid")
+	// the fake CLI starts a long running tool, like an agent running tests
+	script := "sleep 30 &\necho $! > " + pidFile + "\nwait\n"
+
+	agent, err := agents.NewClaudeCodeAgent(agents.ClaudeCodeAgentConfig{
+		ExecutablePath: writeFakeExecutable(t, script),
+		DefaultModel:   "sonnet",
+		BaseWorkDir:    t.TempDir(),
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := agent.ExecuteCommandStream(ctx, core.AgentCommandInput{
+			Prompt:           "run the tests",
+			ExecutionContext: core.ExecutionContext{WorkingDir: t.TempDir()},
+		}, func(core.AgentEvent) {})
+		done <- err
+	}()
+
+	var pid int
+	require.Eventually(t, func() bool {
+		content, err := os.ReadFile(pidFile)
+		if err != nil {
+			return false
+		}
+		pid, err = strconv.Atoi(strings.TrimSpace(string(content)))
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the agent didn't stop after the cancellation")
+	}
+
+	assert.Eventually(t, func() bool { return !processAlive(pid) }, 5*time.Second, 10*time.Millisecond,
+		"the tool started by the agent should be killed too")
+}
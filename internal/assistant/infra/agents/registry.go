@@ -0,0 +1,71 @@
+package agents
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/izzddalfk/kumote/internal/assistant/core"
+	"gopkg.in/validator.v2"
+)
+
+// Names of the supported agents, used as keys in the registry
+const (
+	ClaudeCodeAgentName = "claude"
+	GeminiCLIAgentName  = "gemini"
+)
+
+// Registry implements the AgentRegistry interface with a fixed set of agents keyed by name
+type Registry struct {
+	agents       map[string]core.Agent
+	defaultAgent string
+}
+
+type RegistryConfig struct {
+	Agents       map[string]core.Agent `validate:"min=1"`
+	DefaultAgent string                `validate:"nonzero"`
+}
+
+// NewRegistry creates a new agent registry
+func NewRegistry(config RegistryConfig) (*Registry, error) {
+	if err := validator.Validate(config); err != nil {
+		return nil, fmt.Errorf("invalid registry config: %w", err)
+	}
+
+	agents := make(map[string]core.Agent, len(config.Agents))
+	for name, agent := range config.Agents {
+		if agent == nil {
+			return nil, fmt.Errorf("agent %q is nil", name)
+		}
+		agents[name] = agent
+	}
+
+	if _, ok := agents[config.DefaultAgent]; !ok {
+		return nil, fmt.Errorf("default agent %q is not configured", config.DefaultAgent)
+	}
+
+	return &Registry{
+		agents:       agents,
+		defaultAgent: config.DefaultAgent,
+	}, nil
+}
+
+// GetAgent returns the agent registered under the given name
+func (r *Registry) GetAgent(name string) (core.Agent, bool) {
+	agent, ok := r.agents[name]
+	return agent, ok
+}
+
+// DefaultAgent returns the default agent along with its name
+func (r *Registry) DefaultAgent() (string, core.Agent) {
+	return r.defaultAgent, r.agents[r.defaultAgent]
+}
+
+// Names returns the sorted names of all registered agents
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.agents))
+	for name := range r.agents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
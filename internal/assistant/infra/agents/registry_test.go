@@ -0,0 +1,42 @@
+package agents_test
+
+import (
+	"testing"
+
+	"github.com/izzddalfk/kumote/internal/assistant/core"
+	"github.com/izzddalfk/kumote/internal/assistant/infra/agents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	claude := &agents.ClaudeCodeAgent{}
+	gemini := &agents.GeminiCLIAgent{}
+
+	registry, err := agents.NewRegistry(agents.RegistryConfig{
+		Agents: map[string]core.Agent{
+			agents.ClaudeCodeAgentName: claude,
+			agents.GeminiCLIAgentName:  gemini,
+		},
+		DefaultAgent: agents.GeminiCLIAgentName,
+	})
+	require.NoError(t, err)
+
+	name, agent := registry.DefaultAgent()
+	assert.Equal(t, agents.GeminiCLIAgentName, name)
+	assert.Same(t, gemini, agent)
+
+	agent, ok := registry.GetAgent(agents.ClaudeCodeAgentName)
+	assert.True(t, ok)
+	assert.Same(t, claude, agent)
+
+	_, ok = registry.GetAgent("unknown")
+	assert.False(t, ok)
+	assert.Equal(t, []string{"claude", "gemini"}, registry.Names())
+
+	_, err = agents.NewRegistry(agents.RegistryConfig{
+		Agents:       map[string]core.Agent{agents.ClaudeCodeAgentName: claude},
+		DefaultAgent: agents.GeminiCLIAgentName,
+	})
+	assert.Error(t, err, "default agent must be registered")
+}
@@ -0,0 +1,353 @@
+package jobstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/izzddalfk/kumote/internal/assistant/core"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type JobStore struct {
+	db *sql.DB
+}
+
+// NewJobStore creates a new job store with SQLite
+func NewJobStore(dbPath string) (*JobStore, error) {
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open jobs database: %w", err)
+	}
+
+	store := &JobStore{
+		db: db,
+	}
+
+	if err := store.initSchema(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize jobs schema: %w", err)
+	}
+
+	return store, nil
+}
+
+// Close closes the database connection
+func (js *JobStore) Close() error {
+	return js.db.Close()
+}
+
+// SaveQueuedJob stores a job waiting for its turn
+func (js *JobStore) SaveQueuedJob(ctx context.Context, job core.QueuedJob) error {
+	slog.DebugContext(ctx, "Saving queued job",
+		"queued_job_id", job.ID,
+		"command_id", job.Command.ID,
+		"project", job.ProjectName,
+	)
+
+	query := `
+		INSERT INTO queued_jobs (
+			id, command_id, user_id, chat_id, text, agent_name, prompt,
+			project_name, project_path, journal_id, queued_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := js.db.ExecContext(ctx, query,
+		job.ID,
+		job.Command.ID,
+		job.Command.UserID,
+		job.Command.ChatID,
+		job.Command.Text,
+		job.AgentName,
+		job.Prompt,
+		job.ProjectName,
+		job.ProjectPath,
+		job.JournalID,
+		job.QueuedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save queued job: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteQueuedJob removes the job once it started or was cancelled
+func (js *JobStore) DeleteQueuedJob(ctx context.Context, id string) error {
+	_, err := js.db.ExecContext(ctx, `DELETE FROM queued_jobs WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete queued job: %w", err)
+	}
+
+	return nil
+}
+
+// ListQueuedJobs returns the stored jobs, oldest first
+func (js *JobStore) ListQueuedJobs(ctx context.Context) ([]core.QueuedJob, error) {
+	query := `
+		SELECT id, command_id, user_id, chat_id, text, agent_name, prompt,
+			project_name, project_path, journal_id, queued_at
+		FROM queued_jobs
+		ORDER BY queued_at, rowid
+	`
+
+	rows, err := js.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list queued jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []core.QueuedJob
+	for rows.Next() {
+		var job core.QueuedJob
+		if err := rows.Scan(
+			&job.ID,
+			&job.Command.ID,
+			&job.Command.UserID,
+			&job.Command.ChatID,
+			&job.Command.Text,
+			&job.AgentName,
+			&job.Prompt,
+			&job.ProjectName,
+			&job.ProjectPath,
+			&job.JournalID,
+			&job.QueuedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan queued job: %w", err)
+		}
+		job.Command.Timestamp = job.QueuedAt
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list queued jobs: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// RecordCommand stores a newly accepted command and returns the ID of its entry
+func (js *JobStore) RecordCommand(ctx context.Context, entry core.JournalEntry) (int64, error) {
+	slog.DebugContext(ctx, "Recording command",
+		"command_id", entry.CommandID,
+		"chat_id", entry.ChatID,
+		"status", entry.Status,
+	)
+
+	query := `
+		INSERT INTO commands (
+			command_id, user_id, chat_id, text, agent_name, project,
+			status, error, created_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := js.db.ExecContext(ctx, query,
+		entry.CommandID,
+		entry.UserID,
+		entry.ChatID,
+		entry.Text,
+		entry.AgentName,
+		entry.Project,
+		entry.Status,
+		entry.Error,
+		entry.CreatedAt,
+		entry.UpdatedAt,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record command: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get recorded command ID: %w", err)
+	}
+
+	return id, nil
+}
+
+// UpdateCommand sets the status of the entry with the same ID, along with
+// its agent, project and error when they're not empty
+func (js *JobStore) UpdateCommand(ctx context.Context, entry core.JournalEntry) error {
+	slog.DebugContext(ctx, "Updating command",
+		"journal_id", entry.ID,
+		"status", entry.Status,
+	)
+
+	query := `
+		UPDATE commands SET
+			status = ?,
+			agent_name = COALESCE(NULLIF(?, ''), agent_name),
+			project = COALESCE(NULLIF(?, ''), project),
+			error = COALESCE(NULLIF(?, ''), error),
+			updated_at = ?
+		WHERE id = ?
+	`
+
+	_, err := js.db.ExecContext(ctx, query,
+		entry.Status,
+		entry.AgentName,
+		entry.Project,
+		entry.Error,
+		entry.UpdatedAt,
+		entry.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update command: %w", err)
+	}
+
+	return nil
+}
+
+// GetCommand returns the entry, or nil when there is none
+func (js *JobStore) GetCommand(ctx context.Context, id int64) (*core.JournalEntry, error) {
+	row := js.db.QueryRowContext(ctx, `SELECT `+commandColumns+` FROM commands WHERE id = ?`, id)
+
+	entry, err := scanCommand(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get command: %w", err)
+	}
+
+	return &entry, nil
+}
+
+// ListCommands returns the latest entries of the chat, newest first
+func (js *JobStore) ListCommands(ctx context.Context, chatID int64, limit int) ([]core.JournalEntry, error) {
+	query := `SELECT ` + commandColumns + ` FROM commands WHERE chat_id = ? ORDER BY id DESC LIMIT ?`
+
+	rows, err := js.db.QueryContext(ctx, query, chatID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list commands: %w", err)
+	}
+	defer rows.Close()
+
+	return scanCommands(rows)
+}
+
+// InterruptCommands marks the entries left accepted, waiting or running by a previous
+// process as interrupted and returns them
+func (js *JobStore) InterruptCommands(ctx context.Context) ([]core.JournalEntry, error) {
+	query := `
+		UPDATE commands SET status = ?, updated_at = ?
+		WHERE status IN (?, ?, ?)
+		RETURNING ` + commandColumns
+
+	rows, err := js.db.QueryContext(ctx, query,
+		core.CommandStatusInterrupted,
+		time.Now(),
+		core.CommandStatusAccepted,
+		core.CommandStatusWaiting,
+		core.CommandStatusRunning,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to interrupt commands: %w", err)
+	}
+	defer rows.Close()
+
+	entries, err := scanCommands(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// RETURNING doesn't guarantee any order
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+
+	return entries, nil
+}
+
+const commandColumns = `id, command_id, user_id, chat_id, text, agent_name, project,
+	status, error, created_at, updated_at`
+
+// scanCommand scans a row selected with commandColumns
+func scanCommand(row interface{ Scan(...any) error }) (core.JournalEntry, error) {
+	var entry core.JournalEntry
+	err := row.Scan(
+		&entry.ID,
+		&entry.CommandID,
+		&entry.UserID,
+		&entry.ChatID,
+		&entry.Text,
+		&entry.AgentName,
+		&entry.Project,
+		&entry.Status,
+		&entry.Error,
+		&entry.CreatedAt,
+		&entry.UpdatedAt,
+	)
+	return entry, err
+}
+
+func scanCommands(rows *sql.Rows) ([]core.JournalEntry, error) {
+	var entries []core.JournalEntry
+	for rows.Next() {
+		entry, err := scanCommand(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan command: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list commands: %w", err)
+	}
+
+	return entries, nil
+}
+
+// initSchema initializes the database schema
+func (js *JobStore) initSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS queued_jobs (
+		id TEXT PRIMARY KEY,
+		command_id TEXT NOT NULL,
+		user_id INTEGER NOT NULL,
+		chat_id INTEGER NOT NULL,
+		text TEXT NOT NULL,
+		agent_name TEXT NOT NULL,
+		prompt TEXT NOT NULL,
+		project_name TEXT NOT NULL,
+		project_path TEXT NOT NULL,
+		journal_id INTEGER NOT NULL DEFAULT 0,
+		queued_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS commands (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		command_id TEXT NOT NULL,
+		user_id INTEGER NOT NULL,
+		chat_id INTEGER NOT NULL,
+		text TEXT NOT NULL,
+		agent_name TEXT NOT NULL,
+		project TEXT NOT NULL,
+		status TEXT NOT NULL,
+		error TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_commands_chat_id ON commands(chat_id);
+	CREATE INDEX IF NOT EXISTS idx_commands_status ON commands(status);
+	`
+
+	if _, err := js.db.Exec(schema); err != nil {
+		return err
+	}
+
+	// queued jobs stored before the command journal existed have no journal entry
+	var hasJournalID bool
+	if err := js.db.QueryRow(
+		`SELECT COUNT(*) > 0 FROM pragma_table_info('queued_jobs') WHERE name = 'journal_id'`,
+	).Scan(&hasJournalID); err != nil {
+		return err
+	}
+	if !hasJournalID {
+		_, err := js.db.Exec(`ALTER TABLE queued_jobs ADD COLUMN journal_id INTEGER NOT NULL DEFAULT 0`)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package jobstore_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/izzddalfk/kumote/internal/assistant/core"
+	"github.com/izzddalfk/kumote/internal/assistant/infra/jobstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobStoreQueuedJobs(t *testing.T) {
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "jobs.db")
+	store, err := jobstore.NewJobStore(dbPath)
+	require.NoError(t, err)
+
+	jobs, err := store.ListQueuedJobs(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, jobs)
+
+	queuedAt := time.Now().UTC().Truncate(time.Second)
+	first := core.QueuedJob{
+		ID:          "a1",
+		Command:     core.Command{ID: "10", UserID: 42, ChatID: 42, Text: "@gemini run the tests in carlogbook", Timestamp: queuedAt},
+		AgentName:   "gemini",
+		Prompt:      "run the tests in carlogbook",
+		ProjectName: "carlogbook",
+		ProjectPath: "/projects/carlogbook",
+		JournalID:   7,
+		QueuedAt:    queuedAt,
+	}
+	second := first
+	second.ID = "b2"
+	second.Command.ID = "11"
+	second.QueuedAt = queuedAt.Add(time.Second)
+	second.Command.Timestamp = second.QueuedAt
+
+	require.NoError(t, store.SaveQueuedJob(ctx, second))
+	require.NoError(t, store.SaveQueuedJob(ctx, first))
+	require.NoError(t, store.Close())
+
+	// queued jobs survive a restart
+	store, err = jobstore.NewJobStore(dbPath)
+	require.NoError(t, err)
+	defer store.Close()
+
+	jobs, err = store.ListQueuedJobs(ctx)
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+	assert.Equal(t, "a1", jobs[0].ID, "oldest job first")
+	assert.True(t, queuedAt.Equal(jobs[0].QueuedAt))
+	jobs[0].QueuedAt, jobs[0].Command.Timestamp = first.QueuedAt, first.Command.Timestamp
+	assert.Equal(t, first, jobs[0])
+
+	require.NoError(t, store.DeleteQueuedJob(ctx, "a1"))
+	jobs, err = store.ListQueuedJobs(ctx)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, "b2", jobs[0].ID)
+}
+
+func TestJobStoreCommandJournal(t *testing.T) {
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "jobs.db")
+	store, err := jobstore.NewJobStore(dbPath)
+	require.NoError(t, err)
+
+	entry, err := store.GetCommand(ctx, 1)
+	require.NoError(t, err)
+	assert.Nil(t, entry, "unknown entry should be nil")
+
+	createdAt := time.Now().UTC().Truncate(time.Second)
+	record := func(commandID, text string, status core.CommandStatus) int64 {
+		id, err := store.RecordCommand(ctx, core.JournalEntry{
+			CommandID: commandID, UserID: 42, ChatID: 42, Text: text,
+			Status: status, CreatedAt: createdAt, UpdatedAt: createdAt,
+		})
+		require.NoError(t, err)
+		return id
+	}
+	done := record("10", "/help", core.CommandStatusAccepted)
+	running := record("11", "run the tests in carlogbook", core.CommandStatusAccepted)
+	queued := record("12", "fix the lint in kumote", core.CommandStatusAccepted)
+	waiting := record("13", "show main.go", core.CommandStatusAccepted)
+	assert.Greater(t, running, done)
+
+	require.NoError(t, store.UpdateCommand(ctx, core.JournalEntry{ID: done, Status: core.CommandStatusDone, UpdatedAt: createdAt}))
+	require.NoError(t, store.UpdateCommand(ctx, core.JournalEntry{
+		ID: running, Status: core.CommandStatusRunning, AgentName: "claude", Project: "carlogbook", UpdatedAt: createdAt,
+	}))
+	require.NoError(t, store.UpdateCommand(ctx, core.JournalEntry{ID: queued, Status: core.CommandStatusQueued, UpdatedAt: createdAt}))
+	require.NoError(t, store.UpdateCommand(ctx, core.JournalEntry{ID: waiting, Status: core.CommandStatusWaiting, UpdatedAt: createdAt}))
+	require.NoError(t, store.Close())
+
+	// the journal survives a restart
+	store, err = jobstore.NewJobStore(dbPath)
+	require.NoError(t, err)
+	defer store.Close()
+
+	interrupted, err := store.InterruptCommands(ctx)
+	require.NoError(t, err)
+	require.Len(t, interrupted, 2, "queued commands are resumed, not interrupted")
+	assert.Equal(t, running, interrupted[0].ID)
+	assert.Equal(t, core.CommandStatusInterrupted, interrupted[0].Status)
+	assert.Equal(t, "carlogbook", interrupted[0].Project, "updates without a project should keep it")
+	assert.Equal(t, waiting, interrupted[1].ID)
+
+	interrupted, err = store.InterruptCommands(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, interrupted, "commands should only be interrupted once")
+
+	entry, err = store.GetCommand(ctx, running)
+	require.NoError(t, err)
+	require.NotNil(t, entry)
+	assert.Equal(t, "run the tests in carlogbook", entry.Text)
+	assert.Equal(t, "claude", entry.AgentName)
+	assert.True(t, createdAt.Equal(entry.CreatedAt))
+
+	require.NoError(t, store.UpdateCommand(ctx, core.JournalEntry{
+		ID: queued, Status: core.CommandStatusFailed, Error: "agent crashed", UpdatedAt: createdAt,
+	}))
+
+	entries, err := store.ListCommands(ctx, 42, 3)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, waiting, entries[0].ID, "newest entry first")
+	assert.Equal(t, core.CommandStatusFailed, entries[1].Status)
+	assert.Equal(t, "agent crashed", entries[1].Error)
+
+	entries, err = store.ListCommands(ctx, 7, 10)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "other chats have no history")
+}
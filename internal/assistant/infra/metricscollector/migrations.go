@@ -0,0 +1,87 @@
+package metricscollector
+
+import "fmt"
+
+// migrations evolve the metrics schema, each one runs once in its own transaction and
+// is recorded in `schema_migrations` by its version, the position in the list starting at 1.
+// Never edit or reorder them, append a new one instead.
+var migrations = []string{
+	// 1: the original schema, databases created before migrations already have it
+	`
+	CREATE TABLE IF NOT EXISTS command_metrics (
+id INTEGER PRIMARY KEY AUTOINCREMENT,
+command_id TEXT NOT NULL,
+user_id INTEGER NOT NULL,
+execution_time_ms INTEGER NOT NULL,
+success BOOLEAN NOT NULL,
+project_used TEXT,
+error_type TEXT,
+timestamp DATETIME NOT NULL
+);
+	CREATE INDEX IF NOT EXISTS idx_metrics_user_id ON command_metrics(user_id);
+	CREATE INDEX IF NOT EXISTS idx_metrics_timestamp ON command_metrics(timestamp);
+	CREATE INDEX IF NOT EXISTS idx_metrics_command_id ON command_metrics(command_id);
+	`,
+	// 2: the agent and the size of the prompt and response
+	`
+	ALTER TABLE command_metrics ADD COLUMN agent_name TEXT NOT NULL DEFAULT '';
+	ALTER TABLE command_metrics ADD COLUMN prompt_length INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE command_metrics ADD COLUMN response_length INTEGER NOT NULL DEFAULT 0;
+	`,
+	// 3: what the agent runs cost
+	`
+	ALTER TABLE command_metrics ADD COLUMN cost_usd REAL NOT NULL DEFAULT 0;
+	ALTER TABLE command_metrics ADD COLUMN input_tokens INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE command_metrics ADD COLUMN output_tokens INTEGER NOT NULL DEFAULT 0;
+	`,
+}
+
+// migrate applies the migrations the database doesn't have yet
+func (mc *MetricsCollector) migrate() error {
+	if _, err := mc.db.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		applied_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	`); err != nil {
+		return fmt.Errorf("failed to create schema migrations table: %w", err)
+	}
+
+	current, err := mc.SchemaVersion()
+	if err != nil {
+		return fmt.Errorf("failed to get schema version: %w", err)
+	}
+
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+		if err := mc.applyMigration(version, migrations[i]); err != nil {
+			return fmt.Errorf("failed to apply migration %d: %w", version, err)
+		}
+	}
+
+	return nil
+}
+
+func (mc *MetricsCollector) applyMigration(version int, migration string) error {
+	tx, err := mc.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(migration); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, version); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SchemaVersion returns the version of the last applied migration
+func (mc *MetricsCollector) SchemaVersion() (int, error) {
+	var version int
+	err := mc.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	return version, err
+}
@@ -0,0 +1,81 @@
+package metricscollector_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/izzddalfk/kumote/internal/assistant/core"
+	"github.com/izzddalfk/kumote/internal/assistant/infra/metricscollector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsCollectorMigratesExistingDatabase(t *testing.T) {
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "metrics.db")
+
+	// a database created before schema migrations existed
+	db, err := sql.Open("sqlite3", dbPath)
+	require.NoError(t, err)
+	_, err = db.Exec(`
+	CREATE TABLE command_metrics (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		command_id TEXT NOT NULL,
+		user_id INTEGER NOT NULL,
+		execution_time_ms INTEGER NOT NULL,
+		success BOOLEAN NOT NULL,
+		project_used TEXT,
+		error_type TEXT,
+		timestamp DATETIME NOT NULL
+	);
+	INSERT INTO command_metrics (command_id, user_id, execution_time_ms, success, timestamp)
+	VALUES ('1', 42, 1500, 1, datetime('now', '-1 minute'));
+	`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	collector, err := metricscollector.NewMetricsCollector(dbPath)
+	require.NoError(t, err)
+	version, err := collector.SchemaVersion()
+	require.NoError(t, err)
+	assert.Equal(t, 3, version)
+
+	require.NoError(t, collector.RecordCommandExecution(ctx, core.CommandMetrics{
+		CommandID:      "2",
+		UserID:         42,
+		ExecutionTime:  3 * time.Second,
+		Success:        false,
+		ProjectUsed:    "carlogbook",
+		AgentName:      "claude",
+		ErrorType:      core.ErrorTypeTimeout,
+		PromptLength:   12,
+		ResponseLength: 0,
+		Timestamp:      time.Now(),
+	}))
+	require.NoError(t, collector.Close())
+
+	// migrations run once
+	collector, err = metricscollector.NewMetricsCollector(dbPath)
+	require.NoError(t, err)
+	defer collector.Close()
+
+	report, err := collector.ReportCommandMetrics(ctx, time.Now().Add(-time.Hour), time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Commands, "rows recorded before the migration should be kept")
+	assert.Equal(t, 1, report.Failed)
+
+	db, err = sql.Open("sqlite3", dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+	var agentName, errorType string
+	var promptLength int
+	require.NoError(t, db.QueryRow(
+		`SELECT agent_name, error_type, prompt_length FROM command_metrics WHERE command_id = '2'`,
+	).Scan(&agentName, &errorType, &promptLength))
+	assert.Equal(t, "claude", agentName)
+	assert.Equal(t, core.ErrorTypeTimeout, errorType)
+	assert.Equal(t, 12, promptLength)
+}
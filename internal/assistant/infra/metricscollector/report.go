@@ -0,0 +1,142 @@
+package metricscollector
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/izzddalfk/kumote/internal/assistant/core"
+)
+
+// GetUserUsage sums the usage of the commands of the user executed since the given time
+func (mc *MetricsCollector) GetUserUsage(ctx context.Context, userID int64, since time.Time) (*core.Usage, error) {
+	query := `
+		SELECT COALESCE(SUM(cost_usd), 0), COALESCE(SUM(input_tokens), 0), COALESCE(SUM(output_tokens), 0)
+		FROM command_metrics
+		WHERE user_id = ? AND julianday(timestamp) >= julianday(?)
+	`
+
+	var usage core.Usage
+	if err := mc.db.QueryRowContext(ctx, query, userID, since).Scan(&usage.CostUSD, &usage.InputTokens, &usage.OutputTokens); err != nil {
+		return nil, fmt.Errorf("failed to query user usage: %w", err)
+	}
+
+	return &usage, nil
+}
+
+// ReportCommandMetrics aggregates the metrics of the commands executed in [since, until)
+func (mc *MetricsCollector) ReportCommandMetrics(ctx context.Context, since, until time.Time) (*core.MetricsReport, error) {
+	query := `
+		SELECT user_id, execution_time_ms, success, COALESCE(project_used, '')
+		FROM command_metrics
+		WHERE julianday(timestamp) >= julianday(?) AND julianday(timestamp) < julianday(?)
+	`
+
+	// timestamps are compared as julian days since they're stored with the UTC offset of the time
+	rows, err := mc.db.QueryContext(ctx, query, since, until)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query command metrics: %w", err)
+	}
+	defer rows.Close()
+
+	total := &summaryBuilder{}
+	projects := make(map[string]*summaryBuilder)
+	users := make(map[int64]*summaryBuilder)
+	for rows.Next() {
+		var (
+			userID          int64
+			executionTimeMs int64
+			success         bool
+			project         string
+		)
+		if err := rows.Scan(&userID, &executionTimeMs, &success, &project); err != nil {
+			return nil, fmt.Errorf("failed to scan command metrics: %w", err)
+		}
+
+		executionTime := time.Duration(executionTimeMs) * time.Millisecond
+		total.add(executionTime, success)
+		if projects[project] == nil {
+			projects[project] = &summaryBuilder{}
+		}
+		projects[project].add(executionTime, success)
+		if users[userID] == nil {
+			users[userID] = &summaryBuilder{}
+		}
+		users[userID].add(executionTime, success)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query command metrics: %w", err)
+	}
+
+	report := &core.MetricsReport{
+		Since:          since,
+		Until:          until,
+		Projects:       []core.ProjectMetrics{},
+		Users:          []core.UserMetrics{},
+		MetricsSummary: total.summary(),
+	}
+	for project, builder := range projects {
+		report.Projects = append(report.Projects, core.ProjectMetrics{Project: project, MetricsSummary: builder.summary()})
+	}
+	sort.Slice(report.Projects, func(i, j int) bool {
+		a, b := report.Projects[i], report.Projects[j]
+		if a.Commands != b.Commands {
+			return a.Commands > b.Commands
+		}
+		return a.Project < b.Project
+	})
+	for userID, builder := range users {
+		report.Users = append(report.Users, core.UserMetrics{UserID: userID, MetricsSummary: builder.summary()})
+	}
+	sort.Slice(report.Users, func(i, j int) bool {
+		a, b := report.Users[i], report.Users[j]
+		if a.Commands != b.Commands {
+			return a.Commands > b.Commands
+		}
+		return a.UserID < b.UserID
+	})
+
+	return report, nil
+}
+
+// summaryBuilder collects the execution times of the commands to summarize
+type summaryBuilder struct {
+	executionTimes []time.Duration
+	succeeded      int
+}
+
+func (b *summaryBuilder) add(executionTime time.Duration, success bool) {
+	b.executionTimes = append(b.executionTimes, executionTime)
+	if success {
+		b.succeeded++
+	}
+}
+
+func (b *summaryBuilder) summary() core.MetricsSummary {
+	commands := len(b.executionTimes)
+	if commands == 0 {
+		return core.MetricsSummary{}
+	}
+
+	sort.Slice(b.executionTimes, func(i, j int) bool { return b.executionTimes[i] < b.executionTimes[j] })
+
+	return core.MetricsSummary{
+		Commands:         commands,
+		Succeeded:        b.succeeded,
+		Failed:           commands - b.succeeded,
+		SuccessRate:      float64(b.succeeded) / float64(commands),
+		P50ExecutionTime: percentile(b.executionTimes, 50),
+		P95ExecutionTime: percentile(b.executionTimes, 95),
+	}
+}
+
+// percentile returns the nearest-rank percentile of the sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,105 @@
+package metricscollector_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/izzddalfk/kumote/internal/assistant/core"
+	"github.com/izzddalfk/kumote/internal/assistant/infra/metricscollector"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportCommandMetrics(t *testing.T) {
+	ctx := context.Background()
+	collector, err := metricscollector.NewMetricsCollector(filepath.Join(t.TempDir(), "metrics.db"))
+	require.NoError(t, err)
+	defer collector.Close()
+
+	now := time.Now()
+	record := func(userID int64, project string, seconds int, success bool, at time.Time) {
+		require.NoError(t, collector.RecordCommandExecution(ctx, core.CommandMetrics{
+			CommandID:     "1",
+			UserID:        userID,
+			ExecutionTime: time.Duration(seconds) * time.Second,
+			Success:       success,
+			ProjectUsed:   project,
+			Timestamp:     at,
+		}))
+	}
+	for seconds := 1; seconds <= 10; seconds++ {
+		record(42, "carlogbook", seconds, seconds != 10, now.Add(-time.Duration(seconds)*time.Minute))
+	}
+	record(7, "kumote", 30, true, now.Add(-30*time.Minute).UTC())
+	record(42, "", 1, false, now.Add(-40*time.Minute))
+	// outside of the period
+	record(42, "kumote", 100, true, now.Add(-2*time.Hour))
+	record(42, "kumote", 100, true, now.Add(time.Minute))
+
+	report, err := collector.ReportCommandMetrics(ctx, now.Add(-time.Hour), now)
+	require.NoError(t, err)
+
+	assert.Equal(t, 12, report.Commands)
+	assert.Equal(t, 10, report.Succeeded)
+	assert.Equal(t, 2, report.Failed)
+	assert.InDelta(t, 10.0/12, report.SuccessRate, 0.001)
+	assert.Equal(t, 5*time.Second, report.P50ExecutionTime)
+	assert.Equal(t, 30*time.Second, report.P95ExecutionTime)
+
+	require.Len(t, report.Projects, 3)
+	assert.Equal(t, "carlogbook", report.Projects[0].Project, "busiest project first")
+	assert.Equal(t, 10, report.Projects[0].Commands)
+	assert.InDelta(t, 0.9, report.Projects[0].SuccessRate, 0.001)
+	assert.Equal(t, 5*time.Second, report.Projects[0].P50ExecutionTime)
+	assert.Equal(t, 10*time.Second, report.Projects[0].P95ExecutionTime)
+	assert.Equal(t, "", report.Projects[1].Project, "commands without a project are grouped together")
+	assert.Equal(t, "kumote", report.Projects[2].Project)
+
+	require.Len(t, report.Users, 2)
+	assert.Equal(t, int64(42), report.Users[0].UserID)
+	assert.Equal(t, 11, report.Users[0].Commands)
+	assert.Equal(t, core.UserMetrics{UserID: 7, MetricsSummary: core.MetricsSummary{
+		Commands: 1, Succeeded: 1, SuccessRate: 1, P50ExecutionTime: 30 * time.Second, P95ExecutionTime: 30 * time.Second,
+	}}, report.Users[1])
+
+	empty, err := collector.ReportCommandMetrics(ctx, now.Add(-time.Hour*24*365), now.Add(-time.Hour*24*300))
+	require.NoError(t, err)
+	assert.Zero(t, empty.Commands)
+	assert.Empty(t, empty.Projects)
+}
+
+func TestGetUserUsage(t *testing.T) {
+	ctx := context.Background()
+	collector, err := metricscollector.NewMetricsCollector(filepath.Join(t.TempDir(), "metrics.db"))
+	require.NoError(t, err)
+	defer collector.Close()
+
+	now := time.Now()
+	record := func(userID int64, usage core.Usage, at time.Time) {
+		require.NoError(t, collector.RecordCommandExecution(ctx, core.CommandMetrics{
+			CommandID: "1",
+			UserID:    userID,
+			Success:   true,
+			Usage:     usage,
+			Timestamp: at,
+		}))
+	}
+	record(42, core.Usage{CostUSD: 0.25, InputTokens: 1000, OutputTokens: 100}, now.Add(-time.Minute))
+	record(42, core.Usage{CostUSD: 0.5, InputTokens: 3000, OutputTokens: 300}, now.Add(-30*time.Minute).UTC())
+	record(42, core.Usage{}, now.Add(-40*time.Minute))
+	// another user, and before the period
+	record(7, core.Usage{CostUSD: 9, InputTokens: 9000, OutputTokens: 900}, now.Add(-time.Minute))
+	record(42, core.Usage{CostUSD: 9, InputTokens: 9000, OutputTokens: 900}, now.Add(-2*time.Hour))
+
+	usage, err := collector.GetUserUsage(ctx, 42, now.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.InDelta(t, 0.75, usage.CostUSD, 0.0001)
+	assert.Equal(t, int64(4000), usage.InputTokens)
+	assert.Equal(t, int64(400), usage.OutputTokens)
+
+	usage, err = collector.GetUserUsage(ctx, 99, now.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, core.Usage{}, *usage, "users without commands have no usage")
+}
@@ -25,7 +25,7 @@ func NewMetricsCollector(dbPath string) (*MetricsCollector, error) {
 		db: db,
 	}
 
-	if err := collector.initSchema(); err != nil {
+	if err := collector.migrate(); err != nil {
 		db.Close()
 		return nil, fmt.Errorf("failed to initialize metrics schema: %w", err)
 	}
@@ -43,15 +43,19 @@ func (mc *MetricsCollector) RecordCommandExecution(ctx context.Context, metrics
 	slog.DebugContext(ctx, "Recording command execution metrics",
 		"command_id", metrics.CommandID,
 		"user_id", metrics.UserID,
+		"agent", metrics.AgentName,
 		"execution_time_ms", metrics.ExecutionTime.Milliseconds(),
 		"success", metrics.Success,
+		"error_type", metrics.ErrorType,
+		"cost_usd", metrics.CostUSD,
 	)
 
 	query := `
 		INSERT INTO command_metrics (
 command_id, user_id, execution_time_ms, success,
-project_used, error_type, timestamp
-) VALUES (?, ?, ?, ?, ?, ?, ?)
+project_used, error_type, agent_name, prompt_length, response_length,
+cost_usd, input_tokens, output_tokens, timestamp
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	_, err := mc.db.ExecContext(ctx, query,
@@ -61,6 +65,12 @@ project_used, error_type, timestamp
 		metrics.Success,
 		metrics.ProjectUsed,
 		metrics.ErrorType,
+		metrics.AgentName,
+		metrics.PromptLength,
+		metrics.ResponseLength,
+		metrics.CostUSD,
+		metrics.InputTokens,
+		metrics.OutputTokens,
 		metrics.Timestamp,
 	)
 
@@ -74,25 +84,3 @@ project_used, error_type, timestamp
 
 	return nil
 }
-
-// initSchema initializes the database schema
-func (mc *MetricsCollector) initSchema() error {
-	schema := `
-	CREATE TABLE IF NOT EXISTS command_metrics (
-id INTEGER PRIMARY KEY AUTOINCREMENT,
-command_id TEXT NOT NULL,
-user_id INTEGER NOT NULL,
-execution_time_ms INTEGER NOT NULL,
-success BOOLEAN NOT NULL,
-project_used TEXT,
-error_type TEXT,
-timestamp DATETIME NOT NULL
-);
-	CREATE INDEX IF NOT EXISTS idx_metrics_user_id ON command_metrics(user_id);
-	CREATE INDEX IF NOT EXISTS idx_metrics_timestamp ON command_metrics(timestamp);
-	CREATE INDEX IF NOT EXISTS idx_metrics_command_id ON command_metrics(command_id);
-	`
-
-	_, err := mc.db.Exec(schema)
-	return err
-}
@@ -0,0 +1,199 @@
+package prommetrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/izzddalfk/kumote/internal/assistant/core"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// outcomeSuccess is the outcome label of the commands and agent runs that succeeded
+const outcomeSuccess = "success"
+
+// agentDurationBuckets are the upper bounds, in seconds, of the agent execution duration buckets
+var agentDurationBuckets = []float64{1, 5, 10, 30, 60, 120, 300, 600}
+
+// Metrics holds the live operational metrics of the assistant. They're collected by
+// decorators around the ports of the core service, so the core doesn't know about them.
+type Metrics struct {
+	registry             *prometheus.Registry
+	commands             *prometheus.CounterVec
+	agentDuration        *prometheus.HistogramVec
+	jobsInFlight         *prometheus.GaugeVec
+	telegramSendFailures *prometheus.CounterVec
+	rateLimitBlocks      prometheus.Counter
+}
+
+// NewMetrics registers the metrics of the assistant in a registry of their own
+func NewMetrics() *Metrics {
+	registry := prometheus.NewRegistry()
+	factory := promauto.With(registry)
+
+	return &Metrics{
+		registry: registry,
+		commands: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "kumote_commands_total",
+			Help: "Commands processed, by outcome and agent.",
+		}, []string{"outcome", "agent"}),
+		agentDuration: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "kumote_agent_execution_duration_seconds",
+			Help:    "Time agents took to run a command, by agent and outcome.",
+			Buckets: agentDurationBuckets,
+		}, []string{"agent", "outcome"}),
+		jobsInFlight: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "kumote_jobs_in_flight",
+			Help: "Agent jobs running right now, by agent.",
+		}, []string{"agent"}),
+		telegramSendFailures: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "kumote_telegram_send_failures_total",
+			Help: "Telegram API calls sending or editing messages that failed, by method.",
+		}, []string{"method"}),
+		// counters without labels are exposed from the start, so rates are computed from zero
+		rateLimitBlocks: factory.NewCounter(prometheus.CounterOpts{
+			Name: "kumote_rate_limit_blocks_total",
+			Help: "Commands rejected by the rate limiter.",
+		}),
+	}
+}
+
+// Handler serves the metrics to Prometheus scrapes
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// WrapMetricsCollector counts the commands recorded by the collector
+func (m *Metrics) WrapMetricsCollector(collector core.MetricsCollector) core.MetricsCollector {
+	return &metricsCollector{next: collector, metrics: m}
+}
+
+// WrapTelegram counts the failures of the messages sent or edited with the Telegram client
+func (m *Metrics) WrapTelegram(telegram core.TelegramStorage) core.TelegramStorage {
+	return &telegramStorage{TelegramStorage: telegram, metrics: m}
+}
+
+// WrapRateLimiter counts the commands rejected by the rate limiter
+func (m *Metrics) WrapRateLimiter(limiter core.RateLimiter) core.RateLimiter {
+	return &rateLimiter{RateLimiter: limiter, metrics: m}
+}
+
+// WrapAgents measures the runs of every agent of the registry
+func (m *Metrics) WrapAgents(agents core.AgentRegistry) core.AgentRegistry {
+	return &agentRegistry{next: agents, metrics: m}
+}
+
+type metricsCollector struct {
+	next    core.MetricsCollector
+	metrics *Metrics
+}
+
+func (c *metricsCollector) RecordCommandExecution(ctx context.Context, metrics core.CommandMetrics) error {
+	outcome := outcomeSuccess
+	if !metrics.Success {
+		outcome = metrics.ErrorType
+	}
+	c.metrics.commands.WithLabelValues(outcome, metrics.AgentName).Inc()
+
+	return c.next.RecordCommandExecution(ctx, metrics)
+}
+
+type telegramStorage struct {
+	core.TelegramStorage
+	metrics *Metrics
+}
+
+func (t *telegramStorage) SendTextMessage(ctx context.Context, input core.TelegramTextMessageInput) (int64, error) {
+	messageID, err := t.TelegramStorage.SendTextMessage(ctx, input)
+	if err != nil {
+		t.metrics.telegramSendFailures.WithLabelValues("sendMessage").Inc()
+	}
+	return messageID, err
+}
+
+func (t *telegramStorage) EditTextMessage(ctx context.Context, input core.TelegramEditMessageInput) error {
+	err := t.TelegramStorage.EditTextMessage(ctx, input)
+	if err != nil {
+		t.metrics.telegramSendFailures.WithLabelValues("editMessageText").Inc()
+	}
+	return err
+}
+
+type rateLimiter struct {
+	core.RateLimiter
+	metrics *Metrics
+}
+
+func (r *rateLimiter) IsAllowed(ctx context.Context, userID int64) bool {
+	allowed := r.RateLimiter.IsAllowed(ctx, userID)
+	if !allowed {
+		r.metrics.rateLimitBlocks.Inc()
+	}
+	return allowed
+}
+
+type agentRegistry struct {
+	next    core.AgentRegistry
+	metrics *Metrics
+}
+
+func (r *agentRegistry) GetAgent(name string) (core.Agent, bool) {
+	agent, ok := r.next.GetAgent(name)
+	if !ok {
+		return nil, false
+	}
+	return &measuredAgent{Agent: agent, name: name, metrics: r.metrics}, true
+}
+
+func (r *agentRegistry) DefaultAgent() (string, core.Agent) {
+	name, agent := r.next.DefaultAgent()
+	if agent == nil {
+		return name, nil
+	}
+	return name, &measuredAgent{Agent: agent, name: name, metrics: r.metrics}
+}
+
+// measuredAgent measures the runs of the agent, `IsAvailable` checks aren't measured
+type measuredAgent struct {
+	core.Agent
+	name    string
+	metrics *Metrics
+}
+
+func (a *measuredAgent) ExecuteCommand(ctx context.Context, input core.AgentCommandInput) (result *core.QueryResult, err error) {
+	done := a.measure()
+	defer func() { done(result, err) }()
+	return a.Agent.ExecuteCommand(ctx, input)
+}
+
+func (a *measuredAgent) ExecuteCommandStream(ctx context.Context, input core.AgentCommandInput, onEvent func(core.AgentEvent)) (result *core.QueryResult, err error) {
+	done := a.measure()
+	defer func() { done(result, err) }()
+	return a.Agent.ExecuteCommandStream(ctx, input, onEvent)
+}
+
+// measure counts the run as in flight until the returned function is called with its outcome
+func (a *measuredAgent) measure() func(*core.QueryResult, error) {
+	startTime := time.Now()
+	a.metrics.jobsInFlight.WithLabelValues(a.name).Inc()
+
+	return func(result *core.QueryResult, err error) {
+		a.metrics.jobsInFlight.WithLabelValues(a.name).Dec()
+		a.metrics.agentDuration.WithLabelValues(a.name, agentOutcome(result, err)).Observe(time.Since(startTime).Seconds())
+	}
+}
+
+// agentOutcome is the outcome label of an agent run: success, failed or cancelled
+func agentOutcome(result *core.QueryResult, err error) string {
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return "cancelled"
+	case err != nil, result == nil, !result.Success:
+		return "failed"
+	default:
+		return outcomeSuccess
+	}
+}
@@ -0,0 +1,176 @@
+package prommetrics_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/izzddalfk/kumote/internal/assistant/core"
+	"github.com/izzddalfk/kumote/internal/assistant/infra/prommetrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeMetricsCollector struct {
+	recorded []core.CommandMetrics
+}
+
+func (f *fakeMetricsCollector) RecordCommandExecution(ctx context.Context, metrics core.CommandMetrics) error {
+	f.recorded = append(f.recorded, metrics)
+	return nil
+}
+
+type fakeTelegram struct {
+	core.TelegramStorage
+	err error
+}
+
+func (f *fakeTelegram) SendTextMessage(ctx context.Context, input core.TelegramTextMessageInput) (int64, error) {
+	return 1, f.err
+}
+
+func (f *fakeTelegram) EditTextMessage(ctx context.Context, input core.TelegramEditMessageInput) error {
+	return f.err
+}
+
+type fakeRateLimiter struct {
+	core.RateLimiter
+	allowed bool
+}
+
+func (f *fakeRateLimiter) IsAllowed(ctx context.Context, userID int64) bool {
+	return f.allowed
+}
+
+// fakeAgent checks that the run is counted as in flight while it runs
+type fakeAgent struct {
+	core.Agent
+	result  *core.QueryResult
+	err     error
+	onStart func()
+}
+
+func (f *fakeAgent) ExecuteCommand(ctx context.Context, input core.AgentCommandInput) (*core.QueryResult, error) {
+	f.onStart()
+	return f.result, f.err
+}
+
+func (f *fakeAgent) ExecuteCommandStream(ctx context.Context, input core.AgentCommandInput, onEvent func(core.AgentEvent)) (*core.QueryResult, error) {
+	f.onStart()
+	return f.result, f.err
+}
+
+type fakeAgentRegistry struct {
+	agents map[string]core.Agent
+}
+
+func (f *fakeAgentRegistry) GetAgent(name string) (core.Agent, bool) {
+	agent, ok := f.agents[name]
+	return agent, ok
+}
+
+func (f *fakeAgentRegistry) DefaultAgent() (string, core.Agent) {
+	return "claude", f.agents["claude"]
+}
+
+func scrape(t *testing.T, metrics *prommetrics.Metrics) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	return rec.Body.String()
+}
+
+func TestMetricsCollectorDecorator(t *testing.T) {
+	metrics := prommetrics.NewMetrics()
+	collector := &fakeMetricsCollector{}
+	decorated := metrics.WrapMetricsCollector(collector)
+
+	ctx := context.Background()
+	require.NoError(t, decorated.RecordCommandExecution(ctx, core.CommandMetrics{Success: true, AgentName: "claude"}))
+	require.NoError(t, decorated.RecordCommandExecution(ctx, core.CommandMetrics{Success: true, AgentName: "claude"}))
+	require.NoError(t, decorated.RecordCommandExecution(ctx, core.CommandMetrics{ErrorType: core.ErrorTypeRateLimited}))
+
+	assert.Len(t, collector.recorded, 3, "the metrics are still recorded by the collector")
+	body := scrape(t, metrics)
+	assert.Contains(t, body, `kumote_commands_total{agent="claude",outcome="success"} 2`)
+	assert.Contains(t, body, `kumote_commands_total{agent="",outcome="rate_limited"} 1`)
+}
+
+func TestTelegramDecorator(t *testing.T) {
+	metrics := prommetrics.NewMetrics()
+	telegram := &fakeTelegram{}
+	decorated := metrics.WrapTelegram(telegram)
+
+	ctx := context.Background()
+	_, err := decorated.SendTextMessage(ctx, core.TelegramTextMessageInput{})
+	require.NoError(t, err)
+	assert.NotContains(t, scrape(t, metrics), "kumote_telegram_send_failures_total{")
+
+	telegram.err = errors.New("too many requests")
+	_, err = decorated.SendTextMessage(ctx, core.TelegramTextMessageInput{})
+	assert.Error(t, err)
+	assert.Error(t, decorated.EditTextMessage(ctx, core.TelegramEditMessageInput{}))
+
+	body := scrape(t, metrics)
+	assert.Contains(t, body, `kumote_telegram_send_failures_total{method="sendMessage"} 1`)
+	assert.Contains(t, body, `kumote_telegram_send_failures_total{method="editMessageText"} 1`)
+}
+
+func TestRateLimiterDecorator(t *testing.T) {
+	metrics := prommetrics.NewMetrics()
+	limiter := &fakeRateLimiter{allowed: true}
+	decorated := metrics.WrapRateLimiter(limiter)
+	assert.Contains(t, scrape(t, metrics), "kumote_rate_limit_blocks_total 0\n")
+
+	ctx := context.Background()
+	assert.True(t, decorated.IsAllowed(ctx, 1))
+	limiter.allowed = false
+	assert.False(t, decorated.IsAllowed(ctx, 1))
+	assert.False(t, decorated.IsAllowed(ctx, 2))
+
+	assert.Contains(t, scrape(t, metrics), "kumote_rate_limit_blocks_total 2\n")
+}
+
+func TestAgentsDecorator(t *testing.T) {
+	metrics := prommetrics.NewMetrics()
+	var inFlight []string
+	onStart := func() {
+		inFlight = append(inFlight, scrape(t, metrics))
+	}
+	claude := &fakeAgent{result: &core.QueryResult{Success: true}, onStart: onStart}
+	gemini := &fakeAgent{err: context.Canceled, onStart: onStart}
+	decorated := metrics.WrapAgents(&fakeAgentRegistry{agents: map[string]core.Agent{"claude": claude, "gemini": gemini}})
+
+	ctx := context.Background()
+	name, agent := decorated.DefaultAgent()
+	require.Equal(t, "claude", name)
+	_, err := agent.ExecuteCommandStream(ctx, core.AgentCommandInput{}, func(core.AgentEvent) {})
+	require.NoError(t, err)
+
+	claude.result = &core.QueryResult{Success: false}
+	_, err = agent.ExecuteCommand(ctx, core.AgentCommandInput{})
+	require.NoError(t, err)
+
+	agent, ok := decorated.GetAgent("gemini")
+	require.True(t, ok)
+	_, err = agent.ExecuteCommand(ctx, core.AgentCommandInput{})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, ok = decorated.GetAgent("codex")
+	assert.False(t, ok)
+
+	require.Len(t, inFlight, 3)
+	assert.Contains(t, inFlight[0], `kumote_jobs_in_flight{agent="claude"} 1`)
+	assert.Contains(t, inFlight[2], `kumote_jobs_in_flight{agent="gemini"} 1`)
+
+	body := scrape(t, metrics)
+	assert.Contains(t, body, `kumote_jobs_in_flight{agent="claude"} 0`)
+	assert.Contains(t, body, `kumote_jobs_in_flight{agent="gemini"} 0`)
+	assert.Contains(t, body, `kumote_agent_execution_duration_seconds_count{agent="claude",outcome="success"} 1`)
+	assert.Contains(t, body, `kumote_agent_execution_duration_seconds_count{agent="claude",outcome="failed"} 1`)
+	assert.Contains(t, body, `kumote_agent_execution_duration_seconds_count{agent="gemini",outcome="cancelled"} 1`)
+	assert.Contains(t, body, `kumote_agent_execution_duration_seconds_bucket{agent="claude",outcome="success",le="1"} 1`)
+}
@@ -1,13 +1,17 @@
 package scanner
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log/slog"
 	"os"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
 
+	"github.com/izzddalfk/kumote/internal/assistant/core"
 	"github.com/izzddalfk/kumote/internal/shared/utils/wordsimilarity"
 	"gopkg.in/validator.v2"
 )
@@ -16,11 +20,17 @@ const defaultWordProximityThreshold = 0.7
 
 type FileSystemScanner struct {
 	projectIndexPath       string
+	projectsPath           string
+	maxDepth               int
 	wordProximityThreshold float64
+	// indexMu serializes refreshes of the project index
+	indexMu sync.Mutex
 }
 
 type FileSystemScannerConfig struct {
 	ProjectIndexPath       string `validate:"nonzero"`
+	ProjectsPath           string // Directory scanned by RefreshProjects
+	MaxDepth               int    // How deep RefreshProjects looks for projects, defaults to core.DefaultMaxDepth
 	WordProximityThreshold float64
 }
 
@@ -35,27 +45,68 @@ func NewFileSystemScanner(config FileSystemScannerConfig) (*FileSystemScanner, e
 		wpl = config.WordProximityThreshold
 	}
 
+	maxDepth := core.DefaultMaxDepth
+	if config.MaxDepth > 0 {
+		maxDepth = config.MaxDepth
+	}
+
 	return &FileSystemScanner{
 		projectIndexPath:       config.ProjectIndexPath,
+		projectsPath:           config.ProjectsPath,
+		maxDepth:               maxDepth,
 		wordProximityThreshold: wpl,
 	}, nil
 }
 
-func (s *FileSystemScanner) GetProjectDirectory(query string) (string, error) {
+// FindProjects scores every project of the index against the query and returns the projects
+// whose name or alias passes the word proximity threshold, best match first.
+// It returns core.ErrProjectNotFound when no project matches.
+func (s *FileSystemScanner) FindProjects(query string) ([]core.ProjectMatch, error) {
 	projects, err := s.loadProjectIndex()
 	if err != nil {
-		return "", fmt.Errorf("failed to load project index: %w", err)
+		return nil, fmt.Errorf("failed to load project index: %w", err)
 	}
 
-	// iterate over the projects and check if the query matches any project name
+	words := extractWords(strings.ToLower(query))
+	slog.Debug("Extracted words", slog.Any("words", words))
+
+	var matches []core.ProjectMatch
 	for _, project := range projects {
-		if s.detectWord(project.Name, query) {
-			// return the project path if a match is found
-			return project.Path, nil
+		score := 0.0
+		for _, name := range project.names() {
+			score = max(score, s.scoreWord(name, words))
+		}
+		if score >= s.wordProximityThreshold {
+			matches = append(matches, core.ProjectMatch{
+				Name:  project.Name,
+				Path:  project.Path,
+				Score: score,
+			})
 		}
 	}
+	if len(matches) == 0 {
+		return nil, core.ErrProjectNotFound
+	}
+
+	// keep the index order for equal scores so results are stable
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
 
-	return "", nil
+	return matches, nil
+}
+
+// ListProjects returns the projects of the index, in the index order
+func (s *FileSystemScanner) ListProjects(ctx context.Context) ([]core.Project, error) {
+	entries, err := s.loadProjectIndex()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load project index: %w", err)
+	}
+
+	projects := make([]core.Project, 0, len(entries))
+	for _, entry := range entries {
+		projects = append(projects, entry.project())
+	}
+
+	return projects, nil
 }
 
 func (s *FileSystemScanner) loadProjectIndex() ([]projectEntry, error) {
@@ -65,37 +116,27 @@ func (s *FileSystemScanner) loadProjectIndex() ([]projectEntry, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to read project index file: %w", err)
 	}
-	var projectIndex struct {
-		Projects []projectEntry `json:"projects"`
-	}
-	if err := json.Unmarshal(fileBytes, &projectIndex); err != nil {
+	var index projectIndex
+	if err := json.Unmarshal(fileBytes, &index); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal project index: %w", err)
 	}
-	if len(projectIndex.Projects) == 0 {
+	if len(index.Projects) == 0 {
 		return nil, fmt.Errorf("no projects found in index file: %s", s.projectIndexPath)
 	}
 
-	return projectIndex.Projects, nil
+	return index.Projects, nil
 }
 
-func (s *FileSystemScanner) detectWord(targetWord, sentence string) bool {
-	// Clean inputs
+// scoreWord returns the best similarity between the target word and any of the words
+func (s *FileSystemScanner) scoreWord(targetWord string, words []string) float64 {
 	targetWord = strings.ToLower(strings.TrimSpace(targetWord))
-	sentence = strings.ToLower(sentence)
 
-	// Extract words from sentence (including hyphenated words)
-	words := extractWords(sentence)
-
-	slog.Debug("Extracted words", slog.Any("words", words))
-
-	// Check each word for similarity
+	best := 0.0
 	for _, word := range words {
-		if wordsimilarity.CalculateSimilarity(targetWord, word) >= s.wordProximityThreshold {
-			return true
-		}
+		best = max(best, wordsimilarity.CalculateSimilarity(targetWord, word))
 	}
 
-	return false
+	return best
 }
 
 // extractWords extracts individual words and handles compound words
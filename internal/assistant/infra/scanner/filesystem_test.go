@@ -1,15 +1,17 @@
 package scanner_test
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
 
+	"github.com/izzddalfk/kumote/internal/assistant/core"
 	"github.com/izzddalfk/kumote/internal/assistant/infra/scanner"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestGetProjectDirectory(t *testing.T) {
+func TestFindProjects(t *testing.T) {
 	// setup temporary test file
 	// after test finished, the file will be removed automatically
 	testFileContent := `{
@@ -25,6 +27,13 @@ func TestGetProjectDirectory(t *testing.T) {
     {
       "name": "personal-assistant",
       "path": "/home/users/projects/kumote"
+    },
+    {
+      "name": "TaqwaBoard",
+      "path": "/home/users/projects/taqwa-board",
+      "aliases": ["taqwa", "tb"],
+      "description": "Prayer times dashboard for the mosque",
+      "tags": ["vue", "side-project"]
     }
   ]
 }
@@ -63,12 +72,19 @@ func TestGetProjectDirectory(t *testing.T) {
 			expectedPath: "/home/users/projects/mycar-logbook",
 			expectError:  false,
 		},
+		{
+			name:         "Alias match",
+			query:        "show taqwa main.go",
+			inputPath:    tempIndexFile,
+			expectedPath: "/home/users/projects/taqwa-board",
+			expectError:  false,
+		},
 		{
 			name:         "No match",
 			query:        "What is the weather like today?",
 			inputPath:    tempIndexFile,
 			expectedPath: "",
-			expectError:  false,
+			expectError:  true,
 		},
 		{
 			name:         "Invalid project index path",
@@ -86,13 +102,72 @@ func TestGetProjectDirectory(t *testing.T) {
 			})
 			assert.NoError(t, err, "failed to create FileSystemScanner")
 
-			path, err := scanner.GetProjectDirectory(tc.query)
+			matches, err := scanner.FindProjects(tc.query)
 			if tc.expectError {
 				assert.Error(t, err, "Expected an error but got none")
-			} else {
-				assert.NoError(t, err, "Did not expect an error")
+				return
+			}
+			assert.NoError(t, err, "Did not expect an error")
+			if assert.NotEmpty(t, matches) {
+				assert.Equal(t, tc.expectedPath, matches[0].Path, "Expected project directory path does not match")
+			}
+
+			// matches are ranked from the best one
+			for i := 1; i < len(matches); i++ {
+				assert.GreaterOrEqual(t, matches[i-1].Score, matches[i].Score)
 			}
-			assert.Equal(t, tc.expectedPath, path, "Expected project directory path does not match")
 		})
 	}
 }
+
+func TestFindProjectsNoMatch(t *testing.T) {
+	indexPath := filepath.Join(t.TempDir(), "projects-index.json")
+	err := os.WriteFile(indexPath, []byte(`{"projects": [{"name": "carlogbook", "path": "/projects/carlogbook"}]}`), 0644)
+	assert.NoError(t, err)
+
+	s, err := scanner.NewFileSystemScanner(scanner.FileSystemScannerConfig{ProjectIndexPath: indexPath})
+	assert.NoError(t, err)
+
+	_, err = s.FindProjects("What is the weather like today?")
+	assert.ErrorIs(t, err, core.ErrProjectNotFound)
+}
+
+func TestFindProjectsRanksAllCandidates(t *testing.T) {
+	indexPath := filepath.Join(t.TempDir(), "projects-index.json")
+	err := os.WriteFile(indexPath, []byte(`{"projects": [
+		{"name": "mycar-logbook", "path": "/projects/mycar-logbook"},
+		{"name": "carlogbook", "path": "/projects/carlogbook"},
+		{"name": "personal-website", "path": "/projects/personal-website"}
+	]}`), 0644)
+	assert.NoError(t, err)
+
+	s, err := scanner.NewFileSystemScanner(scanner.FileSystemScannerConfig{ProjectIndexPath: indexPath})
+	assert.NoError(t, err)
+
+	// the first project of the index passes the threshold too, but the exact match ranks first
+	matches, err := s.FindProjects("fix the receipts of carlogbook")
+	assert.NoError(t, err)
+	if assert.Len(t, matches, 2) {
+		assert.Equal(t, core.ProjectMatch{Name: "carlogbook", Path: "/projects/carlogbook", Score: 1}, matches[0])
+		assert.Equal(t, "mycar-logbook", matches[1].Name)
+	}
+}
+
+func TestListProjects(t *testing.T) {
+	indexPath := filepath.Join(t.TempDir(), "projects-index.json")
+	err := os.WriteFile(indexPath, []byte(`{"projects": [
+		{"name": "carlogbook", "path": "/projects/carlogbook", "aliases": ["car"], "tech_stack": ["go"]},
+		{"name": "personal-website", "path": "/projects/personal-website"}
+	]}`), 0644)
+	assert.NoError(t, err)
+
+	s, err := scanner.NewFileSystemScanner(scanner.FileSystemScannerConfig{ProjectIndexPath: indexPath})
+	assert.NoError(t, err)
+
+	projects, err := s.ListProjects(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []core.Project{
+		{Name: "carlogbook", Path: "/projects/carlogbook", Aliases: []string{"car"}, TechStack: []string{"go"}},
+		{Name: "personal-website", Path: "/projects/personal-website"},
+	}, projects)
+}
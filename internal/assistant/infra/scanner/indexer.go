@@ -0,0 +1,190 @@
+package scanner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/izzddalfk/kumote/internal/assistant/core"
+)
+
+// RefreshProjects walks the projects directory up to the max depth, detects projects
+// by their indicator files and rewrites the project index. Names, aliases, descriptions
+// and tags of projects already in the index are kept, so manual edits survive a refresh.
+// Projects of the index the scan didn't find, e.g. added by hand outside the projects
+// directory, are kept as long as their directory exists.
+func (s *FileSystemScanner) RefreshProjects(ctx context.Context) ([]core.Project, error) {
+	if s.projectsPath == "" {
+		return nil, fmt.Errorf("projects path is not configured")
+	}
+
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	// a missing or empty index is fine, it's about to be created
+	// a missing or empty index is fine, it's about to be created
+	existing, _ := s.loadProjectIndex()
+
+	entries, err := s.scanProjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	scanned := make(map[string]int, len(entries))
+	for i, entry := range entries {
+		scanned[entry.Path] = i
+	}
+	for _, entry := range existing {
+		if i, ok := scanned[entry.Path]; ok {
+			entries[i].Name = entry.Name
+			entries[i].Aliases = entry.Aliases
+			entries[i].Description = entry.Description
+			entries[i].Tags = entry.Tags
+			continue
+		}
+		if info, err := os.Stat(entry.Path); err != nil || !info.IsDir() {
+			slog.InfoContext(ctx, "Removing missing project from the index",
+				slog.String("name", entry.Name),
+				slog.String("path", entry.Path))
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+
+	if err := s.writeProjectIndex(entries); err != nil {
+		return nil, err
+	}
+
+	slog.InfoContext(ctx, "Project index refreshed",
+		slog.String("projects_path", s.projectsPath),
+		slog.Int("projects", len(entries)))
+
+	projects := make([]core.Project, 0, len(entries))
+	for _, entry := range entries {
+		projects = append(projects, entry.project())
+	}
+
+	return projects, nil
+}
+
+// scanProjects finds the projects under the projects path, sorted by path.
+// Directories inside a project are not scanned any further.
+func (s *FileSystemScanner) scanProjects(ctx context.Context) ([]projectEntry, error) {
+	root, err := filepath.Abs(s.projectsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve projects path: %w", err)
+	}
+
+	var entries []projectEntry
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// unreadable directories are skipped instead of failing the whole scan
+			if path != root && errors.Is(err, fs.ErrPermission) {
+				slog.WarnContext(ctx, "Skipping unreadable directory", slog.String("path", path))
+				return fs.SkipDir
+			}
+			return err
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if !d.IsDir() || path == root {
+			return nil
+		}
+		if isExcludedDir(d.Name()) {
+			return fs.SkipDir
+		}
+
+		if isProjectDir(path) {
+			entries = append(entries, projectEntry{
+				Name:      d.Name(),
+				Path:      path,
+				TechStack: detectTechStack(path),
+			})
+			return fs.SkipDir
+		}
+
+		if depth(root, path) >= s.maxDepth {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan projects path: %w", err)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+
+	return entries, nil
+}
+
+// writeProjectIndex replaces the project index file, writing to a temporary
+// file first so readers never see a partially written index
+func (s *FileSystemScanner) writeProjectIndex(entries []projectEntry) error {
+	if entries == nil {
+		entries = []projectEntry{}
+	}
+	content, err := json.MarshalIndent(projectIndex{Projects: entries}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal project index: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.projectIndexPath), 0755); err != nil {
+		return fmt.Errorf("failed to create project index directory: %w", err)
+	}
+	tmpPath := s.projectIndexPath + ".tmp"
+	if err := os.WriteFile(tmpPath, append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write project index: %w", err)
+	}
+	if err := os.Rename(tmpPath, s.projectIndexPath); err != nil {
+		return fmt.Errorf("failed to replace project index: %w", err)
+	}
+
+	return nil
+}
+
+// isProjectDir checks whether the directory contains any of the project indicators
+func isProjectDir(dir string) bool {
+	for _, indicator := range core.ProjectIndicators {
+		if _, err := os.Stat(filepath.Join(dir, indicator)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// detectTechStack returns the sorted technologies whose patterns match files in the project root
+func detectTechStack(dir string) []string {
+	var stack []string
+	for tech, patterns := range core.TechStackPatterns {
+		for _, pattern := range patterns {
+			if matches, _ := filepath.Glob(filepath.Join(dir, pattern)); len(matches) > 0 {
+				stack = append(stack, tech)
+				break
+			}
+		}
+	}
+	sort.Strings(stack)
+	return stack
+}
+
+func isExcludedDir(name string) bool {
+	return slices.Contains(core.ExcludedDirs, name) || strings.HasPrefix(name, ".")
+}
+
+// depth returns how many directories deep path is below root
+func depth(root, path string) int {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return 0
+	}
+	return len(strings.Split(rel, string(filepath.Separator)))
+}
@@ -0,0 +1,110 @@
+package scanner_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/izzddalfk/kumote/internal/assistant/core"
+	"github.com/izzddalfk/kumote/internal/assistant/infra/scanner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeFiles creates the files, with their parent directories, under root
+func writeFiles(t *testing.T, root string, files ...string) {
+	t.Helper()
+	for _, file := range files {
+		path := filepath.Join(root, file)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte("test"), 0644))
+	}
+}
+
+func TestRefreshProjects(t *testing.T) {
+	projectsPath := t.TempDir()
+	writeFiles(t, projectsPath,
+		"mycar-logbook/go.mod",
+		"mycar-logbook/main.go",
+		"mycar-logbook/Dockerfile",
+		"mycar-logbook/web/package.json", // inside a project, not a separate one
+		"clients/acme/personal-website/package.json",
+		"clients/acme/personal-website/src/App.vue",
+		"notes/todo.txt", // no project indicator
+		"node_modules/left-pad/package.json",
+		"a/b/c/too-deep/go.mod",
+	)
+
+	// a project added by hand outside the projects directory
+	otherPath := filepath.Join(t.TempDir(), "dotfiles")
+	require.NoError(t, os.MkdirAll(otherPath, 0755))
+
+	indexPath := filepath.Join(t.TempDir(), "data", "projects-index.json")
+	existingIndex := `{"projects": [
+		{"name": "carlogbook", "path": "` + filepath.Join(projectsPath, "mycar-logbook") + `", "aliases": ["car"], "tags": ["go"]},
+		{"name": "dotfiles", "path": "` + otherPath + `", "aliases": ["dots"], "description": "My shell setup", "tags": ["shell"]},
+		{"name": "removed-project", "path": "/somewhere/else"}
+	]}`
+	require.NoError(t, os.MkdirAll(filepath.Dir(indexPath), 0755))
+	require.NoError(t, os.WriteFile(indexPath, []byte(existingIndex), 0644))
+
+	s, err := scanner.NewFileSystemScanner(scanner.FileSystemScannerConfig{
+		ProjectIndexPath: indexPath,
+		ProjectsPath:     projectsPath,
+	})
+	require.NoError(t, err)
+
+	projects, err := s.RefreshProjects(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, []core.Project{
+		{
+			Name:      "personal-website",
+			Path:      filepath.Join(projectsPath, "clients/acme/personal-website"),
+			TechStack: []string{"nodejs", "vue"},
+		},
+		{
+			Name:      "carlogbook", // the name, aliases and tags from the existing index are kept
+			Path:      filepath.Join(projectsPath, "mycar-logbook"),
+			Aliases:   []string{"car"},
+			Tags:      []string{"go"},
+			TechStack: []string{"docker", "go"},
+		},
+		{
+			Name:        "dotfiles", // projects the scan didn't find are kept while they exist
+			Path:        otherPath,
+			Aliases:     []string{"dots"},
+			Description: "My shell setup",
+			Tags:        []string{"shell"},
+		},
+	}, projects)
+
+	// the index is rewritten and used to resolve projects
+	content, err := os.ReadFile(indexPath)
+	require.NoError(t, err)
+	var index struct {
+		Projects []core.Project `json:"projects"`
+	}
+	require.NoError(t, json.Unmarshal(content, &index))
+	assert.Equal(t, projects, index.Projects)
+
+	matches, err := s.FindProjects("what changed in personal-website")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(projectsPath, "clients/acme/personal-website"), matches[0].Path)
+
+	matches, err = s.FindProjects("run the car tests")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(projectsPath, "mycar-logbook"), matches[0].Path)
+}
+
+func TestRefreshProjectsWithoutProjectsPath(t *testing.T) {
+	s, err := scanner.NewFileSystemScanner(scanner.FileSystemScannerConfig{
+		ProjectIndexPath: filepath.Join(t.TempDir(), "projects-index.json"),
+	})
+	require.NoError(t, err)
+
+	_, err = s.RefreshProjects(context.Background())
+	assert.Error(t, err)
+}
@@ -1,6 +1,33 @@
 package scanner
 
+import "github.com/izzddalfk/kumote/internal/assistant/core"
+
+type projectIndex struct {
+	Projects []projectEntry `json:"projects"`
+}
+
 type projectEntry struct {
-	Name string `json:"name"`
-	Path string `json:"path"`
+	Name        string   `json:"name"`
+	Path        string   `json:"path"`
+	Aliases     []string `json:"aliases,omitempty"` // Other names the project is referred to by, e.g. "car" for "mycar-logbook"
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	TechStack   []string `json:"tech_stack,omitempty"`
+}
+
+// names returns the project name followed by its aliases
+func (e projectEntry) names() []string {
+	return append([]string{e.Name}, e.Aliases...)
+}
+
+// project converts the entry to the core model
+func (e projectEntry) project() core.Project {
+	return core.Project{
+		Name:        e.Name,
+		Path:        e.Path,
+		Aliases:     e.Aliases,
+		Description: e.Description,
+		Tags:        e.Tags,
+		TechStack:   e.TechStack,
+	}
 }
@@ -0,0 +1,196 @@
+package sessionstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/izzddalfk/kumote/internal/assistant/core"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type SessionStore struct {
+	db *sql.DB
+}
+
+// NewSessionStore creates a new session store with SQLite
+func NewSessionStore(dbPath string) (*SessionStore, error) {
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sessions database: %w", err)
+	}
+
+	store := &SessionStore{
+		db: db,
+	}
+
+	if err := store.initSchema(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize sessions schema: %w", err)
+	}
+
+	return store, nil
+}
+
+// Close closes the database connection
+func (ss *SessionStore) Close() error {
+	return ss.db.Close()
+}
+
+// GetSession returns the last session of the chat for the project
+func (ss *SessionStore) GetSession(ctx context.Context, chatID int64, project string) (*core.Session, error) {
+	query := `
+		SELECT chat_id, project, agent_name, session_id, updated_at
+		FROM sessions
+		WHERE chat_id = ? AND project = ?
+	`
+
+	var session core.Session
+	err := ss.db.QueryRowContext(ctx, query, chatID, project).Scan(
+		&session.ChatID,
+		&session.Project,
+		&session.AgentName,
+		&session.SessionID,
+		&session.UpdatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	return &session, nil
+}
+
+// SaveSession creates or replaces the session of the chat for the project
+func (ss *SessionStore) SaveSession(ctx context.Context, session core.Session) error {
+	slog.DebugContext(ctx, "Saving session",
+		"chat_id", session.ChatID,
+		"project", session.Project,
+		"agent", session.AgentName,
+		"session_id", session.SessionID,
+	)
+
+	query := `
+		INSERT INTO sessions (chat_id, project, agent_name, session_id, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (chat_id, project) DO UPDATE SET
+			agent_name = excluded.agent_name,
+			session_id = excluded.session_id,
+			updated_at = excluded.updated_at
+	`
+
+	_, err := ss.db.ExecContext(ctx, query,
+		session.ChatID,
+		session.Project,
+		session.AgentName,
+		session.SessionID,
+		session.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteSession removes the session of the chat for the project
+func (ss *SessionStore) DeleteSession(ctx context.Context, chatID int64, project string) error {
+	_, err := ss.db.ExecContext(ctx, `DELETE FROM sessions WHERE chat_id = ? AND project = ?`, chatID, project)
+	if err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteSessions removes every session of the chat
+func (ss *SessionStore) DeleteSessions(ctx context.Context, chatID int64) error {
+	_, err := ss.db.ExecContext(ctx, `DELETE FROM sessions WHERE chat_id = ?`, chatID)
+	if err != nil {
+		return fmt.Errorf("failed to delete sessions: %w", err)
+	}
+
+	return nil
+}
+
+// GetChatProject returns the current project of the chat
+func (ss *SessionStore) GetChatProject(ctx context.Context, chatID int64) (*core.ChatProject, error) {
+	query := `
+		SELECT chat_id, name, path, updated_at
+		FROM chat_projects
+		WHERE chat_id = ?
+	`
+
+	var project core.ChatProject
+	err := ss.db.QueryRowContext(ctx, query, chatID).Scan(
+		&project.ChatID,
+		&project.Name,
+		&project.Path,
+		&project.UpdatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat project: %w", err)
+	}
+
+	return &project, nil
+}
+
+// SaveChatProject creates or replaces the current project of the chat
+func (ss *SessionStore) SaveChatProject(ctx context.Context, project core.ChatProject) error {
+	slog.DebugContext(ctx, "Saving chat project",
+		"chat_id", project.ChatID,
+		"project", project.Name,
+	)
+
+	query := `
+		INSERT INTO chat_projects (chat_id, name, path, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (chat_id) DO UPDATE SET
+			name = excluded.name,
+			path = excluded.path,
+			updated_at = excluded.updated_at
+	`
+
+	_, err := ss.db.ExecContext(ctx, query,
+		project.ChatID,
+		project.Name,
+		project.Path,
+		project.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save chat project: %w", err)
+	}
+
+	return nil
+}
+
+// initSchema initializes the database schema
+func (ss *SessionStore) initSchema() error {
+	schema := `
+	CREATE TABLE IF NOT EXISTS sessions (
+		chat_id INTEGER NOT NULL,
+		project TEXT NOT NULL,
+		agent_name TEXT NOT NULL,
+		session_id TEXT NOT NULL,
+		updated_at DATETIME NOT NULL,
+		PRIMARY KEY (chat_id, project)
+	);
+
+	CREATE TABLE IF NOT EXISTS chat_projects (
+		chat_id INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		path TEXT NOT NULL,
+		updated_at DATETIME NOT NULL
+	);
+	`
+
+	_, err := ss.db.Exec(schema)
+	return err
+}
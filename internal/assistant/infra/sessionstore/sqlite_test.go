@@ -0,0 +1,87 @@
+package sessionstore_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/izzddalfk/kumote/internal/assistant/core"
+	"github.com/izzddalfk/kumote/internal/assistant/infra/sessionstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := sessionstore.NewSessionStore(filepath.Join(t.TempDir(), "sessions.db"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	session, err := store.GetSession(ctx, 42, "/projects/kumote")
+	require.NoError(t, err)
+	assert.Nil(t, session, "unknown chat should have no session")
+
+	updatedAt := time.Now().UTC().Truncate(time.Second)
+	require.NoError(t, store.SaveSession(ctx, core.Session{
+		ChatID: 42, Project: "/projects/kumote", AgentName: "claude", SessionID: "first", UpdatedAt: updatedAt,
+	}))
+	require.NoError(t, store.SaveSession(ctx, core.Session{
+		ChatID: 42, Project: "/projects/kumote", AgentName: "claude", SessionID: "second", UpdatedAt: updatedAt,
+	}))
+	require.NoError(t, store.SaveSession(ctx, core.Session{
+		ChatID: 42, Project: "/projects/carlogbook", AgentName: "claude", SessionID: "other", UpdatedAt: updatedAt,
+	}))
+
+	session, err = store.GetSession(ctx, 42, "/projects/kumote")
+	require.NoError(t, err)
+	require.NotNil(t, session)
+	assert.Equal(t, "second", session.SessionID, "saving again should replace the session")
+	assert.Equal(t, "claude", session.AgentName)
+	assert.True(t, updatedAt.Equal(session.UpdatedAt))
+
+	require.NoError(t, store.DeleteSession(ctx, 42, "/projects/kumote"))
+	session, err = store.GetSession(ctx, 42, "/projects/kumote")
+	require.NoError(t, err)
+	assert.Nil(t, session, "the session of the project should be removed")
+	session, err = store.GetSession(ctx, 42, "/projects/carlogbook")
+	require.NoError(t, err)
+	assert.NotNil(t, session, "the sessions of other projects should be kept")
+
+	require.NoError(t, store.DeleteSessions(ctx, 42))
+	session, err = store.GetSession(ctx, 42, "/projects/carlogbook")
+	require.NoError(t, err)
+	assert.Nil(t, session, "sessions should be removed after delete")
+}
+
+func TestSessionStoreChatProject(t *testing.T) {
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "sessions.db")
+	store, err := sessionstore.NewSessionStore(dbPath)
+	require.NoError(t, err)
+
+	project, err := store.GetChatProject(ctx, 42)
+	require.NoError(t, err)
+	assert.Nil(t, project, "unknown chat should have no project")
+
+	updatedAt := time.Now().UTC().Truncate(time.Second)
+	require.NoError(t, store.SaveChatProject(ctx, core.ChatProject{
+		ChatID: 42, Name: "kumote", Path: "/projects/kumote", UpdatedAt: updatedAt,
+	}))
+	require.NoError(t, store.SaveChatProject(ctx, core.ChatProject{
+		ChatID: 42, Name: "carlogbook", Path: "/projects/carlogbook", UpdatedAt: updatedAt,
+	}))
+	require.NoError(t, store.Close())
+
+	// the current project survives a restart
+	store, err = sessionstore.NewSessionStore(dbPath)
+	require.NoError(t, err)
+	defer store.Close()
+
+	project, err = store.GetChatProject(ctx, 42)
+	require.NoError(t, err)
+	require.NotNil(t, project)
+	assert.Equal(t, "carlogbook", project.Name, "saving again should replace the project")
+	assert.Equal(t, "/projects/carlogbook", project.Path)
+	assert.True(t, updatedAt.Equal(project.UpdatedAt))
+}
@@ -0,0 +1,336 @@
+package telegram
+
+import (
+	"strings"
+	"unicode"
+)
+
+// splitMessage splits markdown text into chunks whose formatted length, as returned
+// by measure, fits in limit. It splits on paragraph boundaries first, then on lines,
+// and only cuts inside a line when the line alone doesn't fit. Fenced code blocks
+// split across chunks are closed at the end of a chunk and reopened, with the same
+// language, at the start of the next one so every chunk stays balanced.
+func splitMessage(text string, limit int, measure func(string) int) []string {
+	if measure(text) <= limit {
+		return []string{text}
+	}
+
+	var (
+		chunks  []string
+		current string
+	)
+	flush := func() {
+		if strings.TrimSpace(current) != "" {
+			chunks = append(chunks, current)
+		}
+		current = ""
+	}
+
+	for _, block := range splitBlocks(text) {
+		candidate := block
+		if current != "" {
+			candidate = current + "\n\n" + block
+		}
+		if measure(candidate) <= limit {
+			current = candidate
+			continue
+		}
+
+		flush()
+		if measure(block) <= limit {
+			current = block
+			continue
+		}
+
+		// the block alone is too long, split it further
+		pieces := splitBlock(block, limit, measure)
+		if len(pieces) == 0 {
+			continue
+		}
+		chunks = append(chunks, pieces[:len(pieces)-1]...)
+		current = pieces[len(pieces)-1]
+	}
+	flush()
+
+	return chunks
+}
+
+// splitBlocks splits text into paragraphs and fenced code blocks.
+// Code blocks are kept whole even when they contain blank lines.
+func splitBlocks(text string) []string {
+	var (
+		blocks  []string
+		current []string
+		inFence bool
+	)
+	flush := func() {
+		if len(current) > 0 {
+			blocks = append(blocks, strings.Join(current, "\n"))
+			current = nil
+		}
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		isFence := isFenceLine(line)
+		switch {
+		case isFence && !inFence:
+			flush()
+			inFence = true
+			current = append(current, line)
+		case isFence && inFence:
+			current = append(current, line)
+			inFence = false
+			flush()
+		case inFence:
+			current = append(current, line)
+		case strings.TrimSpace(line) == "":
+			flush()
+		default:
+			current = append(current, line)
+		}
+	}
+	flush()
+
+	return blocks
+}
+
+// splitBlock splits a single paragraph or code block by lines
+func splitBlock(block string, limit int, measure func(string) int) []string {
+	lines := strings.Split(block, "\n")
+
+	// Code blocks are split inside the fences and every piece gets its own fences.
+	// A block whose fences alone don't fit is split as plain text.
+	opener, closer := "", ""
+	if len(lines) >= 2 && isFenceLine(lines[0]) && measure(strings.TrimSpace(lines[0])+"\n\n```") < limit {
+		opener = strings.TrimSpace(lines[0])
+		closer = "```"
+		lines = lines[1:]
+		if isFenceLine(lines[len(lines)-1]) {
+			lines = lines[:len(lines)-1]
+		}
+	}
+	wrap := func(content string) string {
+		if opener == "" {
+			return content
+		}
+		return opener + "\n" + content + "\n" + closer
+	}
+
+	var (
+		pieces  []string
+		current string
+		started bool
+	)
+	for _, line := range lines {
+		candidate := line
+		if started {
+			candidate = current + "\n" + line
+		}
+		if measure(wrap(candidate)) <= limit {
+			current = candidate
+			started = true
+			continue
+		}
+
+		if started {
+			pieces = append(pieces, wrap(current))
+		}
+
+		if measure(wrap(line)) <= limit {
+			current = line
+			started = true
+			continue
+		}
+
+		// the line alone is too long, cut it
+		parts := splitLine(line, limit, opener == "", func(s string) int { return measure(wrap(s)) })
+		for _, part := range parts[:len(parts)-1] {
+			pieces = append(pieces, wrap(part))
+		}
+		current = parts[len(parts)-1]
+		started = true
+	}
+	if started {
+		pieces = append(pieces, wrap(current))
+	}
+
+	return pieces
+}
+
+// splitLine cuts a line into parts that fit in limit, preferring to cut at spaces.
+// Outside code blocks, with inline set, cuts are moved before the inline entity they
+// would land in, and entities that can't be avoided are closed at the end of a part
+// and reopened at the start of the next one.
+func splitLine(line string, limit int, inline bool, measure func(string) int) []string {
+	var parts []string
+	runes := []rune(line)
+
+	for len(runes) > 0 {
+		// find the longest prefix that fits using binary search
+		low, high := 1, len(runes)
+		for low < high {
+			mid := (low + high + 1) / 2
+			if measure(string(runes[:mid])) <= limit {
+				low = mid
+			} else {
+				high = mid - 1
+			}
+		}
+		cut := low
+
+		// prefer cutting after a space when it doesn't make the part too short
+		if cut < len(runes) {
+			if space := strings.LastIndex(string(runes[:cut]), " "); space > 0 {
+				if spaceRunes := len([]rune(string(runes[:cut])[:space])); spaceRunes > cut/2 {
+					cut = spaceRunes + 1
+				}
+			}
+		}
+
+		if cut >= len(runes) || !inline {
+			parts = append(parts, string(runes[:cut]))
+			runes = runes[cut:]
+			continue
+		}
+
+		part, rest := cutInline(runes, cut, limit, measure)
+		parts = append(parts, part)
+		runes = rest
+	}
+
+	return parts
+}
+
+// inlineSpan is an inline entity of a line, from start to end in runes. The delimiter
+// closes and reopens the entity when a cut can't avoid it, links have none and are kept whole.
+type inlineSpan struct {
+	start, end int
+	delimiter  string
+}
+
+// cutInline cuts runes at cut, moving the cut back before the inline entity it lands in.
+// Entities starting the line, which can't be avoided, are closed and reopened instead.
+func cutInline(runes []rune, cut, limit int, measure func(string) int) (string, []rune) {
+	spans := inlineSpans(runes)
+
+	for ; cut > 1; cut-- {
+		var closers, openers string
+		avoidable := false
+		for _, span := range spans {
+			if span.start >= cut || cut >= span.end {
+				continue
+			}
+			if span.start > 0 {
+				avoidable = true
+				break
+			}
+			closers = span.delimiter + closers
+			openers += span.delimiter
+		}
+		switch {
+		case avoidable:
+			continue
+		case closers == "":
+			return string(runes[:cut]), runes[cut:]
+		}
+
+		// delimiters must touch the text they wrap
+		part := strings.TrimRight(string(runes[:cut]), " ") + closers
+		if measure(part) > limit {
+			continue
+		}
+		return part, []rune(openers + strings.TrimLeft(string(runes[cut:]), " "))
+	}
+
+	return string(runes[:1]), runes[1:]
+}
+
+// inlineSpans finds the code spans, links and bold, italic and strikethrough spans of a line
+func inlineSpans(runes []rune) []inlineSpan {
+	var spans []inlineSpan
+
+	for i := 0; i < len(runes); i++ {
+		ch := runes[i]
+		run := 1
+		for i+run < len(runes) && runes[i+run] == ch {
+			run++
+		}
+
+		switch ch {
+		case '`':
+			// code spans hide everything inside them
+			delimiter := strings.Repeat("`", run)
+			if end := indexDelimiter(runes, i+run, delimiter); end >= 0 {
+				spans = append(spans, inlineSpan{start: i, end: end + run, delimiter: delimiter})
+				i = end + run - 1
+				continue
+			}
+		case '[':
+			if end := linkEnd(runes, i); end >= 0 {
+				spans = append(spans, inlineSpan{start: i, end: end})
+				i = end - 1
+				continue
+			}
+		case '*', '_', '~':
+			delimiter := string(ch)
+			if run >= 2 {
+				delimiter = strings.Repeat(string(ch), 2)
+			}
+			wordBefore := i > 0 && isWordRune(runes[i-1])
+			spaceAfter := i+run >= len(runes) || runes[i+run] == ' '
+			if (ch == '~' && run < 2) || (ch == '_' && wordBefore) || spaceAfter {
+				break
+			}
+			opened := i + len([]rune(delimiter))
+			if end := indexDelimiter(runes, opened, delimiter); end >= 0 && runes[end-1] != ' ' {
+				spans = append(spans, inlineSpan{start: i, end: end + len([]rune(delimiter)), delimiter: delimiter})
+				// nested entities are found by scanning on from the opening delimiter
+				i = opened - 1
+				continue
+			}
+		}
+		i += run - 1
+	}
+
+	return spans
+}
+
+// indexDelimiter returns the index of the run of runes exactly matching delimiter
+// at or after from, or -1
+func indexDelimiter(runes []rune, from int, delimiter string) int {
+	want := []rune(delimiter)
+	for i := from; i+len(want) <= len(runes); i++ {
+		if string(runes[i:i+len(want)]) != delimiter {
+			continue
+		}
+		before := i > from && runes[i-1] == want[0]
+		after := i+len(want) < len(runes) && runes[i+len(want)] == want[0]
+		if !before && !after {
+			return i
+		}
+	}
+	return -1
+}
+
+// linkEnd returns the index right after the [label](url) link starting at start, or -1
+func linkEnd(runes []rune, start int) int {
+	label := indexDelimiter(runes, start+1, "]")
+	if label < 0 || label+1 >= len(runes) || runes[label+1] != '(' {
+		return -1
+	}
+	url := indexDelimiter(runes, label+2, ")")
+	if url < 0 {
+		return -1
+	}
+	return url + 1
+}
+
+// isWordRune reports whether r is a letter or a digit
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// isFenceLine checks whether the line opens or closes a fenced code block
+func isFenceLine(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), "```")
+}
@@ -7,22 +7,45 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"mime/multipart"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf16"
 
 	"github.com/izzddalfk/kumote/internal/assistant/core"
+	"github.com/izzddalfk/kumote/internal/shared/utils/telegramformat"
 	"gopkg.in/validator.v2"
 )
 
+const (
+	// maxChunkLength leaves room for the part number in front of every chunk
+	maxChunkLength = core.TelegramMaxMessageLength - 16
+	// maxMessageChunks is how many messages a response can be split into
+	// before it's sent as a document instead
+	maxMessageChunks = 5
+	// responseDocumentName is the file name of responses sent as a document
+	responseDocumentName = "response.md"
+	// maxDownloadSize is the largest file bots are allowed to download
+	maxDownloadSize = 20 * 1024 * 1024
+)
+
 type Client struct {
-	baseURL  string
-	botToken string
+	baseURL   string
+	botToken  string
+	parseMode string
+	// format converts the agent's markdown to the parse mode
+	format func(string) string
+	// escape makes plain text safe to send in the parse mode
+	escape func(string) string
 }
 
 type ClientConfig struct {
 	BaseURL  string `validate:"nonzero"`
 	BotToken string `validate:"nonzero"`
+	// ParseMode is either core.ParseModeMarkdownV2 (the default) or core.ParseModeHTML
+	ParseMode string
 }
 
 func NewClient(cfg ClientConfig) (*Client, error) {
@@ -30,10 +53,26 @@ func NewClient(cfg ClientConfig) (*Client, error) {
 		return nil, fmt.Errorf("invalid client configuration: %w", err)
 	}
 
-	return &Client{
+	client := &Client{
 		baseURL:  cfg.BaseURL,
 		botToken: cfg.BotToken,
-	}, nil
+	}
+
+	switch cfg.ParseMode {
+	case "", core.ParseModeMarkdownV2:
+		client.parseMode = core.ParseModeMarkdownV2
+		client.format = telegramformat.ToMarkdownV2
+		client.escape = telegramformat.EscapeMarkdownV2
+	case core.ParseModeHTML:
+		client.parseMode = core.ParseModeHTML
+		client.format = telegramformat.ToHTML
+		client.escape = telegramformat.EscapeHTML
+	default:
+		return nil, fmt.Errorf("unsupported parse mode %q, must be %q or %q",
+			cfg.ParseMode, core.ParseModeMarkdownV2, core.ParseModeHTML)
+	}
+
+	return client, nil
 }
 
 func (c *Client) botUrl() string {
@@ -44,83 +83,351 @@ func (c *Client) botUrl() string {
 	return c.baseURL + "bot" + c.botToken
 }
 
-func (c *Client) SendTextMessage(ctx context.Context, input core.TelegramTextMessageInput) error {
-	// Telegram Bot API URL
-	apiURL := fmt.Sprintf("%s/sendMessage", c.botUrl())
+// fileUrl returns the download URL of a file, files are served next to the bot API
+// e.g. <base>/file/bot<token>/voice/file_1.oga
+func (c *Client) fileUrl(filePath string) string {
+	return strings.TrimSuffix(c.baseURL, "/") + "/file/bot" + c.botToken + "/" + filePath
+}
 
-	// Escape special characters for MarkdownV2 format
-	// Characters that need escaping in MarkdownV2: '_', '*', '[', ']', '(', ')', '~', '`', '>', '#', '+', '-', '=', '|', '{', '}', '.', '!'
-	escapedMessage := escapeMarkdownV2(input.Message)
+// SendTextMessage sends the message, split into numbered parts when it's longer than
+// a single Telegram message allows. Very long messages are sent as a markdown document
+// instead. It returns the ID of the last sent message.
+func (c *Client) SendTextMessage(ctx context.Context, input core.TelegramTextMessageInput) (int64, error) {
+	replyMarkup := newInlineKeyboardMarkup(input.Buttons)
 
-	// Prepare the request payload
-	type sendMessageRequest struct {
-		ChatID    int64  `json:"chat_id"`
-		Text      string `json:"text"`
-		ParseMode string `json:"parse_mode,omitempty"`
+	chunks := splitMessage(input.Message, maxChunkLength, c.formattedLength)
+	if len(chunks) > maxMessageChunks {
+		return c.sendDocument(ctx, sendDocumentInput{
+			ChatID:      input.ChatID,
+			FileName:    responseDocumentName,
+			Content:     []byte(input.Message),
+			Caption:     "📄 The response is too long for a message, here it is as a file.",
+			ReplyMarkup: replyMarkup,
+		})
 	}
 
+	var messageID int64
+	for i, chunk := range chunks {
+		if len(chunks) > 1 {
+			chunk = fmt.Sprintf("(%d/%d)\n%s", i+1, len(chunks), chunk)
+		}
+
+		// buttons go below the last part
+		var markup *inlineKeyboardMarkup
+		if i == len(chunks)-1 {
+			markup = replyMarkup
+		}
+
+		var err error
+		messageID, err = c.sendMessage(ctx, input.ChatID, chunk, markup)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return messageID, nil
+}
+
+// sendMessage sends a single message that fits in Telegram's message length limit.
+// The markdown is converted to the client's parse mode, and when Telegram still
+// rejects the formatting the message is sent again as plain text.
+func (c *Client) sendMessage(ctx context.Context, chatID int64, text string, replyMarkup *inlineKeyboardMarkup) (int64, error) {
 	payload := sendMessageRequest{
+		ChatID:      chatID,
+		Text:        c.format(text),
+		ParseMode:   c.parseMode,
+		ReplyMarkup: replyMarkup,
+	}
+
+	var sentMessage message
+	err := c.callAPI(ctx, "sendMessage", payload, &sentMessage)
+	if err != nil && isEntityParseError(err) {
+		slog.WarnContext(ctx, "Telegram rejected the message formatting, sending it as plain text",
+			slog.Int64("chat_id", chatID),
+			slog.String("parse_mode", c.parseMode),
+			slog.String("error", err.Error()))
+
+		payload = sendMessageRequest{ChatID: chatID, Text: text, ReplyMarkup: replyMarkup}
+		err = c.callAPI(ctx, "sendMessage", payload, &sentMessage)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to send Telegram message",
+			slog.Int64("chat_id", chatID),
+			slog.String("error", err.Error()))
+		return 0, err
+	}
+
+	return sentMessage.MessageID, nil
+}
+
+// sendDocument uploads the content as a file to the chat
+func (c *Client) sendDocument(ctx context.Context, input sendDocumentInput) (int64, error) {
+	apiURL := fmt.Sprintf("%s/sendDocument", c.botUrl())
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	if err := writer.WriteField("chat_id", strconv.FormatInt(input.ChatID, 10)); err != nil {
+		return 0, fmt.Errorf("failed to write chat_id field: %w", err)
+	}
+	if input.Caption != "" {
+		if err := writer.WriteField("caption", input.Caption); err != nil {
+			return 0, fmt.Errorf("failed to write caption field: %w", err)
+		}
+	}
+	if input.ReplyMarkup != nil {
+		replyMarkup, err := json.Marshal(input.ReplyMarkup)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal reply markup: %w", err)
+		}
+		if err := writer.WriteField("reply_markup", string(replyMarkup)); err != nil {
+			return 0, fmt.Errorf("failed to write reply_markup field: %w", err)
+		}
+	}
+	fileWriter, err := writer.CreateFormFile("document", input.FileName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create document field: %w", err)
+	}
+	if _, err := fileWriter.Write(input.Content); err != nil {
+		return 0, fmt.Errorf("failed to write document: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return 0, fmt.Errorf("failed to finish multipart body: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, &body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to send Telegram document",
+			slog.Int64("chat_id", input.ChatID),
+			slog.String("error", err.Error()))
+		return 0, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		slog.ErrorContext(ctx, "Telegram API returned non-200 status",
+			slog.String("method", "sendDocument"),
+			slog.Int("status_code", resp.StatusCode),
+			slog.String("response", string(bodyBytes)))
+		return 0, fmt.Errorf("telegram API error: status %d, response: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var apiResp apiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+		return 0, fmt.Errorf("failed to decode response: %w", err)
+	}
+	var sentMessage message
+	if err := json.Unmarshal(apiResp.Result, &sentMessage); err != nil {
+		return 0, fmt.Errorf("failed to decode sendDocument result: %w", err)
+	}
+
+	return sentMessage.MessageID, nil
+}
+
+// EditTextMessage replaces the text of a previously sent message
+func (c *Client) EditTextMessage(ctx context.Context, input core.TelegramEditMessageInput) error {
+	payload := editMessageTextRequest{
 		ChatID:    input.ChatID,
-		Text:      escapedMessage,
-		ParseMode: "MarkdownV2", // Using MarkdownV2 format
+		MessageID: input.MessageID,
+		Text:      c.escape(input.Message),
+		ParseMode: c.parseMode,
 	}
 
-	// Convert payload to JSON
+	if err := c.callAPI(ctx, "editMessageText", payload, nil); err != nil {
+		// Telegram rejects edits that don't change anything, there's nothing to do about it
+		if strings.Contains(err.Error(), "message is not modified") {
+			return nil
+		}
+		slog.ErrorContext(ctx, "Failed to edit Telegram message",
+			slog.Int64("chat_id", input.ChatID),
+			slog.Int64("message_id", input.MessageID),
+			slog.String("error", err.Error()))
+		return err
+	}
+
+	return nil
+}
+
+// AnswerCallbackQuery acknowledges a button press so the client stops showing it as loading,
+// with an optional notification text
+func (c *Client) AnswerCallbackQuery(ctx context.Context, input core.TelegramAnswerCallbackInput) error {
+	payload := answerCallbackQueryRequest{
+		CallbackQueryID: input.CallbackQueryID,
+		Text:            input.Text,
+	}
+
+	if err := c.callAPI(ctx, "answerCallbackQuery", payload, nil); err != nil {
+		slog.ErrorContext(ctx, "Failed to answer Telegram callback query",
+			slog.String("callback_query_id", input.CallbackQueryID),
+			slog.String("error", err.Error()))
+		return err
+	}
+
+	return nil
+}
+
+// SetMyCommands replaces the command list shown by Telegram clients when typing `/`
+func (c *Client) SetMyCommands(ctx context.Context, commands []core.BotCommand) error {
+	payload := setMyCommandsRequest{Commands: make([]botCommand, 0, len(commands))}
+	for _, command := range commands {
+		payload.Commands = append(payload.Commands, botCommand{
+			Command:     command.Command,
+			Description: command.Description,
+		})
+	}
+
+	if err := c.callAPI(ctx, "setMyCommands", payload, nil); err != nil {
+		return fmt.Errorf("failed to set bot commands: %w", err)
+	}
+
+	return nil
+}
+
+// DownloadFile looks up the path of the file with `getFile` and downloads its content
+func (c *Client) DownloadFile(ctx context.Context, fileID string) ([]byte, error) {
+	var f file
+	if err := c.callAPI(ctx, "getFile", getFileRequest{FileID: fileID}, &f); err != nil {
+		return nil, fmt.Errorf("failed to get file: %w", err)
+	}
+	if f.FilePath == "" {
+		return nil, fmt.Errorf("file %s can't be downloaded", fileID)
+	}
+	if f.FileSize > maxDownloadSize {
+		return nil, fmt.Errorf("file %s is too large to download (%d bytes)", fileID, f.FileSize)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.fileUrl(f.FilePath), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.ErrorContext(ctx, "Telegram file download returned non-200 status",
+			slog.String("file_id", fileID),
+			slog.Int("status_code", resp.StatusCode))
+		return nil, fmt.Errorf("telegram file download error: status %d", resp.StatusCode)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxDownloadSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if len(content) > maxDownloadSize {
+		return nil, fmt.Errorf("file %s is too large to download", fileID)
+	}
+
+	return content, nil
+}
+
+// SetWebhook registers the webhook URL together with the secret token that
+// Telegram will send back in the `X-Telegram-Bot-Api-Secret-Token` header,
+// so the URL and the secret verified by the server never drift apart
+func (c *Client) SetWebhook(ctx context.Context, input SetWebhookInput) error {
+	if err := validator.Validate(input); err != nil {
+		return fmt.Errorf("invalid webhook input: %w", err)
+	}
+
+	payload := setWebhookRequest{
+		URL:            input.URL,
+		SecretToken:    input.SecretToken,
+		AllowedUpdates: input.AllowedUpdates,
+	}
+	if err := c.callAPI(ctx, "setWebhook", payload, nil); err != nil {
+		return fmt.Errorf("failed to set webhook: %w", err)
+	}
+
+	slog.InfoContext(ctx, "Telegram webhook registered", slog.String("url", input.URL))
+
+	return nil
+}
+
+// callAPI sends a JSON request to the given Telegram Bot API method
+// and decodes the `result` of the response into out when it's not nil
+func (c *Client) callAPI(ctx context.Context, method string, payload any, out any) error {
+	apiURL := fmt.Sprintf("%s/%s", c.botUrl(), method)
+
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
-		slog.ErrorContext(ctx, "Failed to marshal Telegram message payload",
-			slog.Any("input", input),
-			slog.String("error", err.Error()))
 		return fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
-	// Create HTTP request
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, bytes.NewBuffer(payloadBytes))
 	if err != nil {
-		slog.ErrorContext(ctx, "Failed to create HTTP request for Telegram API",
-			slog.Any("input", input),
-			slog.String("error", err.Error()))
 		return fmt.Errorf("failed to create request: %w", err)
 	}
-
-	// Set headers
 	req.Header.Set("Content-Type", "application/json")
 
-	// Send request
 	client := &http.Client{Timeout: 10 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
-		slog.ErrorContext(ctx, "Failed to send Telegram message",
-			slog.Any("input", input),
-			slog.String("error", err.Error()))
 		return fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
-	// Check response status
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
 		slog.ErrorContext(ctx, "Telegram API returned non-200 status",
-			slog.Any("input", input),
+			slog.String("method", method),
 			slog.Int("status_code", resp.StatusCode),
 			slog.String("response", string(bodyBytes)))
 		return fmt.Errorf("telegram API error: status %d, response: %s", resp.StatusCode, string(bodyBytes))
 	}
 
+	if out != nil {
+		var apiResp apiResponse
+		if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+		if err := json.Unmarshal(apiResp.Result, out); err != nil {
+			return fmt.Errorf("failed to decode %s result: %w", method, err)
+		}
+	}
+
 	return nil
 }
 
-// escapeMarkdownV2 escapes special characters in text for Telegram's MarkdownV2 format
-func escapeMarkdownV2(text string) string {
-	// Characters that need escaping in MarkdownV2:
-	// '_', '*', '[', ']', '(', ')', '~', '`', '>', '#', '+', '-', '=', '|', '{', '}', '.', '!'
-	specialChars := []string{"_", "*", "[", "]", "(", ")", "~", "`", ">", "#", "+", "-", "=", "|", "{", "}", ".", "!"}
+// newInlineKeyboardMarkup converts the buttons to an inline keyboard, or nil when there are none
+func newInlineKeyboardMarkup(buttons [][]core.InlineButton) *inlineKeyboardMarkup {
+	if len(buttons) == 0 {
+		return nil
+	}
 
-	// Replace each special character with its escaped version
-	result := text
-	for _, char := range specialChars {
-		result = strings.ReplaceAll(result, char, "\\"+char)
+	keyboard := make([][]inlineKeyboardButton, 0, len(buttons))
+	for _, row := range buttons {
+		keyboardRow := make([]inlineKeyboardButton, 0, len(row))
+		for _, button := range row {
+			keyboardRow = append(keyboardRow, inlineKeyboardButton{
+				Text:         button.Text,
+				CallbackData: button.CallbackData,
+			})
+		}
+		keyboard = append(keyboard, keyboardRow)
 	}
 
-	return result
+	return &inlineKeyboardMarkup{InlineKeyboard: keyboard}
+}
+
+// formattedLength returns the length of the text as Telegram counts it
+// (UTF-16 code units) once it's formatted for sending
+func (c *Client) formattedLength(text string) int {
+	return len(utf16.Encode([]rune(c.format(text))))
+}
+
+// isEntityParseError checks whether Telegram refused the message because of invalid formatting
+func isEntityParseError(err error) bool {
+	return strings.Contains(err.Error(), "can't parse entities")
 }
@@ -0,0 +1,414 @@
+package telegram_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/izzddalfk/kumote/internal/assistant/core"
+	"github.com/izzddalfk/kumote/internal/assistant/infra/telegram"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTelegramAPI records the requests sent to the Bot API
+type fakeTelegramAPI struct {
+	mu        sync.Mutex
+	messages  []map[string]any
+	answers   []map[string]any
+	commands  []map[string]any
+	webhooks  []map[string]any
+	documents []fakeDocument
+	// rejectEntities makes formatted messages fail like Telegram does on invalid markup
+	rejectEntities bool
+	// files are the files that can be downloaded, by file ID
+	files map[string]string
+}
+
+type fakeDocument struct {
+	ChatID   string
+	FileName string
+	Content  string
+	Caption  string
+}
+
+func (f *fakeTelegramAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/sendMessage"), strings.HasSuffix(r.URL.Path, "/editMessageText"):
+		var payload map[string]any
+		json.NewDecoder(r.Body).Decode(&payload)
+		if f.rejectEntities && payload["parse_mode"] != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]any{
+				"ok":          false,
+				"description": "Bad Request: can't parse entities: Can't find end of the entity starting at byte offset 4",
+			})
+			return
+		}
+		f.messages = append(f.messages, payload)
+		json.NewEncoder(w).Encode(map[string]any{"ok": true, "result": map[string]any{"message_id": len(f.messages)}})
+	case strings.HasSuffix(r.URL.Path, "/answerCallbackQuery"):
+		var payload map[string]any
+		json.NewDecoder(r.Body).Decode(&payload)
+		f.answers = append(f.answers, payload)
+		json.NewEncoder(w).Encode(map[string]any{"ok": true, "result": true})
+	case strings.HasSuffix(r.URL.Path, "/setMyCommands"):
+		var payload map[string]any
+		json.NewDecoder(r.Body).Decode(&payload)
+		f.commands = append(f.commands, payload)
+		json.NewEncoder(w).Encode(map[string]any{"ok": true, "result": true})
+	case strings.HasSuffix(r.URL.Path, "/setWebhook"):
+		var payload map[string]any
+		json.NewDecoder(r.Body).Decode(&payload)
+		f.webhooks = append(f.webhooks, payload)
+		json.NewEncoder(w).Encode(map[string]any{"ok": true, "result": true})
+	case strings.HasSuffix(r.URL.Path, "/sendDocument"):
+		file, header, err := r.FormFile("document")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		content, _ := io.ReadAll(file)
+		f.documents = append(f.documents, fakeDocument{
+			ChatID:   r.FormValue("chat_id"),
+			FileName: header.Filename,
+			Content:  string(content),
+			Caption:  r.FormValue("caption"),
+		})
+		json.NewEncoder(w).Encode(map[string]any{"ok": true, "result": map[string]any{"message_id": 100}})
+	case strings.HasSuffix(r.URL.Path, "/getFile"):
+		var payload map[string]any
+		json.NewDecoder(r.Body).Decode(&payload)
+		fileID, _ := payload["file_id"].(string)
+		if _, ok := f.files[fileID]; !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]any{"ok": false, "description": "Bad Request: invalid file_id"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"ok": true, "result": map[string]any{
+			"file_id":   fileID,
+			"file_path": "voice/" + fileID + ".oga",
+		}})
+	case strings.HasPrefix(r.URL.Path, "/file/bottest-token/voice/"):
+		content, ok := f.files[strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/file/bottest-token/voice/"), ".oga")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		io.WriteString(w, content)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestClient(t *testing.T) (*telegram.Client, *fakeTelegramAPI) {
+	t.Helper()
+	return newTestClientWithParseMode(t, "")
+}
+
+func newTestClientWithParseMode(t *testing.T, parseMode string) (*telegram.Client, *fakeTelegramAPI) {
+	t.Helper()
+
+	api := &fakeTelegramAPI{}
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	client, err := telegram.NewClient(telegram.ClientConfig{
+		BaseURL:   server.URL,
+		BotToken:  "test-token",
+		ParseMode: parseMode,
+	})
+	require.NoError(t, err)
+
+	return client, api
+}
+
+// longResponse builds a markdown response with paragraphs and a code block
+// that doesn't fit in a single Telegram message
+func longResponse(paragraphs int) string {
+	var sb strings.Builder
+	for i := 0; i < paragraphs; i++ {
+		sb.WriteString(strings.Repeat("The receipt parser reads every line of the image. ", 12))
+		sb.WriteString("\n\n")
+		if i%3 == 1 {
+			sb.WriteString("```go\n")
+			for j := 0; j < 25; j++ {
+				sb.WriteString("if err := parser.Parse(line); err != nil {\n\treturn err\n}\n\n")
+			}
+			sb.WriteString("```\n\n")
+		}
+	}
+	return sb.String()
+}
+
+func TestSendTextMessageShortMessage(t *testing.T) {
+	client, api := newTestClient(t)
+
+	messageID, err := client.SendTextMessage(context.Background(), core.TelegramTextMessageInput{
+		ChatID:  42,
+		Message: "All tests pass.",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), messageID)
+
+	require.Len(t, api.messages, 1)
+	assert.Equal(t, "All tests pass\\.", api.messages[0]["text"], "short messages are sent as-is without a part number")
+}
+
+func TestSendTextMessageConvertsMarkdown(t *testing.T) {
+	client, api := newTestClient(t)
+
+	_, err := client.SendTextMessage(context.Background(), core.TelegramTextMessageInput{
+		ChatID:  42,
+		Message: "## Done\n\nFixed **2** bugs in `parse_line()`.",
+	})
+	require.NoError(t, err)
+
+	require.Len(t, api.messages, 1)
+	assert.Equal(t, core.ParseModeMarkdownV2, api.messages[0]["parse_mode"])
+	assert.Equal(t, "*Done*\n\nFixed *2* bugs in `parse_line()`\\.", api.messages[0]["text"])
+}
+
+func TestSendTextMessageHTMLParseMode(t *testing.T) {
+	client, api := newTestClientWithParseMode(t, core.ParseModeHTML)
+
+	_, err := client.SendTextMessage(context.Background(), core.TelegramTextMessageInput{
+		ChatID:  42,
+		Message: "Fixed **2** bugs in `a < b`.",
+	})
+	require.NoError(t, err)
+
+	require.Len(t, api.messages, 1)
+	assert.Equal(t, core.ParseModeHTML, api.messages[0]["parse_mode"])
+	assert.Equal(t, "Fixed <b>2</b> bugs in <code>a &lt; b</code>.", api.messages[0]["text"])
+}
+
+func TestSendTextMessageFallsBackToPlainText(t *testing.T) {
+	client, api := newTestClient(t)
+	api.rejectEntities = true
+
+	messageID, err := client.SendTextMessage(context.Background(), core.TelegramTextMessageInput{
+		ChatID:  42,
+		Message: "Fixed **2** bugs.",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), messageID)
+
+	require.Len(t, api.messages, 1)
+	assert.Nil(t, api.messages[0]["parse_mode"], "the fallback should be sent without formatting")
+	assert.Equal(t, "Fixed **2** bugs.", api.messages[0]["text"])
+}
+
+func TestSendTextMessageWithButtons(t *testing.T) {
+	client, api := newTestClient(t)
+
+	_, err := client.SendTextMessage(context.Background(), core.TelegramTextMessageInput{
+		ChatID:  42,
+		Message: longResponse(8),
+		Buttons: [][]core.InlineButton{
+			{{Text: "carlogbook", CallbackData: "project:abc:0"}},
+			{{Text: "car-wash", CallbackData: "project:abc:1"}},
+		},
+	})
+	require.NoError(t, err)
+
+	require.Greater(t, len(api.messages), 1)
+	for _, message := range api.messages[:len(api.messages)-1] {
+		assert.Nil(t, message["reply_markup"], "only the last part should have buttons")
+	}
+	assert.Equal(t, map[string]any{
+		"inline_keyboard": []any{
+			[]any{map[string]any{"text": "carlogbook", "callback_data": "project:abc:0"}},
+			[]any{map[string]any{"text": "car-wash", "callback_data": "project:abc:1"}},
+		},
+	}, api.messages[len(api.messages)-1]["reply_markup"])
+}
+
+func TestNewClientRejectsUnknownParseMode(t *testing.T) {
+	_, err := telegram.NewClient(telegram.ClientConfig{
+		BaseURL:   "https://api.telegram.org",
+		BotToken:  "test-token",
+		ParseMode: core.ParseModeMarkdown,
+	})
+	assert.Error(t, err)
+}
+
+func TestSendTextMessageSplitsLongMessages(t *testing.T) {
+	client, api := newTestClient(t)
+
+	messageID, err := client.SendTextMessage(context.Background(), core.TelegramTextMessageInput{
+		ChatID:  42,
+		Message: longResponse(8),
+	})
+	require.NoError(t, err)
+
+	require.Greater(t, len(api.messages), 1, "long message should be split")
+	assert.Equal(t, int64(len(api.messages)), messageID, "the ID of the last part should be returned")
+
+	for i, message := range api.messages {
+		text := message["text"].(string)
+		assert.LessOrEqual(t, len(utf16.Encode([]rune(text))), core.TelegramMaxMessageLength, "part %d is too long", i+1)
+		assert.True(t, strings.HasPrefix(text, "\\("), "part %d should be numbered", i+1)
+		assert.Contains(t, text, fmt.Sprintf("/%d\\)", len(api.messages)))
+		assert.Equal(t, 0, strings.Count(text, "```")%2, "code fences of part %d are not balanced", i+1)
+	}
+}
+
+func TestSendTextMessageSplitsLongCodeBlock(t *testing.T) {
+	client, api := newTestClient(t)
+
+	code := "```python\n" + strings.Repeat("print('checking the receipts of my car')\n", 150) + "```"
+	_, err := client.SendTextMessage(context.Background(), core.TelegramTextMessageInput{
+		ChatID:  42,
+		Message: code,
+	})
+	require.NoError(t, err)
+
+	require.Len(t, api.messages, 2)
+	for i, message := range api.messages {
+		text := message["text"].(string)
+		assert.Contains(t, text, "```python\n", "part %d should reopen the code block with its language", i+1)
+		assert.True(t, strings.HasSuffix(text, "\n```"), "part %d should close the code block", i+1)
+	}
+}
+
+func TestSendTextMessageSplitsOversizedFences(t *testing.T) {
+	longFence := "```" + strings.Repeat("a", 5000)
+
+	testCases := []struct {
+		name    string
+		message string
+	}{
+		{name: "Fence line longer than the limit", message: longFence + "\n```"},
+		{name: "Fence line longer than the limit with code", message: longFence + "\nfmt.Println(\"receipts\")\n```"},
+		{name: "Unclosed fence line longer than the limit", message: "Here it is:\n\n" + longFence},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client, api := newTestClient(t)
+
+			_, err := client.SendTextMessage(context.Background(), core.TelegramTextMessageInput{
+				ChatID:  42,
+				Message: tc.message,
+			})
+			require.NoError(t, err)
+
+			require.Greater(t, len(api.messages), 1, "long message should be split")
+			for i, message := range api.messages {
+				text := message["text"].(string)
+				assert.LessOrEqual(t, len(utf16.Encode([]rune(text))), core.TelegramMaxMessageLength, "part %d is too long", i+1)
+			}
+		})
+	}
+}
+
+func TestSendTextMessageSplitsLongBoldSpan(t *testing.T) {
+	client, api := newTestClient(t)
+
+	bold := "**" + strings.TrimSpace(strings.Repeat("the receipts of my car ", 250)) + "**"
+	_, err := client.SendTextMessage(context.Background(), core.TelegramTextMessageInput{
+		ChatID:  42,
+		Message: "Summary: " + bold + " and [the receipts](https://example.com/receipts) `go test ./...`",
+	})
+	require.NoError(t, err)
+
+	// the bold span is moved to its own parts instead of being cut after the summary
+	require.Len(t, api.messages, 3)
+	assert.True(t, strings.HasSuffix(api.messages[0]["text"].(string), "Summary: "))
+	for i, message := range api.messages {
+		text := message["text"].(string)
+		assert.NotContains(t, text, "\\*", "part %d should not show the bold delimiters", i+1)
+		assert.Equal(t, 0, strings.Count(text, "*")%2, "bold of part %d is not balanced", i+1)
+		assert.Equal(t, 0, strings.Count(text, "`")%2, "code of part %d is not balanced", i+1)
+	}
+	assert.Contains(t, api.messages[2]["text"], "[the receipts](https://example.com/receipts)")
+}
+
+func TestSendTextMessageSendsVeryLongMessagesAsDocument(t *testing.T) {
+	client, api := newTestClient(t)
+
+	response := longResponse(60)
+	messageID, err := client.SendTextMessage(context.Background(), core.TelegramTextMessageInput{
+		ChatID:  42,
+		Message: response,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), messageID)
+
+	assert.Empty(t, api.messages)
+	require.Len(t, api.documents, 1)
+	assert.Equal(t, "42", api.documents[0].ChatID)
+	assert.Equal(t, "response.md", api.documents[0].FileName)
+	assert.Equal(t, response, api.documents[0].Content)
+	assert.NotEmpty(t, api.documents[0].Caption)
+}
+
+func TestAnswerCallbackQuery(t *testing.T) {
+	client, api := newTestClient(t)
+
+	err := client.AnswerCallbackQuery(context.Background(), core.TelegramAnswerCallbackInput{
+		CallbackQueryID: "cb-1",
+		Text:            "📁 carlogbook",
+	})
+	require.NoError(t, err)
+
+	require.Len(t, api.answers, 1)
+	assert.Equal(t, map[string]any{"callback_query_id": "cb-1", "text": "📁 carlogbook"}, api.answers[0])
+}
+
+func TestSetMyCommands(t *testing.T) {
+	client, api := newTestClient(t)
+
+	err := client.SetMyCommands(context.Background(), []core.BotCommand{
+		{Command: "help", Description: "Show the available commands"},
+		{Command: "projects", Description: "List the projects"},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, api.commands, 1)
+	assert.Equal(t, map[string]any{"commands": []any{
+		map[string]any{"command": "help", "description": "Show the available commands"},
+		map[string]any{"command": "projects", "description": "List the projects"},
+	}}, api.commands[0])
+}
+
+func TestSetWebhook(t *testing.T) {
+	client, api := newTestClient(t)
+
+	err := client.SetWebhook(context.Background(), telegram.SetWebhookInput{
+		URL:            "https://kumote.example.com/telegram",
+		SecretToken:    "webhook-secret",
+		AllowedUpdates: []string{"message", "callback_query"},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, api.webhooks, 1)
+	assert.Equal(t, map[string]any{
+		"url":             "https://kumote.example.com/telegram",
+		"secret_token":    "webhook-secret",
+		"allowed_updates": []any{"message", "callback_query"},
+	}, api.webhooks[0])
+}
+
+func TestDownloadFile(t *testing.T) {
+	client, api := newTestClient(t)
+	api.files = map[string]string{"voice-1": "OggS voice"}
+
+	content, err := client.DownloadFile(context.Background(), "voice-1")
+	require.NoError(t, err)
+	assert.Equal(t, "OggS voice", string(content))
+
+	_, err = client.DownloadFile(context.Background(), "missing")
+	assert.ErrorContains(t, err, "invalid file_id")
+}
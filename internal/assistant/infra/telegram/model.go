@@ -1,8 +1,86 @@
 package telegram
 
+import "encoding/json"
+
 // Prepare the request payload
 type sendMessageRequest struct {
+	ChatID      int64                 `json:"chat_id"`
+	Text        string                `json:"text"`
+	ParseMode   string                `json:"parse_mode,omitempty"`
+	ReplyMarkup *inlineKeyboardMarkup `json:"reply_markup,omitempty"`
+}
+
+type inlineKeyboardMarkup struct {
+	InlineKeyboard [][]inlineKeyboardButton `json:"inline_keyboard"`
+}
+
+type inlineKeyboardButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data"`
+}
+
+// SetWebhookInput holds the webhook registration parameters
+type SetWebhookInput struct {
+	URL            string   `validate:"nonzero"`
+	SecretToken    string   `validate:"nonzero"`
+	AllowedUpdates []string `validate:"nonzero"` // Update types sent to the webhook, e.g. "message"
+}
+
+type setWebhookRequest struct {
+	URL            string   `json:"url"`
+	SecretToken    string   `json:"secret_token"`
+	AllowedUpdates []string `json:"allowed_updates"`
+}
+
+type answerCallbackQueryRequest struct {
+	CallbackQueryID string `json:"callback_query_id"`
+	Text            string `json:"text,omitempty"`
+}
+
+type setMyCommandsRequest struct {
+	Commands []botCommand `json:"commands"`
+}
+
+type botCommand struct {
+	Command     string `json:"command"`
+	Description string `json:"description"`
+}
+
+type editMessageTextRequest struct {
 	ChatID    int64  `json:"chat_id"`
+	MessageID int64  `json:"message_id"`
 	Text      string `json:"text"`
 	ParseMode string `json:"parse_mode,omitempty"`
 }
+
+// apiResponse is the envelope of every Telegram Bot API response
+type apiResponse struct {
+	OK          bool            `json:"ok"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	Description string          `json:"description,omitempty"`
+}
+
+// message is the part of a Telegram message we care about
+type message struct {
+	MessageID int64 `json:"message_id"`
+}
+
+type getFileRequest struct {
+	FileID string `json:"file_id"`
+}
+
+// file is a file ready to be downloaded, its path is valid for at least an hour
+type file struct {
+	FileID   string `json:"file_id"`
+	FileSize int64  `json:"file_size,omitempty"`
+	FilePath string `json:"file_path,omitempty"`
+}
+
+// sendDocumentInput holds a file to upload with `sendDocument`
+type sendDocumentInput struct {
+	ChatID      int64
+	FileName    string
+	Content     []byte
+	Caption     string
+	ReplyMarkup *inlineKeyboardMarkup
+}
@@ -0,0 +1,121 @@
+package transcriber
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/izzddalfk/kumote/internal/assistant/core"
+	"github.com/izzddalfk/kumote/internal/shared/utils/cliprocess"
+	"gopkg.in/validator.v2"
+)
+
+// blankAudioMarker is what whisper.cpp writes when nothing is said in the audio
+const blankAudioMarker = "[BLANK_AUDIO]"
+
+// WhisperCPPTranscriber implements the Transcriber interface with the CLI of whisper.cpp,
+// running locally so the recordings never leave the machine
+type WhisperCPPTranscriber struct {
+	executablePath string
+	modelPath      string
+	ffmpegPath     string
+	language       string
+	debug          bool
+}
+
+type WhisperCPPTranscriberConfig struct {
+	ExecutablePath string `validate:"nonzero"` // whisper.cpp CLI, e.g. whisper-cli
+	ModelPath      string `validate:"nonzero"` // ggml model file, e.g. ggml-base.bin
+	FFmpegPath     string `validate:"nonzero"` // converts the audio to the 16 kHz mono WAV whisper.cpp reads
+	Language       string // Optional spoken language, e.g. "en", or "auto" to detect it. whisper.cpp assumes English when empty
+	Debug          bool
+}
+
+// NewWhisperCPPTranscriber creates a new instance of WhisperCPPTranscriber
+func NewWhisperCPPTranscriber(config WhisperCPPTranscriberConfig) (*WhisperCPPTranscriber, error) {
+	if err := validator.Validate(config); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	return &WhisperCPPTranscriber{
+		executablePath: config.ExecutablePath,
+		modelPath:      config.ModelPath,
+		ffmpegPath:     config.FFmpegPath,
+		language:       config.Language,
+		debug:          config.Debug,
+	}, nil
+}
+
+// Transcribe converts the audio to WAV with ffmpeg and returns the text whisper.cpp hears in it,
+// or an empty text when nothing is said
+func (w *WhisperCPPTranscriber) Transcribe(ctx context.Context, input core.TranscriptionInput) (string, error) {
+	workDir, err := os.MkdirTemp("", "kumote-voice-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create work directory: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	audioPath := filepath.Join(workDir, "audio."+input.Format)
+	if err := os.WriteFile(audioPath, input.Audio, 0600); err != nil {
+		return "", fmt.Errorf("failed to write audio: %w", err)
+	}
+
+	wavPath := filepath.Join(workDir, "audio-16k.wav")
+	if _, err := w.run(ctx, "ffmpeg", w.ffmpegPath,
+		"-nostdin", "-loglevel", "error", "-y",
+		"-i", audioPath,
+		"-ar", "16000", "-ac", "1", "-c:a", "pcm_s16le",
+		wavPath,
+	); err != nil {
+		return "", err
+	}
+
+	args := []string{
+		"-m", w.modelPath,
+		"-f", wavPath,
+		"-nt", // no timestamps
+		"-np", // no progress or system info, only the transcript
+	}
+	if w.language != "" {
+		args = append(args, "-l", w.language)
+	}
+	output, err := w.run(ctx, "whisper.cpp", w.executablePath, args...)
+	if err != nil {
+		return "", err
+	}
+
+	// whisper.cpp writes a line per segment, the prompt reads better as a single paragraph
+	transcript := strings.ReplaceAll(output, blankAudioMarker, "")
+	return strings.Join(strings.Fields(transcript), " "), nil
+}
+
+// run runs the CLI and returns what it writes to stdout. The error wraps ErrTranscriberUnavailable
+// when the CLI can't be started at all.
+func (w *WhisperCPPTranscriber) run(ctx context.Context, name, executablePath string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, executablePath, args...)
+	cliprocess.KillTreeOnCancel(cmd)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if cliprocess.IsUnavailable(err) {
+			err = fmt.Errorf("%w: %w", core.ErrTranscriberUnavailable, err)
+		}
+		return "", fmt.Errorf("failed to execute %s: %w (stderr: %s)", name, err, strings.TrimSpace(stderr.String()))
+	}
+
+	if w.debug && stderr.Len() > 0 {
+		slog.DebugContext(ctx, "Transcriber stderr",
+			slog.String("cli", name),
+			slog.String("stderr", stderr.String()))
+	}
+
+	return stdout.String(), nil
+}
@@ -0,0 +1,141 @@
+package transcriber_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/izzddalfk/kumote/internal/assistant/core"
+	"github.com/izzddalfk/kumote/internal/assistant/infra/transcriber"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeFFmpeg "converts" the input by copying it to the output, the last argument
+const fakeFFmpeg = `for arg; do out="$arg"; done
+while [ $# -gt 0 ]; do
+	if [ "$1" = "-i" ]; then cp "$2" "$out" || exit 1; fi
+	shift
+done`
+
+func writeFakeExecutable(t *testing.T, name, script string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake executables are shell scripts")
+	}
+
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755)
+	require.NoError(t, err, "failed to write fake executable")
+
+	return path
+}
+
+func TestWhisperCPPTranscriberTranscribe(t *testing.T) {
+	testCases := []struct {
+		name               string
+		whisperOutput      string
+		expectedTranscript string
+	}{
+		{
+			name:               "Speech",
+			whisperOutput:      "\n Run the tests of\n carlogbook and fix them.\n",
+			expectedTranscript: "Run the tests of carlogbook and fix them.",
+		},
+		{
+			name:               "Silence",
+			whisperOutput:      " [BLANK_AUDIO]\n",
+			expectedTranscript: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// the fake whisper.cpp fails unless it gets the model, the language and the converted audio
+			whisper := writeFakeExecutable(t, "whisper-cli", `
+[ "$1 $2" = "-m /models/ggml-base.bin" ] || exit 2
+[ "$(cat "$4")" = "OggS voice" ] || exit 3
+[ "$7 $8" = "-l en" ] || exit 4
+printf '`+tc.whisperOutput+`'`)
+			whisperCPP, err := transcriber.NewWhisperCPPTranscriber(transcriber.WhisperCPPTranscriberConfig{
+				ExecutablePath: whisper,
+				ModelPath:      "/models/ggml-base.bin",
+				FFmpegPath:     writeFakeExecutable(t, "ffmpeg", fakeFFmpeg),
+				Language:       "en",
+			})
+			require.NoError(t, err)
+
+			transcript, err := whisperCPP.Transcribe(context.Background(), core.TranscriptionInput{
+				Audio:  []byte("OggS voice"),
+				Format: core.AudioFormatOGG,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedTranscript, transcript)
+		})
+	}
+}
+
+func TestWhisperCPPTranscriberErrors(t *testing.T) {
+	testCases := []struct {
+		name           string
+		executablePath func(t *testing.T) string
+		ffmpegPath     func(t *testing.T) string
+		expectedErr    error
+	}{
+		{
+			name: "CLI missing",
+			executablePath: func(t *testing.T) string {
+				return filepath.Join(t.TempDir(), "whisper-cli")
+			},
+			ffmpegPath: func(t *testing.T) string {
+				return writeFakeExecutable(t, "ffmpeg", fakeFFmpeg)
+			},
+			expectedErr: core.ErrTranscriberUnavailable,
+		},
+		{
+			name: "ffmpeg missing",
+			executablePath: func(t *testing.T) string {
+				return writeFakeExecutable(t, "whisper-cli", `echo "hello"`)
+			},
+			ffmpegPath: func(t *testing.T) string {
+				return filepath.Join(t.TempDir(), "ffmpeg")
+			},
+			expectedErr: core.ErrTranscriberUnavailable,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			whisperCPP, err := transcriber.NewWhisperCPPTranscriber(transcriber.WhisperCPPTranscriberConfig{
+				ExecutablePath: tc.executablePath(t),
+				ModelPath:      "/models/ggml-base.bin",
+				FFmpegPath:     tc.ffmpegPath(t),
+			})
+			require.NoError(t, err)
+
+			_, err = whisperCPP.Transcribe(context.Background(), core.TranscriptionInput{
+				Audio:  []byte("OggS voice"),
+				Format: core.AudioFormatOGG,
+			})
+			assert.ErrorIs(t, err, tc.expectedErr)
+		})
+	}
+
+	t.Run("Invalid audio", func(t *testing.T) {
+		whisperCPP, err := transcriber.NewWhisperCPPTranscriber(transcriber.WhisperCPPTranscriberConfig{
+			ExecutablePath: writeFakeExecutable(t, "whisper-cli", `echo "hello"`),
+			ModelPath:      "/models/ggml-base.bin",
+			FFmpegPath:     writeFakeExecutable(t, "ffmpeg", `echo "Invalid data found when processing input" >&2; exit 1`),
+		})
+		require.NoError(t, err)
+
+		_, err = whisperCPP.Transcribe(context.Background(), core.TranscriptionInput{
+			Audio:  []byte("not audio"),
+			Format: core.AudioFormatOGG,
+		})
+		assert.ErrorContains(t, err, "Invalid data found when processing input")
+		assert.NotErrorIs(t, err, core.ErrTranscriberUnavailable)
+	})
+}
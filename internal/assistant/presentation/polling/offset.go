@@ -0,0 +1,87 @@
+package polling
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// OffsetStore persists the next Telegram update offset so a restarted
+// poller neither replays nor drops updates
+type OffsetStore interface {
+	// LoadOffset returns the stored offset or 0 when nothing is stored yet
+	LoadOffset() (int64, error)
+
+	// SaveOffset stores the offset of the next update to fetch
+	SaveOffset(offset int64) error
+}
+
+// FileOffsetStore keeps the offset in a plain text file
+type FileOffsetStore struct {
+	path string
+}
+
+// NewFileOffsetStore creates an offset store backed by the given file path
+func NewFileOffsetStore(path string) (*FileOffsetStore, error) {
+	if path == "" {
+		return nil, fmt.Errorf("offset file path cannot be empty")
+	}
+
+	return &FileOffsetStore{
+		path: path,
+	}, nil
+}
+
+// LoadOffset reads the offset from file
+func (s *FileOffsetStore) LoadOffset() (int64, error) {
+	content, err := os.ReadFile(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read offset file: %w", err)
+	}
+
+	value := strings.TrimSpace(string(content))
+	if value == "" {
+		return 0, nil
+	}
+
+	offset, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid offset in %s: %w", s.path, err)
+	}
+
+	return offset, nil
+}
+
+// SaveOffset writes the offset to a temporary file first and then renames it,
+// so a crash in the middle of writing never leaves a corrupted offset behind
+func (s *FileOffsetStore) SaveOffset(offset int64) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary offset file: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.WriteString(strconv.FormatInt(offset, 10)); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to write offset: %w", err)
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to sync offset file: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to close offset file: %w", err)
+	}
+
+	if err := os.Rename(tmpFile.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace offset file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,285 @@
+package polling
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/izzddalfk/kumote/internal/assistant/core"
+	"github.com/izzddalfk/kumote/internal/assistant/presentation/rest/handlers"
+	"gopkg.in/validator.v2"
+)
+
+const (
+	defaultPollTimeout = 30 * time.Second
+	defaultMinBackoff  = 1 * time.Second
+	defaultMaxBackoff  = 60 * time.Second
+)
+
+// Poller fetches updates from Telegram using long polling (`getUpdates`)
+// and feeds them to the assistant service. It's an alternative to the
+// webhook server for setups that can't expose a public URL.
+type Poller struct {
+	assistantService core.AssistantService
+	baseURL          string
+	botToken         string
+	offsetStore      OffsetStore
+	pollTimeout      time.Duration
+	minBackoff       time.Duration
+	maxBackoff       time.Duration
+
+	httpClient *http.Client
+}
+
+type PollerConfig struct {
+	AssistantService core.AssistantService `validate:"nonnil"`
+	BaseURL          string                `validate:"nonzero"`
+	BotToken         string                `validate:"nonzero"`
+	OffsetStore      OffsetStore           `validate:"nonnil"`
+	PollTimeout      time.Duration         // How long Telegram holds a getUpdates request open
+	MinBackoff       time.Duration         // First delay after a failed getUpdates call
+	MaxBackoff       time.Duration         // Upper bound of the exponential backoff
+}
+
+func NewPoller(config PollerConfig) (*Poller, error) {
+	if err := validator.Validate(config); err != nil {
+		return nil, fmt.Errorf("invalid poller configuration: %w", err)
+	}
+
+	pollTimeout := defaultPollTimeout
+	if config.PollTimeout > 0 {
+		pollTimeout = config.PollTimeout
+	}
+	minBackoff := defaultMinBackoff
+	if config.MinBackoff > 0 {
+		minBackoff = config.MinBackoff
+	}
+	maxBackoff := defaultMaxBackoff
+	if config.MaxBackoff > 0 {
+		maxBackoff = config.MaxBackoff
+	}
+	if maxBackoff < minBackoff {
+		maxBackoff = minBackoff
+	}
+
+	return &Poller{
+		assistantService: config.AssistantService,
+		baseURL:          strings.TrimSuffix(config.BaseURL, "/"),
+		botToken:         config.BotToken,
+		offsetStore:      config.OffsetStore,
+		pollTimeout:      pollTimeout,
+		minBackoff:       minBackoff,
+		maxBackoff:       maxBackoff,
+		// give the HTTP client enough room for Telegram to hold the request open
+		httpClient: &http.Client{Timeout: pollTimeout + 10*time.Second},
+	}, nil
+}
+
+// Start runs the poller until the process receives an interrupt signal
+func (p *Poller) Start() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err := p.Run(ctx)
+	if errors.Is(err, context.Canceled) {
+		slog.Warn("poller stopped under request")
+		return nil
+	}
+
+	return err
+}
+
+// Run polls Telegram for updates until the context is cancelled
+func (p *Poller) Run(ctx context.Context) error {
+	offset, err := p.offsetStore.LoadOffset()
+	if err != nil {
+		return fmt.Errorf("failed to load update offset: %w", err)
+	}
+
+	// getUpdates doesn't work while a webhook is registered
+	if err := p.deleteWebhook(ctx); err != nil {
+		slog.WarnContext(ctx, "Failed to delete Telegram webhook before polling",
+			slog.String("error", err.Error()))
+	}
+
+	backoff := p.minBackoff
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		updates, err := p.getUpdates(ctx, offset)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			delay := backoff
+			var apiErr *apiError
+			if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+				delay = time.Duration(apiErr.RetryAfter) * time.Second
+			}
+			slog.ErrorContext(ctx, "Failed to get updates from Telegram",
+				slog.String("error", err.Error()),
+				slog.Duration("retry_in", delay))
+
+			if err := sleep(ctx, delay); err != nil {
+				return err
+			}
+			backoff = min(backoff*2, p.maxBackoff)
+			continue
+		}
+		backoff = p.minBackoff
+
+		for _, update := range updates {
+			p.handleUpdate(ctx, update)
+
+			// Persist the offset after each update so a restart resumes right after it
+			offset = update.UpdateID + 1
+			if err := p.offsetStore.SaveOffset(offset); err != nil {
+				slog.ErrorContext(ctx, "Failed to save update offset",
+					slog.Int64("offset", offset),
+					slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+// handleUpdate processes a single update the same way the webhook handler does
+func (p *Poller) handleUpdate(ctx context.Context, update handlers.TelegramUpdate) {
+	if update.IsCallbackQuery() {
+		if err := p.assistantService.ProcessCallback(ctx, update.ToCallback()); err != nil {
+			slog.WarnContext(ctx, "Polled callback query was not processed",
+				slog.Int64("update_id", update.UpdateID),
+				slog.String("error", err.Error()))
+		}
+		return
+	}
+
+	if !update.IsTextMessage() && !update.IsVoiceMessage() {
+		slog.DebugContext(ctx, "Skipping unsupported update",
+			slog.Int64("update_id", update.UpdateID))
+		return
+	}
+
+	result, err := p.assistantService.ProcessCommand(ctx, update.ToCommand())
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to process polled update",
+			slog.Int64("update_id", update.UpdateID),
+			slog.String("error", err.Error()))
+		return
+	}
+
+	if result != nil && !result.Success {
+		slog.WarnContext(ctx, "Polled update was not processed",
+			slog.Int64("update_id", update.UpdateID),
+			slog.String("reason", result.Error))
+	}
+}
+
+type getUpdatesRequest struct {
+	Offset         int64    `json:"offset,omitempty"`
+	Timeout        int      `json:"timeout"`
+	AllowedUpdates []string `json:"allowed_updates"`
+}
+
+type apiResponse struct {
+	OK          bool            `json:"ok"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	ErrorCode   int             `json:"error_code,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after,omitempty"`
+	} `json:"parameters,omitempty"`
+}
+
+// apiError is returned when Telegram answers with `ok: false`
+type apiError struct {
+	Code        int
+	Description string
+	RetryAfter  int
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("telegram API error %d: %s", e.Code, e.Description)
+}
+
+func (p *Poller) getUpdates(ctx context.Context, offset int64) ([]handlers.TelegramUpdate, error) {
+	var updates []handlers.TelegramUpdate
+	err := p.call(ctx, "getUpdates", getUpdatesRequest{
+		Offset:         offset,
+		Timeout:        int(p.pollTimeout.Seconds()),
+		AllowedUpdates: handlers.AllowedUpdates,
+	}, &updates)
+	if err != nil {
+		return nil, err
+	}
+
+	return updates, nil
+}
+
+func (p *Poller) deleteWebhook(ctx context.Context) error {
+	return p.call(ctx, "deleteWebhook", map[string]bool{"drop_pending_updates": false}, nil)
+}
+
+// call invokes a Telegram Bot API method and decodes its result into out
+func (p *Poller) call(ctx context.Context, method string, payload any, out any) error {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	apiURL := fmt.Sprintf("%s/bot%s/%s", p.baseURL, p.botToken, method)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, bytes.NewReader(payloadBytes))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var apiResp apiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+		return fmt.Errorf("failed to decode response (status %d): %w", resp.StatusCode, err)
+	}
+	if !apiResp.OK {
+		return &apiError{
+			Code:        apiResp.ErrorCode,
+			Description: apiResp.Description,
+			RetryAfter:  apiResp.Parameters.RetryAfter,
+		}
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(apiResp.Result, out); err != nil {
+			return fmt.Errorf("failed to decode %s result: %w", method, err)
+		}
+	}
+
+	return nil
+}
+
+// sleep waits for the given duration or until the context is cancelled
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,216 @@
+package polling_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/izzddalfk/kumote/internal/assistant/core"
+	"github.com/izzddalfk/kumote/internal/assistant/presentation/polling"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAssistantService records every command and callback it receives
+type fakeAssistantService struct {
+	mu        sync.Mutex
+	commands  []core.Command
+	callbacks []core.Callback
+	received  chan struct{}
+}
+
+func (f *fakeAssistantService) ProcessCommand(ctx context.Context, cmd core.Command) (*core.QueryResult, error) {
+	f.mu.Lock()
+	f.commands = append(f.commands, cmd)
+	f.mu.Unlock()
+	f.received <- struct{}{}
+	return &core.QueryResult{Success: true}, nil
+}
+
+func (f *fakeAssistantService) ProcessCallback(ctx context.Context, callback core.Callback) error {
+	f.mu.Lock()
+	f.callbacks = append(f.callbacks, callback)
+	f.mu.Unlock()
+	f.received <- struct{}{}
+	return nil
+}
+
+func (f *fakeAssistantService) GetMetricsReport(ctx context.Context, period string) (*core.MetricsReport, error) {
+	return &core.MetricsReport{Period: period}, nil
+}
+
+// fakeTelegram serves getUpdates from a fixed list of updates and fails
+// the first `failures` calls to exercise the backoff
+type fakeTelegram struct {
+	mu       sync.Mutex
+	updates  []map[string]any
+	failures int
+	offsets  []int64
+}
+
+func (f *fakeTelegram) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/deleteWebhook"):
+		json.NewEncoder(w).Encode(map[string]any{"ok": true, "result": true})
+	case strings.HasSuffix(r.URL.Path, "/getUpdates"):
+		var req struct {
+			Offset int64 `json:"offset"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		f.mu.Lock()
+		f.offsets = append(f.offsets, req.Offset)
+		if f.failures > 0 {
+			f.failures--
+			f.mu.Unlock()
+			w.WriteHeader(http.StatusBadGateway)
+			json.NewEncoder(w).Encode(map[string]any{"ok": false, "error_code": 502, "description": "Bad Gateway"})
+			return
+		}
+		var result []map[string]any
+		for _, update := range f.updates {
+			if int64(update["update_id"].(int)) >= req.Offset {
+				result = append(result, update)
+			}
+		}
+		f.mu.Unlock()
+
+		if len(result) == 0 {
+			// emulate long polling without blocking the test for long
+			time.Sleep(20 * time.Millisecond)
+		}
+		json.NewEncoder(w).Encode(map[string]any{"ok": true, "result": result})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeTelegram) lastOffset() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.offsets[len(f.offsets)-1]
+}
+
+func newTextUpdate(updateID, messageID, userID int, text string) map[string]any {
+	return map[string]any{
+		"update_id": updateID,
+		"message": map[string]any{
+			"message_id": messageID,
+			"from":       map[string]any{"id": userID, "first_name": "Tester"},
+			"chat":       map[string]any{"id": userID, "type": "private"},
+			"text":       text,
+		},
+	}
+}
+
+func TestPollerRun(t *testing.T) {
+	telegram := &fakeTelegram{
+		failures: 1,
+		updates: []map[string]any{
+			newTextUpdate(100, 1, 42, "  what changed in carlogbook? "),
+			{"update_id": 101}, // unsupported update without text message
+			newTextUpdate(102, 2, 42, "run the tests in kumote"),
+			{
+				"update_id": 103,
+				"callback_query": map[string]any{
+					"id":      "cb-1",
+					"from":    map[string]any{"id": 42},
+					"message": map[string]any{"message_id": 3, "chat": map[string]any{"id": 42}},
+					"data":    "project:abc.1:x:sig",
+				},
+			},
+			{
+				"update_id": 104,
+				"message": map[string]any{
+					"message_id": 4,
+					"from":       map[string]any{"id": 42},
+					"chat":       map[string]any{"id": 42, "type": "private"},
+					"voice":      map[string]any{"file_id": "voice-1", "duration": 3, "mime_type": "audio/ogg"},
+				},
+			},
+		},
+	}
+	server := httptest.NewServer(telegram)
+	defer server.Close()
+
+	offsetStore, err := polling.NewFileOffsetStore(filepath.Join(t.TempDir(), "telegram-offset"))
+	require.NoError(t, err)
+
+	service := &fakeAssistantService{received: make(chan struct{}, 10)}
+	poller, err := polling.NewPoller(polling.PollerConfig{
+		AssistantService: service,
+		BaseURL:          server.URL,
+		BotToken:         "test-token",
+		OffsetStore:      offsetStore,
+		PollTimeout:      time.Second,
+		MinBackoff:       10 * time.Millisecond,
+		MaxBackoff:       20 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- poller.Run(ctx) }()
+
+	for i := 0; i < 4; i++ {
+		select {
+		case <-service.received:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for polled updates")
+		}
+	}
+
+	// wait until the poller asks for the updates after the processed ones
+	assert.Eventually(t, func() bool { return telegram.lastOffset() == 105 }, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	require.Len(t, service.commands, 3)
+	assert.Equal(t, "1", service.commands[0].ID)
+	assert.Equal(t, int64(42), service.commands[0].UserID)
+	assert.Equal(t, "what changed in carlogbook?", service.commands[0].Text)
+	assert.Equal(t, "run the tests in kumote", service.commands[1].Text)
+	assert.Equal(t, &core.Voice{FileID: "voice-1", Duration: 3 * time.Second, MimeType: "audio/ogg"}, service.commands[2].Voice)
+	require.Len(t, service.callbacks, 1)
+	assert.Equal(t, core.Callback{ID: "cb-1", UpdateID: 103, UserID: 42, ChatID: 42, MessageID: 3, Data: "project:abc.1:x:sig"}, service.callbacks[0])
+
+	offset, err := offsetStore.LoadOffset()
+	require.NoError(t, err)
+	assert.Equal(t, int64(105), offset, "offset should point right after the last processed update")
+
+	// A restarted poller must resume from the stored offset instead of replaying updates
+	restarted, err := polling.NewPoller(polling.PollerConfig{
+		AssistantService: service,
+		BaseURL:          server.URL,
+		BotToken:         "test-token",
+		OffsetStore:      offsetStore,
+		PollTimeout:      time.Second,
+	})
+	require.NoError(t, err)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, restarted.Run(ctx), context.DeadlineExceeded)
+	assert.Len(t, service.commands, 3, "restarted poller should not replay processed updates")
+	assert.Equal(t, int64(105), telegram.lastOffset())
+}
+
+func TestFileOffsetStore(t *testing.T) {
+	store, err := polling.NewFileOffsetStore(filepath.Join(t.TempDir(), "offset"))
+	require.NoError(t, err)
+
+	offset, err := store.LoadOffset()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), offset, "missing file should start from zero")
+
+	assert.NoError(t, store.SaveOffset(987654321))
+	offset, err = store.LoadOffset()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(987654321), offset)
+}
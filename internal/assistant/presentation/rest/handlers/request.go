@@ -1,5 +1,13 @@
 package handlers
 
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/izzddalfk/kumote/internal/assistant/core"
+)
+
 // TelegramUpdate represents incoming Telegram update
 type TelegramUpdate struct {
 	UpdateID int64 `json:"update_id"`
@@ -20,7 +28,109 @@ type TelegramUpdate struct {
 			Username  string `json:"username,omitempty"`
 			Type      string `json:"type"`
 		} `json:"chat"`
-		Date int64  `json:"date"`
-		Text string `json:"text,omitempty"`
+		Date  int64  `json:"date"`
+		Text  string `json:"text,omitempty"`
+		Voice *Audio `json:"voice,omitempty"`
+		Audio *Audio `json:"audio,omitempty"`
+	} `json:"message,omitempty"`
+	CallbackQuery *CallbackQuery `json:"callback_query,omitempty"`
+}
+
+// Audio represents a voice message recorded in Telegram, or an audio file sent to the bot
+type Audio struct {
+	FileID   string `json:"file_id"`
+	Duration int64  `json:"duration"` // in seconds
+	MimeType string `json:"mime_type,omitempty"`
+	FileSize int64  `json:"file_size,omitempty"`
+}
+
+// CallbackQuery represents a press of an inline keyboard button
+type CallbackQuery struct {
+	ID   string `json:"id"`
+	From struct {
+		ID int64 `json:"id"`
+	} `json:"from"`
+	// Message is the message with the pressed button, it's missing when the message is too old
+	Message *struct {
+		MessageID int64 `json:"message_id"`
+		Chat      struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
 	} `json:"message,omitempty"`
+	Data string `json:"data,omitempty"`
+}
+
+// AllowedUpdates are the update types the assistant subscribes to
+var AllowedUpdates = []string{"message", "callback_query"}
+
+// IsTextMessage reports whether the update carries a text message
+// that can be turned into a command
+func (u TelegramUpdate) IsTextMessage() bool {
+	return u.Message.Text != ""
+}
+
+// IsVoiceMessage reports whether the update carries a voice message or an audio file
+// that can be transcribed into a command
+func (u TelegramUpdate) IsVoiceMessage() bool {
+	return u.voice() != nil
+}
+
+// voice returns the voice message or audio file of the update, if any
+func (u TelegramUpdate) voice() *core.Voice {
+	audio := u.Message.Voice
+	mimeType := "audio/ogg" // voice messages are always recorded as OGG/Opus
+	if audio == nil {
+		audio = u.Message.Audio
+		mimeType = ""
+	}
+	if audio == nil || audio.FileID == "" {
+		return nil
+	}
+	if audio.MimeType != "" {
+		mimeType = audio.MimeType
+	}
+
+	return &core.Voice{
+		FileID:   audio.FileID,
+		Duration: time.Duration(audio.Duration) * time.Second,
+		MimeType: mimeType,
+		FileSize: audio.FileSize,
+	}
+}
+
+// ToCommand converts the update into a command for the assistant service.
+// It's shared by every ingress (webhook and long polling) so both build
+// commands the same way.
+func (u TelegramUpdate) ToCommand() core.Command {
+	return core.Command{
+		ID:        fmt.Sprintf("%d", u.Message.MessageID),
+		UpdateID:  u.UpdateID,
+		UserID:    u.Message.From.ID,
+		ChatID:    u.Message.Chat.ID,
+		Text:      strings.TrimSpace(u.Message.Text),
+		Timestamp: time.Now(),
+		Voice:     u.voice(),
+	}
+}
+
+// IsCallbackQuery reports whether the update is a button press with callback data
+func (u TelegramUpdate) IsCallbackQuery() bool {
+	return u.CallbackQuery != nil && u.CallbackQuery.Data != ""
+}
+
+// ToCallback converts the button press into a callback for the assistant service
+func (u TelegramUpdate) ToCallback() core.Callback {
+	callback := core.Callback{
+		ID:       u.CallbackQuery.ID,
+		UpdateID: u.UpdateID,
+		UserID:   u.CallbackQuery.From.ID,
+		ChatID:   u.CallbackQuery.From.ID,
+		Data:     u.CallbackQuery.Data,
+	}
+	if message := u.CallbackQuery.Message; message != nil {
+		callback.ChatID = message.Chat.ID
+		callback.MessageID = message.MessageID
+	}
+
+	return callback
 }
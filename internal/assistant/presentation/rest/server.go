@@ -1,6 +1,9 @@
 package rest
 
 import (
+	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"log"
 	"log/slog"
@@ -16,8 +19,14 @@ import (
 	"gopkg.in/validator.v2"
 )
 
+// telegramSecretTokenHeader is the header Telegram uses to send the webhook secret token
+const telegramSecretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
 type Server struct {
 	assistantService core.AssistantService
+	webhookSecret    string
+	statsToken       string
+	metricsHandler   http.Handler
 	port             string
 	readTimeout      time.Duration
 	writeTimeout     time.Duration
@@ -27,6 +36,9 @@ type Server struct {
 
 type ServerConfig struct {
 	AssistantService core.AssistantService `validate:"nonnil"`
+	WebhookSecret    string                `validate:"nonzero"`
+	StatsToken       string                // Bearer token of the `/stats` endpoint, which is disabled when empty
+	MetricsHandler   http.Handler          // Prometheus metrics served on `/metrics` when set, behind the stats token when set too
 	Port             string                `validate:"nonzero"`
 	ReadTimeout      time.Duration         `validate:"nonzero"`
 	WriteTimeout     time.Duration         `validate:"nonzero"`
@@ -37,20 +49,31 @@ func NewServer(config ServerConfig) (*Server, error) {
 		return nil, err
 	}
 
-	return &Server{
+	server := &Server{
 		assistantService: config.AssistantService,
+		webhookSecret:    config.WebhookSecret,
+		statsToken:       config.StatsToken,
+		metricsHandler:   config.MetricsHandler,
 		port:             config.Port,
 		readTimeout:      config.ReadTimeout,
 		writeTimeout:     config.WriteTimeout,
 		router:           gin.Default(),
-	}, nil
-}
+	}
 
-func (s *Server) Start() error {
 	// setup the router
-	s.setup()
+	server.setup()
+
+	return server, nil
+}
+
+// Handler returns the HTTP handler of the server
+func (s *Server) Handler() http.Handler {
+	return s.router
+}
 
-	// start server with graceful shutdown using `server.Close` method
+func (s *Server) Start() error {
+	// start server with graceful shutdown using `server.Shutdown` method,
+	// the webhook requests in flight are given up to the write timeout to finish
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt)
 
@@ -64,7 +87,9 @@ func (s *Server) Start() error {
 	go func() {
 		<-quit
 		slog.Warn("receive interrupt signal")
-		if err := server.Close(); err != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), s.writeTimeout)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
 			log.Fatalf("error closing server: %v", err)
 		}
 	}()
@@ -84,7 +109,7 @@ func (s *Server) setup() {
 	})
 
 	// Telegram webhook handler
-	s.router.POST("/telegram", func(ctx *gin.Context) {
+	s.router.POST("/telegram", s.verifyWebhookSecret, func(ctx *gin.Context) {
 		var incomingUpdate handlers.TelegramUpdate
 		err := ctx.ShouldBindJSON(&incomingUpdate)
 		if err != nil {
@@ -92,21 +117,24 @@ func (s *Server) setup() {
 			return
 		}
 
-		// TODO: Test whether we need verify Telegram webhook signature?
+		// Button presses of inline keyboards
+		if incomingUpdate.IsCallbackQuery() {
+			if err := s.assistantService.ProcessCallback(ctx, incomingUpdate.ToCallback()); err != nil {
+				// the callback is answered to the user already, Telegram shouldn't retry it
+				slog.WarnContext(ctx, "Callback query was not processed", slog.String("error", err.Error()))
+			}
+			ctx.JSON(http.StatusOK, handlers.NewSuccessResponse("Callback processed"))
+			return
+		}
 
-		// Check if the request is text message
-		if incomingUpdate.Message.Text == "" {
+		// Check if the request is a text or voice message
+		if !incomingUpdate.IsTextMessage() && !incomingUpdate.IsVoiceMessage() {
 			ctx.JSON(http.StatusOK, handlers.NewSuccessResponse("Message not supported"))
 			return
 		}
 
-		// Process the text message
-		result, err := s.assistantService.ProcessCommand(ctx, core.Command{
-			ID:        fmt.Sprintf("%d", incomingUpdate.Message.MessageID),
-			UserID:    incomingUpdate.Message.From.ID,
-			Text:      strings.TrimSpace(incomingUpdate.Message.Text),
-			Timestamp: time.Now(),
-		})
+		// Process the message
+		result, err := s.assistantService.ProcessCommand(ctx, incomingUpdate.ToCommand())
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, handlers.NewErrorResponse(err.Error()))
 			return
@@ -122,4 +150,57 @@ func (s *Server) setup() {
 
 		ctx.JSON(http.StatusOK, handlers.NewSuccessResponse(webhookMessage))
 	})
+
+	// Usage report of the period, e.g. `/stats?period=week`
+	if s.statsToken != "" {
+		s.router.GET("/stats", s.verifyStatsToken, func(ctx *gin.Context) {
+			report, err := s.assistantService.GetMetricsReport(ctx, ctx.DefaultQuery("period", core.MetricsPeriodDay))
+			if errors.Is(err, core.ErrInvalidMetricsPeriod) {
+				ctx.JSON(http.StatusBadRequest, handlers.NewErrorResponse(err.Error()))
+				return
+			}
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, handlers.NewErrorResponse(err.Error()))
+				return
+			}
+
+			ctx.JSON(http.StatusOK, handlers.NewSuccessResponse(report))
+		})
+	}
+
+	// Prometheus scrapes
+	if s.metricsHandler != nil {
+		metricsHandlers := []gin.HandlerFunc{gin.WrapH(s.metricsHandler)}
+		if s.statsToken != "" {
+			metricsHandlers = append([]gin.HandlerFunc{s.verifyStatsToken}, metricsHandlers...)
+		}
+		s.router.GET("/metrics", metricsHandlers...)
+	}
+}
+
+// verifyWebhookSecret rejects webhook requests that don't carry the secret token
+// registered with `setWebhook`, so only Telegram can reach the assistant service
+func (s *Server) verifyWebhookSecret(ctx *gin.Context) {
+	secretToken := ctx.GetHeader(telegramSecretTokenHeader)
+	if subtle.ConstantTimeCompare([]byte(secretToken), []byte(s.webhookSecret)) != 1 {
+		slog.WarnContext(ctx, "Rejected webhook request with invalid secret token",
+			slog.String("client_ip", ctx.ClientIP()))
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, handlers.NewErrorResponse("invalid webhook secret token"))
+		return
+	}
+
+	ctx.Next()
+}
+
+// verifyStatsToken rejects requests to the stats and metrics endpoints without the `Authorization: Bearer <token>` header
+func (s *Server) verifyStatsToken(ctx *gin.Context) {
+	token, ok := strings.CutPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.statsToken)) != 1 {
+		slog.WarnContext(ctx, "Rejected stats request with invalid token",
+			slog.String("client_ip", ctx.ClientIP()))
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, handlers.NewErrorResponse("invalid stats token"))
+		return
+	}
+
+	ctx.Next()
 }
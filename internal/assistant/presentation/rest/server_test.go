@@ -0,0 +1,285 @@
+package rest_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/izzddalfk/kumote/internal/assistant/core"
+	"github.com/izzddalfk/kumote/internal/assistant/presentation/rest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAssistantService counts the commands and callbacks that reach the service
+type fakeAssistantService struct {
+	commands  []core.Command
+	callbacks []core.Callback
+}
+
+func (f *fakeAssistantService) ProcessCommand(ctx context.Context, cmd core.Command) (*core.QueryResult, error) {
+	f.commands = append(f.commands, cmd)
+	return &core.QueryResult{Success: true}, nil
+}
+
+func (f *fakeAssistantService) ProcessCallback(ctx context.Context, callback core.Callback) error {
+	f.callbacks = append(f.callbacks, callback)
+	return nil
+}
+
+func (f *fakeAssistantService) GetMetricsReport(ctx context.Context, period string) (*core.MetricsReport, error) {
+	if period != core.MetricsPeriodDay && period != core.MetricsPeriodWeek {
+		return nil, core.ErrInvalidMetricsPeriod
+	}
+	return &core.MetricsReport{Period: period, MetricsSummary: core.MetricsSummary{Commands: 3, Succeeded: 3, SuccessRate: 1}}, nil
+}
+
+func TestTelegramWebhookSecretToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	const updateBody = `{"update_id": 1, "message": {"message_id": 7, "from": {"id": 42}, "chat": {"id": 42}, "text": "hello"}}`
+
+	testCases := []struct {
+		name           string
+		secretToken    string
+		expectedStatus int
+		expectCommand  bool
+	}{
+		{
+			name:           "Valid secret token",
+			secretToken:    "s3cret-token_1",
+			expectedStatus: http.StatusOK,
+			expectCommand:  true,
+		},
+		{
+			name:           "Missing secret token",
+			secretToken:    "",
+			expectedStatus: http.StatusUnauthorized,
+			expectCommand:  false,
+		},
+		{
+			name:           "Wrong secret token",
+			secretToken:    "s3cret-token_2",
+			expectedStatus: http.StatusUnauthorized,
+			expectCommand:  false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			service := &fakeAssistantService{}
+			server, err := rest.NewServer(rest.ServerConfig{
+				AssistantService: service,
+				WebhookSecret:    "s3cret-token_1",
+				Port:             ":0",
+				ReadTimeout:      time.Second,
+				WriteTimeout:     time.Second,
+			})
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodPost, "/telegram", strings.NewReader(updateBody))
+			req.Header.Set("Content-Type", "application/json")
+			if tc.secretToken != "" {
+				req.Header.Set("X-Telegram-Bot-Api-Secret-Token", tc.secretToken)
+			}
+			rec := httptest.NewRecorder()
+			server.Handler().ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.expectedStatus, rec.Code)
+			if tc.expectCommand {
+				require.Len(t, service.commands, 1)
+				assert.Equal(t, int64(1), service.commands[0].UpdateID, "the update ID is used to drop redeliveries")
+			} else {
+				assert.Empty(t, service.commands, "rejected request should not reach the assistant service")
+			}
+		})
+	}
+}
+
+func TestTelegramWebhookCallbackQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	service := &fakeAssistantService{}
+	server, err := rest.NewServer(rest.ServerConfig{
+		AssistantService: service,
+		WebhookSecret:    "s3cret-token_1",
+		Port:             ":0",
+		ReadTimeout:      time.Second,
+		WriteTimeout:     time.Second,
+	})
+	require.NoError(t, err)
+
+	const updateBody = `{"update_id": 2, "callback_query": {"id": "cb-1", "from": {"id": 42},
+		"message": {"message_id": 9, "chat": {"id": -100}}, "data": "project:abc.0:x:sig"}}`
+	req := httptest.NewRequest(http.MethodPost, "/telegram", strings.NewReader(updateBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Telegram-Bot-Api-Secret-Token", "s3cret-token_1")
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, service.commands)
+	assert.Equal(t, []core.Callback{{
+		ID:        "cb-1",
+		UpdateID:  2,
+		UserID:    42,
+		ChatID:    -100,
+		MessageID: 9,
+		Data:      "project:abc.0:x:sig",
+	}}, service.callbacks)
+}
+
+func TestTelegramWebhookVoiceMessage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	testCases := []struct {
+		name          string
+		message       string
+		expectedVoice *core.Voice
+	}{
+		{
+			name:          "Voice message",
+			message:       `"voice": {"file_id": "voice-1", "duration": 12, "file_size": 24000}`,
+			expectedVoice: &core.Voice{FileID: "voice-1", Duration: 12 * time.Second, MimeType: "audio/ogg", FileSize: 24000},
+		},
+		{
+			name:          "Audio file",
+			message:       `"audio": {"file_id": "audio-1", "duration": 90, "mime_type": "audio/mpeg"}`,
+			expectedVoice: &core.Voice{FileID: "audio-1", Duration: 90 * time.Second, MimeType: "audio/mpeg"},
+		},
+		{
+			name:    "Sticker",
+			message: `"sticker": {"file_id": "sticker-1"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			service := &fakeAssistantService{}
+			server, err := rest.NewServer(rest.ServerConfig{
+				AssistantService: service,
+				WebhookSecret:    "s3cret-token_1",
+				Port:             ":0",
+				ReadTimeout:      time.Second,
+				WriteTimeout:     time.Second,
+			})
+			require.NoError(t, err)
+
+			updateBody := `{"update_id": 3, "message": {"message_id": 7, "from": {"id": 42}, "chat": {"id": 42}, ` + tc.message + `}}`
+			req := httptest.NewRequest(http.MethodPost, "/telegram", strings.NewReader(updateBody))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Telegram-Bot-Api-Secret-Token", "s3cret-token_1")
+			rec := httptest.NewRecorder()
+			server.Handler().ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			if tc.expectedVoice == nil {
+				assert.Empty(t, service.commands, "unsupported messages should not reach the assistant service")
+				return
+			}
+			require.Len(t, service.commands, 1)
+			assert.Empty(t, service.commands[0].Text)
+			assert.Equal(t, tc.expectedVoice, service.commands[0].Voice)
+		})
+	}
+}
+
+func TestStatsEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newServer := func(statsToken string) *rest.Server {
+		server, err := rest.NewServer(rest.ServerConfig{
+			AssistantService: &fakeAssistantService{},
+			WebhookSecret:    "s3cret-token_1",
+			StatsToken:       statsToken,
+			Port:             ":0",
+			ReadTimeout:      time.Second,
+			WriteTimeout:     time.Second,
+		})
+		require.NoError(t, err)
+		return server
+	}
+	get := func(server *rest.Server, target, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	server := newServer("st4ts")
+
+	rec := get(server, "/stats", "Bearer st4ts")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var response struct {
+		Success bool               `json:"success"`
+		Data    core.MetricsReport `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.True(t, response.Success)
+	assert.Equal(t, core.MetricsPeriodDay, response.Data.Period, "the last day is reported by default")
+	assert.Equal(t, 3, response.Data.Commands)
+
+	rec = get(server, "/stats?period=week", "Bearer st4ts")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"period":"week"`)
+
+	assert.Equal(t, http.StatusBadRequest, get(server, "/stats?period=year", "Bearer st4ts").Code)
+	assert.Equal(t, http.StatusUnauthorized, get(server, "/stats", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, get(server, "/stats", "Bearer wrong").Code)
+	assert.Equal(t, http.StatusUnauthorized, get(server, "/stats", "st4ts").Code)
+
+	// the endpoint is disabled without a token
+	assert.Equal(t, http.StatusNotFound, get(newServer(""), "/stats", "Bearer ").Code)
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	metricsHandler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("kumote_commands_total 1\n"))
+	})
+	newServer := func(statsToken string, handler http.Handler) *rest.Server {
+		server, err := rest.NewServer(rest.ServerConfig{
+			AssistantService: &fakeAssistantService{},
+			WebhookSecret:    "s3cret-token_1",
+			StatsToken:       statsToken,
+			MetricsHandler:   handler,
+			Port:             ":0",
+			ReadTimeout:      time.Second,
+			WriteTimeout:     time.Second,
+		})
+		require.NoError(t, err)
+		return server
+	}
+	get := func(server *rest.Server, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	// open without a stats token
+	rec := get(newServer("", metricsHandler), "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "kumote_commands_total 1\n", rec.Body.String())
+
+	// behind the stats token when it's set
+	server := newServer("st4ts", metricsHandler)
+	assert.Equal(t, http.StatusOK, get(server, "Bearer st4ts").Code)
+	assert.Equal(t, http.StatusUnauthorized, get(server, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, get(server, "Bearer wrong").Code)
+
+	// disabled without a handler
+	assert.Equal(t, http.StatusNotFound, get(newServer("", nil), "").Code)
+}
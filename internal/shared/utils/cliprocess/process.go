@@ -0,0 +1,19 @@
+// Package cliprocess holds what the adapters running external CLIs, like the agents and
+// the transcriber, share to start and stop them.
+package cliprocess
+
+import (
+	"errors"
+	"io/fs"
+	"os/exec"
+	"time"
+)
+
+// WaitDelay is how long a cancelled CLI has to release its output before it's abandoned
+const WaitDelay = 5 * time.Second
+
+// IsUnavailable reports whether the CLI couldn't be started at all, because it's missing
+// or not executable
+func IsUnavailable(err error) bool {
+	return errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission)
+}
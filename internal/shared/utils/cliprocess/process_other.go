@@ -0,0 +1,11 @@
+//go:build !unix
+
+package cliprocess
+
+import "os/exec"
+
+// KillTreeOnCancel only kills the CLI itself once the context of the command is done,
+// process groups are not available on this platform
+func KillTreeOnCancel(cmd *exec.Cmd) {
+	cmd.WaitDelay = WaitDelay
+}
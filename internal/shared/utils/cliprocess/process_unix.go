@@ -0,0 +1,19 @@
+//go:build unix
+
+package cliprocess
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// KillTreeOnCancel runs the command in its own process group and kills the whole
+// group once the context of the command is done, so the tools started by the CLI
+// (e.g. `go test` or a dev server started by an agent) don't outlive it
+func KillTreeOnCancel(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = WaitDelay
+}
@@ -0,0 +1,382 @@
+package telegramformat
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	fencePattern         = regexp.MustCompile("^\\s*(```+|~~~+)\\s*([\\w+#.-]*)\\s*$")
+	headingPattern       = regexp.MustCompile(`^\s{0,3}#{1,6}\s+(.*?)\s*#*\s*$`)
+	rulePattern          = regexp.MustCompile(`^\s{0,3}([-*_])(\s*[-*_]){2,}\s*$`)
+	quotePattern         = regexp.MustCompile(`^\s{0,3}>\s?(.*)$`)
+	unorderedItemPattern = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	orderedItemPattern   = regexp.MustCompile(`^(\s*)(\d+)[.)]\s+(.*)$`)
+	tableRowPattern      = regexp.MustCompile(`^\s*\|.*\|\s*$`)
+)
+
+// emphasis is the set of inline styles open around the text being converted, a style
+// that is already open isn't opened again, e.g. bold inside a heading
+type emphasis uint8
+
+const (
+	emphasisBold emphasis = 1 << iota
+	emphasisItalic
+	emphasisStrike
+)
+
+// renderer knows how to emit the entities of a Telegram parse mode
+type renderer interface {
+	text(s string) string
+	bold(inner string) string
+	italic(inner string) string
+	strike(inner string) string
+	code(s string) string
+	pre(language, content string) string
+	link(label, url string) string
+	quote(lines []string) string
+	ordered(number string) string
+}
+
+// ToMarkdownV2 converts CommonMark text, as written by AI agents, to Telegram MarkdownV2.
+// Headings become bold lines, list markers become bullets and tables are shown as
+// preformatted text since Telegram supports none of them.
+func ToMarkdownV2(markdown string) string {
+	return convert(markdown, markdownV2Renderer{})
+}
+
+// ToHTML converts CommonMark text, as written by AI agents, to Telegram HTML
+func ToHTML(markdown string) string {
+	return convert(markdown, htmlRenderer{})
+}
+
+// convert walks the markdown line by line and renders every block with r
+func convert(markdown string, r renderer) string {
+	lines := strings.Split(strings.ReplaceAll(markdown, "\r\n", "\n"), "\n")
+	out := make([]string, 0, len(lines))
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		// fenced code block, an unclosed fence runs until the end of the text
+		if matches := fencePattern.FindStringSubmatch(line); matches != nil {
+			fence := matches[1]
+			var (
+				content []string
+				closed  bool
+			)
+			for i++; i < len(lines); i++ {
+				if strings.HasPrefix(strings.TrimSpace(lines[i]), fence[:3]) && strings.Trim(strings.TrimSpace(lines[i]), fence[:1]) == "" {
+					closed = true
+					break
+				}
+				content = append(content, lines[i])
+			}
+			for !closed && len(content) > 0 && strings.TrimSpace(content[len(content)-1]) == "" {
+				content = content[:len(content)-1]
+			}
+			out = append(out, r.pre(matches[2], strings.Join(content, "\n")))
+			continue
+		}
+
+		// tables have no Telegram equivalent, keep their alignment in a preformatted block
+		if tableRowPattern.MatchString(line) {
+			var rows []string
+			for ; i < len(lines) && tableRowPattern.MatchString(lines[i]); i++ {
+				rows = append(rows, strings.TrimSpace(lines[i]))
+			}
+			i--
+			out = append(out, r.pre("", strings.Join(rows, "\n")))
+			continue
+		}
+
+		// consecutive quoted lines form a single block quote
+		if quotePattern.MatchString(line) {
+			var quoted []string
+			for ; i < len(lines) && quotePattern.MatchString(lines[i]); i++ {
+				quoted = append(quoted, convertInline(quotePattern.FindStringSubmatch(lines[i])[1], r, 0))
+			}
+			i--
+			out = append(out, r.quote(quoted))
+			continue
+		}
+
+		out = append(out, convertLine(line, r))
+	}
+
+	return strings.Join(out, "\n")
+}
+
+// convertLine renders a single line that is not part of a multi-line block
+func convertLine(line string, r renderer) string {
+	if rulePattern.MatchString(line) {
+		return r.text("──────────")
+	}
+
+	if matches := headingPattern.FindStringSubmatch(line); matches != nil {
+		return r.bold(convertInline(matches[1], r, emphasisBold))
+	}
+
+	if matches := unorderedItemPattern.FindStringSubmatch(line); matches != nil {
+		return matches[1] + r.text("• ") + convertInline(matches[2], r, 0)
+	}
+
+	if matches := orderedItemPattern.FindStringSubmatch(line); matches != nil {
+		return matches[1] + r.ordered(matches[2]) + convertInline(matches[3], r, 0)
+	}
+
+	return convertInline(line, r, 0)
+}
+
+// convertInline renders the inline formatting of a line: code spans, bold, italic,
+// strikethrough and links. Unmatched delimiters are kept as literal text. Styles in
+// open already apply to the line, so they only render their content.
+func convertInline(line string, r renderer, open emphasis) string {
+	var (
+		sb    strings.Builder
+		plain strings.Builder
+		runes = []rune(line)
+		ends  = newClosers(runes)
+	)
+	flushPlain := func() {
+		if plain.Len() > 0 {
+			sb.WriteString(r.text(plain.String()))
+			plain.Reset()
+		}
+	}
+	// writeStyled renders the content of an emphasis with the style open
+	writeStyled := func(style emphasis, content []rune, render func(string) string) {
+		flushPlain()
+		inner := convertInline(string(content), r, open|style)
+		if open&style != 0 {
+			sb.WriteString(inner)
+			return
+		}
+		sb.WriteString(render(inner))
+	}
+
+	for i := 0; i < len(runes); {
+		ch := runes[i]
+
+		switch {
+		// backslash escapes a punctuation character
+		case ch == '\\' && i+1 < len(runes) && isPunctuation(runes[i+1]):
+			plain.WriteRune(runes[i+1])
+			i += 2
+			continue
+
+		case ch == '`':
+			ticks := countRun(runes, i, '`')
+			delimiter := strings.Repeat("`", ticks)
+			if end := indexFrom(runes, i+ticks, delimiter); end >= 0 {
+				flushPlain()
+				sb.WriteString(r.code(strings.TrimSpace(string(runes[i+ticks : end]))))
+				i = end + ticks
+				continue
+			}
+
+		case (ch == '*' || ch == '_') && hasPrefixAt(runes, i, string([]rune{ch, ch})):
+			// underscores inside words (__init__.py) are not emphasis
+			if ch == '_' && touchesWord(runes, i-1, -1) {
+				plain.WriteString("__")
+				i += 2
+				continue
+			}
+			if end := ends.closing(i+2, string([]rune{ch, ch})); end >= 0 {
+				if ch == '_' && touchesWord(runes, end+2, 1) {
+					break
+				}
+				writeStyled(emphasisBold, runes[i+2:end], r.bold)
+				i = end + 2
+				continue
+			}
+
+		case ch == '*' || ch == '_':
+			// underscores inside words (snake_case) are not emphasis
+			if ch == '_' && touchesWord(runes, i-1, -1) {
+				break
+			}
+			if end := ends.closing(i+1, string(ch)); end >= 0 {
+				if ch == '_' && touchesWord(runes, end+1, 1) {
+					break
+				}
+				writeStyled(emphasisItalic, runes[i+1:end], r.italic)
+				i = end + 1
+				continue
+			}
+
+		case ch == '~' && hasPrefixAt(runes, i, "~~"):
+			if end := ends.closing(i+2, "~~"); end >= 0 {
+				writeStyled(emphasisStrike, runes[i+2:end], r.strike)
+				i = end + 2
+				continue
+			}
+
+		case ch == '[':
+			if labelEnd := indexFrom(runes, i+1, "]("); labelEnd >= 0 {
+				if urlEnd := closingParenthesis(runes, labelEnd+2); urlEnd >= 0 {
+					url := string(runes[labelEnd+2 : urlEnd])
+					if url != "" && !strings.ContainsAny(url, " \t") {
+						flushPlain()
+						sb.WriteString(r.link(convertInline(string(runes[i+1:labelEnd]), r, open), url))
+						i = urlEnd + 1
+						continue
+					}
+				}
+			}
+		}
+
+		plain.WriteRune(ch)
+		i++
+	}
+	flushPlain()
+
+	return sb.String()
+}
+
+// closers finds the closing delimiters of the emphasis of a line. Every search is
+// remembered, otherwise unmatched delimiters, like the ones of `**kwargs`, would be
+// searched again from every nested opener and take exponential time.
+type closers struct {
+	runes []rune
+	found map[closerKey]int
+}
+
+type closerKey struct {
+	start     int
+	delimiter string
+}
+
+func newClosers(runes []rune) *closers {
+	return &closers{runes: runes, found: make(map[closerKey]int)}
+}
+
+// closing finds the delimiter closing an emphasis started right before start.
+// Emphasis can't be empty, start with a space or end with a space. Emphasis nested
+// with the other delimiter of the same character, like `**` inside `*…*`, is skipped
+// along with its own closing delimiter.
+func (c *closers) closing(start int, delimiter string) int {
+	key := closerKey{start: start, delimiter: delimiter}
+	if end, ok := c.found[key]; ok {
+		return end
+	}
+	end := c.search(start, delimiter)
+	c.found[key] = end
+	return end
+}
+
+func (c *closers) search(start int, delimiter string) int {
+	runes := c.runes
+	if start >= len(runes) || runes[start] == ' ' {
+		return -1
+	}
+
+	ch := []rune(delimiter)[0]
+	for i := start + 1; i < len(runes); i++ {
+		if runes[i] == '`' {
+			// skip code spans, delimiters inside them are literal
+			ticks := countRun(runes, i, '`')
+			if end := indexFrom(runes, i+ticks, strings.Repeat("`", ticks)); end >= 0 {
+				i = end + ticks - 1
+				continue
+			}
+		}
+		if runes[i] != ch {
+			continue
+		}
+
+		run := countRun(runes, i, ch)
+		if ch != '~' && run != len(delimiter) {
+			// the other delimiter opens a nested emphasis when it's closed before ours
+			nested := strings.Repeat(string(ch), 3-len(delimiter))
+			if hasPrefixAt(runes, i, nested) {
+				if end := c.closing(i+len(nested), nested); end >= 0 {
+					i = end + len(nested) - 1
+					continue
+				}
+			}
+			// a single delimiter must not be part of a double one, e.g. `*` of `**`
+			if len(delimiter) == 1 {
+				i += run - 1
+				continue
+			}
+		}
+		if hasPrefixAt(runes, i, delimiter) && runes[i-1] != ' ' {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// closingParenthesis finds the parenthesis closing a link URL starting at start,
+// URLs may contain balanced parentheses themselves
+func closingParenthesis(runes []rune, start int) int {
+	depth := 0
+	for i := start; i < len(runes); i++ {
+		switch runes[i] {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+// indexFrom returns the index of the first occurrence of substr in runes at or after start
+func indexFrom(runes []rune, start int, substr string) int {
+	for i := start; i < len(runes); i++ {
+		if hasPrefixAt(runes, i, substr) {
+			return i
+		}
+	}
+	return -1
+}
+
+func hasPrefixAt(runes []rune, i int, prefix string) bool {
+	p := []rune(prefix)
+	if i+len(p) > len(runes) {
+		return false
+	}
+	for j := range p {
+		if runes[i+j] != p[j] {
+			return false
+		}
+	}
+	return true
+}
+
+func countRun(runes []rune, i int, ch rune) int {
+	n := 0
+	for i+n < len(runes) && runes[i+n] == ch {
+		n++
+	}
+	return n
+}
+
+// touchesWord reports whether a word character is reached from i, moving by step, before
+// anything but punctuation. Underscores touching words, like in snake_case or
+// __init__.py, are not emphasis.
+func touchesWord(runes []rune, i, step int) bool {
+	for ; i >= 0 && i < len(runes); i += step {
+		switch {
+		case isWordRune(runes[i]):
+			return true
+		case !isPunctuation(runes[i]):
+			return false
+		}
+	}
+	return false
+}
+
+func isWordRune(ch rune) bool {
+	return ch == '_' || ch >= '0' && ch <= '9' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z'
+}
+
+func isPunctuation(ch rune) bool {
+	return strings.ContainsRune("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", ch)
+}
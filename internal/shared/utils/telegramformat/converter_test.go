@@ -0,0 +1,111 @@
+package telegramformat_test
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/izzddalfk/kumote/internal/shared/utils/telegramformat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// update rewrites the golden files with the current output: go test ./... -run Golden -update
+var update = flag.Bool("update", false, "update golden files")
+
+func TestConvertGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "*.md"))
+	require.NoError(t, err)
+	require.NotEmpty(t, inputs)
+
+	converters := map[string]func(string) string{
+		"mdv2": telegramformat.ToMarkdownV2,
+		"html": telegramformat.ToHTML,
+	}
+
+	for _, input := range inputs {
+		markdown, err := os.ReadFile(input)
+		require.NoError(t, err)
+
+		for format, convert := range converters {
+			name := strings.TrimSuffix(filepath.Base(input), ".md") + "." + format
+			t.Run(name, func(t *testing.T) {
+				golden := filepath.Join("testdata", name+".golden")
+				actual := convert(string(markdown))
+
+				if *update {
+					require.NoError(t, os.WriteFile(golden, []byte(actual), 0644))
+				}
+
+				expected, err := os.ReadFile(golden)
+				require.NoError(t, err)
+				assert.Equal(t, string(expected), actual)
+			})
+		}
+	}
+}
+
+func TestToMarkdownV2(t *testing.T) {
+	testCases := []struct {
+		name     string
+		markdown string
+		expected string
+	}{
+		{
+			name:     "bold and italic",
+			markdown: "**done** and *almost*",
+			expected: "*done* and _almost_",
+		},
+		{
+			name:     "snake case is not italic",
+			markdown: "call parse_receipt_line now",
+			expected: "call parse\\_receipt\\_line now",
+		},
+		{
+			name:     "code span keeps its content",
+			markdown: "run `go test -v ./...`",
+			expected: "run `go test -v ./...`",
+		},
+		{
+			name:     "unmatched delimiters are escaped",
+			markdown: "2 * 3 = 6",
+			expected: "2 \\* 3 \\= 6",
+		},
+		{
+			name:     "link url escapes closing parenthesis",
+			markdown: "[docs](https://example.com/a_(b))",
+			expected: "[docs](https://example.com/a_(b\\))",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, telegramformat.ToMarkdownV2(tc.markdown))
+		})
+	}
+}
+
+func TestToHTML(t *testing.T) {
+	assert.Equal(t,
+		`<b>Fixed</b> the <code>a &lt; b</code> check, see <a href="https://example.com?a=1&amp;b=2">PR</a>`,
+		telegramformat.ToHTML("**Fixed** the `a < b` check, see [PR](https://example.com?a=1&b=2)"))
+}
+
+func TestToMarkdownV2UnmatchedDelimitersAreConvertedQuickly(t *testing.T) {
+	lines := []string{
+		strings.Repeat("pass **kwargs to f, ", 200),
+		strings.Repeat("x **= 2, ", 200),
+		strings.Repeat("**a ", 200),
+		strings.Repeat("__a *b ", 200),
+	}
+
+	for _, line := range lines {
+		startTime := time.Now()
+		converted := telegramformat.ToMarkdownV2(line)
+		assert.Less(t, time.Since(startTime), time.Second, "converting %.20q took too long", line)
+		assert.Contains(t, converted, "\\*", "unmatched delimiters should be kept")
+	}
+}
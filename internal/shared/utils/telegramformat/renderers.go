@@ -0,0 +1,86 @@
+package telegramformat
+
+import (
+	"strings"
+)
+
+var (
+	// markdownV2Escaper escapes the characters reserved by MarkdownV2 in normal text
+	markdownV2Escaper = newEscaper("\\_*[]()~`>#+-=|{}.!")
+	// markdownV2CodeEscaper escapes the characters reserved inside code and pre entities
+	markdownV2CodeEscaper = newEscaper("\\`")
+	// markdownV2URLEscaper escapes the characters reserved inside the URL of a link
+	markdownV2URLEscaper = newEscaper("\\)")
+
+	htmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	// htmlAttributeEscaper also escapes quotes so values can't break out of the attribute
+	htmlAttributeEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+)
+
+// newEscaper builds a replacer prefixing each of the given characters with a backslash
+func newEscaper(chars string) *strings.Replacer {
+	oldnew := make([]string, 0, len(chars)*2)
+	for _, ch := range chars {
+		oldnew = append(oldnew, string(ch), "\\"+string(ch))
+	}
+	return strings.NewReplacer(oldnew...)
+}
+
+// EscapeMarkdownV2 escapes text so Telegram shows it literally in MarkdownV2 mode
+func EscapeMarkdownV2(text string) string {
+	return markdownV2Escaper.Replace(text)
+}
+
+// EscapeHTML escapes text so Telegram shows it literally in HTML mode
+func EscapeHTML(text string) string {
+	return htmlEscaper.Replace(text)
+}
+
+type markdownV2Renderer struct{}
+
+func (markdownV2Renderer) text(s string) string       { return EscapeMarkdownV2(s) }
+func (markdownV2Renderer) bold(inner string) string   { return "*" + inner + "*" }
+func (markdownV2Renderer) italic(inner string) string { return "_" + inner + "_" }
+func (markdownV2Renderer) strike(inner string) string { return "~" + inner + "~" }
+func (markdownV2Renderer) code(s string) string {
+	return "`" + markdownV2CodeEscaper.Replace(s) + "`"
+}
+
+func (markdownV2Renderer) pre(language, content string) string {
+	return "```" + language + "\n" + markdownV2CodeEscaper.Replace(content) + "\n```"
+}
+
+func (markdownV2Renderer) link(label, url string) string {
+	return "[" + label + "](" + markdownV2URLEscaper.Replace(url) + ")"
+}
+
+func (markdownV2Renderer) quote(lines []string) string {
+	return ">" + strings.Join(lines, "\n>")
+}
+
+func (markdownV2Renderer) ordered(number string) string { return number + "\\. " }
+
+type htmlRenderer struct{}
+
+func (htmlRenderer) text(s string) string       { return EscapeHTML(s) }
+func (htmlRenderer) bold(inner string) string   { return "<b>" + inner + "</b>" }
+func (htmlRenderer) italic(inner string) string { return "<i>" + inner + "</i>" }
+func (htmlRenderer) strike(inner string) string { return "<s>" + inner + "</s>" }
+func (htmlRenderer) code(s string) string       { return "<code>" + EscapeHTML(s) + "</code>" }
+
+func (htmlRenderer) pre(language, content string) string {
+	if language == "" {
+		return "<pre>" + EscapeHTML(content) + "</pre>"
+	}
+	return `<pre><code class="language-` + htmlAttributeEscaper.Replace(language) + `">` + EscapeHTML(content) + "</code></pre>"
+}
+
+func (htmlRenderer) link(label, url string) string {
+	return `<a href="` + htmlAttributeEscaper.Replace(url) + `">` + label + "</a>"
+}
+
+func (htmlRenderer) quote(lines []string) string {
+	return "<blockquote>" + strings.Join(lines, "\n") + "</blockquote>"
+}
+
+func (htmlRenderer) ordered(number string) string { return number + ". " }